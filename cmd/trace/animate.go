@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	scenefile "github.com/hunterloftis/oneweekend/pkg/scene"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// animate renders the frames of an animated scene file to numbered images.
+func animate(args []string) error {
+	fs := flag.NewFlagSet("trace animate", flag.ExitOnError)
+	name := fs.String("scene", "", "animated .json scene file")
+	out := fs.String("out", "frame%04d.png", "output file for each frame, with a verb like %04d for the frame number")
+	format := fs.String("format", "", "output format (default from -out extension)")
+	width := fs.Int("width", 400, "image width in pixels")
+	height := fs.Int("height", 300, "image height in pixels")
+	samples := fs.Int("samples", 200, "samples per pixel")
+	seed := fs.Int64("seed", 0, "seed for the random numbers used to sample each pixel of every frame")
+	filter := fs.String("filter", "", "pixel filter: box, tent, gaussian, mitchell, or lanczos")
+	start := fs.Int("start", 0, "first frame to render")
+	end := fs.Int("end", -1, "last frame to render (default the animation's last frame)")
+	skip := fs.Bool("skip-existing", false, "don't render frames whose output file already exists")
+	exposure := fs.Float64("exposure", 0, "exposure adjustment in stops (EV)")
+	tonemap := fs.String("tonemap", "clamp", "tone mapping operator: clamp, reinhard, or filmic")
+	fs.Parse(args)
+
+	if *name == "" {
+		return errors.New("trace animate needs a -scene file")
+	}
+	s, err := scenefile.Load(*name)
+	if err != nil {
+		return err
+	}
+	anim := s.Animation
+	if anim == nil {
+		return fmt.Errorf("%s has no animation", *name)
+	}
+	if *end < 0 || *end >= anim.Frames {
+		*end = anim.Frames - 1
+	}
+	if p := fmt.Sprintf(*out, 1); strings.Contains(p, "%!") || p == fmt.Sprintf(*out, 2) {
+		return fmt.Errorf("-out %q needs one verb for the frame number, like %%04d", *out)
+	}
+	f, err := outputFormat(*out, *format)
+	if err != nil {
+		return err
+	}
+	tone, err := parseTone(*exposure, *tonemap, "")
+	if err != nil {
+		return err
+	}
+	opts := trace.RenderOptions{Samples: *samples, Seed: *seed}
+	if *filter != "" {
+		if opts.Filter, err = trace.ParseFilter(*filter); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	w := trace.NewWindow(*width, *height)
+	for i := *start; i <= *end; i++ {
+		path := fmt.Sprintf(*out, i)
+		if _, err := os.Stat(path); err == nil && *skip {
+			continue
+		}
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		t0, t1 := anim.Time(i)
+		opts.Progress = func(p trace.Progress) {
+			fmt.Fprintf(os.Stderr, "\rframe %d of %d (%.3fs-%.3fs): %s", i, anim.Frames, t0, t1, formatProgress(p))
+		}
+		frame, err := w.Render(ctx, anim.Camera(i), s.Surface, opts)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		frame.SetTone(tone)
+		if err := writeFrame(path, f, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// batchManifest lists the renders of a batch.
+// Each render is a batchEntry, which inherits any fields it doesn't set from the defaults.
+type batchManifest struct {
+	Defaults json.RawMessage   `json:"defaults"`
+	Renders  []json.RawMessage `json:"renders"`
+}
+
+// batchEntry is one render of a batch.
+type batchEntry struct {
+	// Scene is a built-in scene, or a .json, .gltf, or .glb scene file relative to the manifest.
+	Scene string `json:"scene"`
+	// Camera, if set, replaces the scene's camera.
+	Camera *batchCamera `json:"camera"`
+	// Out is the output file, relative to the manifest.
+	Out       string   `json:"out"`
+	Format    string   `json:"format"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	Samples   int      `json:"samples"`
+	Seed      int64    `json:"seed"`
+	Threshold float64  `json:"threshold"`
+	Budget    string   `json:"budget"`
+	Filter    string   `json:"filter"`
+	AOVs      []string `json:"aovs"`
+	Tonemap   string   `json:"tonemap"`
+	Exposure  float64  `json:"exposure"`
+	White     string   `json:"white"`
+}
+
+// batchCamera is a camera for a batch entry, as in a scene file.
+type batchCamera struct {
+	From     *[3]float64 `json:"from"`
+	At       *[3]float64 `json:"at"`
+	Up       *[3]float64 `json:"up"`
+	FOV      float64     `json:"fov"`
+	Aperture float64     `json:"aperture"`
+	Focus    float64     `json:"focus"`
+	Shutter  *[2]float64 `json:"shutter"`
+}
+
+// batchJob is a batch entry, checked and ready to render.
+type batchJob struct {
+	batchEntry
+	index  int
+	scene  string // the scene's name or path, which identifies it in the cache
+	out    string
+	format trace.Format
+	opts   trace.RenderOptions
+	tone   trace.Tone
+	camera *trace.Camera
+}
+
+// batchReport summarizes a batch.
+type batchReport struct {
+	Manifest string        `json:"manifest"`
+	Threads  int           `json:"threads"`
+	Jobs     int           `json:"jobs"`
+	Seconds  float64       `json:"seconds"`
+	Done     int           `json:"done"`
+	Failed   int           `json:"failed"`
+	Renders  []batchResult `json:"renders"`
+}
+
+// batchResult reports the outcome of one render.
+type batchResult struct {
+	Scene  string `json:"scene"`
+	Out    string `json:"out"`
+	Status string `json:"status"` // done, failed, or cancelled
+	Error  string `json:"error,omitempty"`
+	// LoadSeconds is the time spent loading the scene and building its BVH,
+	// which is zero if an earlier render already had.
+	LoadSeconds float64 `json:"loadSeconds"`
+	Seconds     float64 `json:"seconds"`
+	// Workers is the number of threads the render used: its share of the batch's threads.
+	Workers int `json:"workers"`
+	// Samples is the total number of samples taken, over every pixel.
+	Samples int `json:"samples"`
+}
+
+// batch renders every entry in a manifest, loading each scene only once.
+func batch(args []string) error {
+	fs := flag.NewFlagSet("trace batch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: trace batch [flags] manifest.json")
+		fs.PrintDefaults()
+	}
+	threads := fs.Int("threads", runtime.NumCPU(), "CPU budget: the number of threads shared by all renders")
+	jobs := fs.Int("jobs", 1, "number of renders at once, each with an equal share of the threads")
+	report := fs.String("report", "", "file to write a JSON summary of the batch to")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *threads < 1 || *jobs < 1 {
+		return errors.New("-threads and -jobs must be at least 1")
+	}
+	if *jobs > *threads {
+		*jobs = *threads
+	}
+	path := fs.Arg(0)
+	todo, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	start := time.Now()
+	rep := batchReport{Manifest: path, Threads: *threads, Jobs: *jobs, Renders: make([]batchResult, len(todo))}
+	cache := sceneCache{scenes: make(map[string]*cachedScene)}
+	queue := make(chan *batchJob)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	finished := 0
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				j.opts.Workers = *threads / *jobs
+				r := j.render(ctx, &cache)
+				mu.Lock()
+				rep.Renders[j.index] = r
+				finished++
+				msg := fmt.Sprintf("%s in %.1fs", r.Status, r.Seconds)
+				if r.Error != "" {
+					msg += ": " + r.Error
+				}
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s\n", finished, len(todo), r.Out, msg)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range todo {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	rep.Seconds = time.Since(start).Seconds()
+	for _, r := range rep.Renders {
+		if r.Status == "done" {
+			rep.Done++
+		} else {
+			rep.Failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d renders done in %.1fs, %d scenes loaded\n", rep.Done, len(todo), rep.Seconds, len(cache.scenes))
+	if *report != "" {
+		b, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*report, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	if rep.Failed > 0 {
+		return fmt.Errorf("%d renders failed", rep.Failed)
+	}
+	return nil
+}
+
+// readManifest reads and checks every entry of the manifest at path,
+// so that mistakes show up before any rendering starts.
+func readManifest(path string) ([]*batchJob, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m batchManifest
+	if err := strictJSON(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(m.Renders) == 0 {
+		return nil, fmt.Errorf("%s: no renders", path)
+	}
+	dir := filepath.Dir(path)
+	jobs := make([]*batchJob, len(m.Renders))
+	for i, raw := range m.Renders {
+		// the defaults are decoded afresh for each entry,
+		// so that entries setting part of the camera don't share it.
+		e := batchEntry{Width: 400, Height: 300, Samples: 200, Tonemap: "clamp"}
+		if len(m.Defaults) > 0 {
+			if err := strictJSON(m.Defaults, &e); err != nil {
+				return nil, fmt.Errorf("%s: defaults: %v", path, err)
+			}
+		}
+		if err := strictJSON(raw, &e); err != nil {
+			return nil, fmt.Errorf("%s: render %d: %v", path, i+1, err)
+		}
+		j, err := newBatchJob(e, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: render %d: %v", path, i+1, err)
+		}
+		j.index = i
+		jobs[i] = j
+	}
+	return jobs, nil
+}
+
+// strictJSON decodes data into v, rejecting fields that v doesn't have.
+func strictJSON(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+// newBatchJob checks entry e, whose paths are relative to dir, and prepares it to render.
+func newBatchJob(e batchEntry, dir string) (j *batchJob, err error) {
+	j = &batchJob{batchEntry: e, scene: e.Scene}
+	if e.Scene == "" {
+		return nil, errors.New("no scene")
+	}
+	if e.Out == "" {
+		return nil, errors.New("no output file")
+	}
+	switch strings.ToLower(filepath.Ext(e.Scene)) {
+	case ".json", ".gltf", ".glb":
+		if !filepath.IsAbs(e.Scene) {
+			j.scene = filepath.Join(dir, e.Scene)
+		}
+	}
+	if j.out = e.Out; !filepath.IsAbs(e.Out) {
+		j.out = filepath.Join(dir, e.Out)
+	}
+	if e.Width < 1 || e.Height < 1 || e.Samples < 1 {
+		return nil, errors.New("width, height, and samples must be at least 1")
+	}
+	if j.format, err = outputFormat(j.out, e.Format); err != nil {
+		return nil, err
+	}
+	if j.tone, err = parseTone(e.Exposure, e.Tonemap, e.White); err != nil {
+		return nil, err
+	}
+	j.opts = trace.RenderOptions{Samples: e.Samples, Seed: e.Seed}
+	if e.Threshold > 0 || e.Budget != "" {
+		var budget time.Duration
+		if e.Budget != "" {
+			if budget, err = time.ParseDuration(e.Budget); err != nil {
+				return nil, fmt.Errorf("budget: %v", err)
+			}
+		}
+		adaptive(&j.opts, e.Samples, e.Threshold, budget)
+	}
+	if e.Filter != "" {
+		if j.opts.Filter, err = trace.ParseFilter(e.Filter); err != nil {
+			return nil, err
+		}
+	}
+	if j.opts.AOVs, err = parseAOVs(strings.Join(e.AOVs, ",")); err != nil {
+		return nil, err
+	}
+	if err := checkLayers(j.format, j.opts.AOVs); err != nil {
+		return nil, err
+	}
+	if e.Camera != nil {
+		if j.camera, err = e.Camera.build(); err != nil {
+			return nil, fmt.Errorf("camera: %v", err)
+		}
+	}
+	return j, nil
+}
+
+// build returns the camera that c describes.
+func (c *batchCamera) build() (*trace.Camera, error) {
+	if c.From == nil || c.At == nil {
+		return nil, errors.New("needs from and at")
+	}
+	from, at := geom.Vec(*c.From), geom.Vec(*c.At)
+	up := geom.Vec{0, 1, 0}
+	if c.Up != nil {
+		up = geom.Vec(*c.Up)
+	}
+	if up.Cross(from.Minus(at)).LenSq() == 0 {
+		return nil, errors.New("up is parallel to the view direction, or from and at are the same point")
+	}
+	fov := c.FOV
+	if fov == 0 {
+		fov = 40
+	}
+	if fov < 0 || fov >= 180 {
+		return nil, fmt.Errorf("fov should be between 0 and 180 degrees, not %g", fov)
+	}
+	if c.Aperture < 0 || c.Focus < 0 {
+		return nil, errors.New("aperture and focus can't be negative")
+	}
+	focus := c.Focus
+	if focus == 0 {
+		focus = from.Minus(at).Len()
+	}
+	shutter := [2]float64{0, 1}
+	if c.Shutter != nil {
+		shutter = *c.Shutter
+	}
+	return trace.NewCamera(from, at, up.Unit(), fov, c.Aperture, focus, shutter[0], shutter[1]), nil
+}
+
+// render renders the job, with its scene from cache, and writes the result.
+func (j *batchJob) render(ctx context.Context, cache *sceneCache) batchResult {
+	r := batchResult{Scene: j.Scene, Out: j.out, Workers: j.opts.Workers}
+	start := time.Now()
+	fail := func(status string, err error) batchResult {
+		r.Status, r.Error = status, err.Error()
+		r.Seconds = time.Since(start).Seconds()
+		return r
+	}
+	if ctx.Err() != nil {
+		return fail("cancelled", ctx.Err())
+	}
+	sc, loaded := cache.load(j.scene)
+	if sc.err != nil {
+		return fail("failed", sc.err)
+	}
+	if loaded {
+		r.LoadSeconds = sc.load.Seconds()
+	}
+	cam := sc.camera
+	if j.camera != nil {
+		cam = j.camera
+	}
+	frame, err := trace.NewWindow(j.Width, j.Height).Render(ctx, cam, sc.surface, j.opts)
+	r.Samples = frame.Samples()
+	if err != nil {
+		return fail("cancelled", err)
+	}
+	frame.SetTone(j.tone)
+	if dir := filepath.Dir(j.out); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fail("failed", err)
+		}
+	}
+	if err := writeFrame(j.out, j.format, frame); err != nil {
+		return fail("failed", err)
+	}
+	r.Status = "done"
+	r.Seconds = time.Since(start).Seconds()
+	return r
+}
+
+// sceneCache holds scenes that have been loaded, with their BVHs built,
+// so that renders of the same scene share them.
+// Surfaces are only read while rendering, so renders can share them safely.
+type sceneCache struct {
+	mu     sync.Mutex
+	scenes map[string]*cachedScene
+}
+
+type cachedScene struct {
+	once    sync.Once
+	camera  *trace.Camera
+	surface trace.Surface
+	load    time.Duration
+	err     error
+}
+
+// load returns the scene with the given name, loading it if it isn't cached yet.
+// loaded reports whether this call loaded it.
+func (c *sceneCache) load(name string) (sc *cachedScene, loaded bool) {
+	c.mu.Lock()
+	sc, ok := c.scenes[name]
+	if !ok {
+		sc = &cachedScene{}
+		c.scenes[name] = sc
+	}
+	c.mu.Unlock()
+	sc.once.Do(func() {
+		loaded = true
+		start := time.Now()
+		s, err := findScene(name)
+		if err != nil {
+			sc.err = err
+			return
+		}
+		sc.camera, sc.surface = s.build()
+		sc.load = time.Since(start)
+	})
+	return sc, loaded
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestBatch renders two views of one scene, two at a time, and checks that they share the scene.
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "batch.json")
+	writeManifest(t, manifest, `{
+		"defaults": {"scene": "cornell", "width": 8, "height": 6, "samples": 1},
+		"renders": [
+			{"out": "front.png"},
+			{"out": "views/top.ppm", "camera": {"from": [278, 800, 278], "at": [278, 0, 278], "up": [0, 0, 1]}}
+		]
+	}`)
+	report := filepath.Join(dir, "report.json")
+	if err := batch([]string{"-threads", "5", "-jobs", "2", "-report", report, manifest}); err != nil {
+		t.Fatal(err)
+	}
+	rep := readReport(t, report)
+	if rep.Threads != 5 || rep.Jobs != 2 || rep.Done != 2 || rep.Failed != 0 || len(rep.Renders) != 2 {
+		t.Fatalf("report %+v, want 2 renders done by 2 jobs on 5 threads", rep)
+	}
+	loads := 0
+	for i, r := range rep.Renders {
+		if want := []string{"front.png", "views/top.ppm"}[i]; r.Out != filepath.Join(dir, want) {
+			t.Errorf("render %d is of %s, want %s", i, r.Out, filepath.Join(dir, want))
+		}
+		if r.Status != "done" || r.Samples != 8*6 {
+			t.Errorf("render %d is %s with %d samples, want done with %d", i, r.Status, r.Samples, 8*6)
+		}
+		// each job gets an equal share of the threads.
+		if r.Workers != 2 {
+			t.Errorf("render %d used %d workers, want 2", i, r.Workers)
+		}
+		if r.LoadSeconds > 0 {
+			loads++
+		}
+		if _, err := os.Stat(r.Out); err != nil {
+			t.Error(err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("scene loaded by %d renders, want 1", loads)
+	}
+
+	// more jobs than threads leaves one thread for each job.
+	if err := batch([]string{"-threads", "2", "-jobs", "8", "-report", report, manifest}); err != nil {
+		t.Fatal(err)
+	}
+	rep = readReport(t, report)
+	if rep.Jobs != 2 || rep.Renders[0].Workers != 1 || rep.Renders[1].Workers != 1 {
+		t.Errorf("8 jobs on 2 threads ran %d jobs with %d and %d workers, want 2 with 1", rep.Jobs, rep.Renders[0].Workers, rep.Renders[1].Workers)
+	}
+}
+
+// TestBatchFailure checks that a render that fails is reported without stopping the others.
+func TestBatchFailure(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "batch.json")
+	writeManifest(t, manifest, `{
+		"defaults": {"width": 4, "height": 3, "samples": 1},
+		"renders": [
+			{"scene": "nowhere", "out": "a.png"},
+			{"scene": "cornell", "out": "b.png"},
+			{"scene": "missing.json", "out": "c.png"}
+		]
+	}`)
+	report := filepath.Join(dir, "report.json")
+	err := batch([]string{"-threads", "2", "-report", report, manifest})
+	if err == nil || err.Error() != "2 renders failed" {
+		t.Fatalf("got error %v, want 2 renders failed", err)
+	}
+	rep := readReport(t, report)
+	if rep.Done != 1 || rep.Failed != 2 {
+		t.Fatalf("%d done and %d failed, want 1 and 2", rep.Done, rep.Failed)
+	}
+	for i, want := range []string{`unknown scene "nowhere"`, "", "missing.json"} {
+		r := rep.Renders[i]
+		if want == "" {
+			if r.Status != "done" {
+				t.Errorf("render %d is %s: %s", i, r.Status, r.Error)
+			}
+			continue
+		}
+		if r.Status != "failed" || !strings.Contains(r.Error, want) {
+			t.Errorf("render %d is %s with error %q, want failed with %q", i, r.Status, r.Error, want)
+		}
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"empty", `{"renders": []}`, "no renders"},
+		{"unknown field", `{"renders": [{"scene": "cornell", "out": "a.png", "sampels": 4}]}`, `render 1: json: unknown field "sampels"`},
+		{"unknown default", `{"defaults": {"fov": 30}, "renders": [{"scene": "cornell", "out": "a.png"}]}`, `defaults: json: unknown field "fov"`},
+		{"no scene", `{"renders": [{"out": "a.png"}]}`, "render 1: no scene"},
+		{"no output", `{"renders": [{"scene": "cornell", "out": "a.png"}, {"scene": "cornell"}]}`, "render 2: no output file"},
+		{"no pixels", `{"renders": [{"scene": "cornell", "out": "a.png", "width": 0}]}`, "render 1: width, height, and samples must be at least 1"},
+		{"bad budget", `{"renders": [{"scene": "cornell", "out": "a.png", "budget": "soon"}]}`, "render 1: budget:"},
+		{"bad camera", `{"renders": [{"scene": "cornell", "out": "a.png", "camera": {"from": [0, 0, 0]}}]}`, "render 1: camera: needs from and at"},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "batch.json")
+			writeManifest(t, path, test.manifest)
+			_, err := readManifest(path)
+			if err == nil || !strings.HasPrefix(err.Error(), path+": "+test.want) {
+				t.Errorf("got %v, want %s: %s", err, path, test.want)
+			}
+		})
+	}
+}
+
+// TestSceneCache checks that concurrent loads of a scene load it once and share it.
+func TestSceneCache(t *testing.T) {
+	cache := sceneCache{scenes: make(map[string]*cachedScene)}
+	const n = 8
+	scenes := make([]*cachedScene, n)
+	loaded := make([]bool, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "cornell"
+			if i%2 == 1 {
+				name = "nowhere"
+			}
+			scenes[i], loaded[i] = cache.load(name)
+		}(i)
+	}
+	wg.Wait()
+	loads := 0
+	for i := 0; i < n; i++ {
+		if scenes[i] != scenes[i%2] {
+			t.Errorf("load %d returned a different scene from load %d", i, i%2)
+		}
+		if loaded[i] {
+			loads++
+		}
+	}
+	if loads != 2 || len(cache.scenes) != 2 {
+		t.Errorf("%d loads of %d scenes, want 2 of 2", loads, len(cache.scenes))
+	}
+	if sc := scenes[0]; sc.err != nil || sc.surface == nil || sc.camera == nil {
+		t.Errorf("cornell loaded with error %v", sc.err)
+	}
+	if sc := scenes[1]; sc.err == nil || sc.surface != nil {
+		t.Error("an unknown scene loaded without an error")
+	}
+}
+
+func writeManifest(t *testing.T, path, manifest string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readReport(t *testing.T, path string) batchReport {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep batchReport
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// benchScenes are the canonical scenes that trace bench renders by default.
+const benchScenes = "cornell,final,spheres"
+
+// benchReport is the machine-readable output of trace bench.
+type benchReport struct {
+	GoVersion string        `json:"goVersion"`
+	OS        string        `json:"os"`
+	Arch      string        `json:"arch"`
+	CPUs      int           `json:"cpus"`
+	Results   []benchResult `json:"results"`
+}
+
+// benchResult measures the render of one scene.
+type benchResult struct {
+	Scene   string `json:"scene"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Samples int    `json:"samples"`
+	Seed    int64  `json:"seed"`
+	// Rays counts every ray traced: one from the camera for each sample, and one for each bounce.
+	Rays                int64   `json:"rays"`
+	Seconds             float64 `json:"seconds"`
+	RaysPerSecond       float64 `json:"raysPerSecond"`
+	BVHBuildSeconds     float64 `json:"bvhBuildSeconds"`
+	IntersectionsPerRay float64 `json:"intersectionsPerRay"`
+	AllocsPerSample     float64 `json:"allocsPerSample"`
+}
+
+// bench renders canonical scenes at fixed seeds, reports how fast they render as JSON,
+// and optionally compares the results to a baseline.
+func bench(args []string) error {
+	fs := flag.NewFlagSet("trace bench", flag.ExitOnError)
+	names := fs.String("scenes", benchScenes, "comma-separated scenes to render")
+	width := fs.Int("width", 200, "image width in pixels")
+	height := fs.Int("height", 150, "image height in pixels")
+	samples := fs.Int("samples", 16, "samples per pixel")
+	seed := fs.Int64("seed", 1, "seed for the random numbers used to sample each pixel")
+	runs := fs.Int("runs", 3, "number of timed renders of each scene; the fastest is reported")
+	out := fs.String("out", "", "file to write the JSON results to (default stdout)")
+	baseline := fs.String("baseline", "", "JSON results of an earlier trace bench to compare against")
+	tolerance := fs.Float64("tolerance", 0.1, "fraction by which a result may be worse than the baseline before it's a regression")
+	fs.Parse(args)
+
+	if *width < 1 || *height < 1 || *samples < 1 || *runs < 1 {
+		return fmt.Errorf("-width, -height, -samples, and -runs must be at least 1")
+	}
+	var base *benchReport
+	if *baseline != "" {
+		b, err := ioutil.ReadFile(*baseline)
+		if err != nil {
+			return err
+		}
+		base = &benchReport{}
+		if err := json.Unmarshal(b, base); err != nil {
+			return fmt.Errorf("%s: %v", *baseline, err)
+		}
+	}
+	report := benchReport{
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+	}
+	for _, name := range strings.Split(*names, ",") {
+		sc, err := findScene(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s...", sc.name)
+		r := benchScene(sc, *width, *height, *samples, *seed, *runs)
+		fmt.Fprintf(os.Stderr, " %.0f rays/s\n", r.RaysPerSecond)
+		report.Results = append(report.Results, r)
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if *out == "" {
+		os.Stdout.Write(b)
+	} else if err := ioutil.WriteFile(*out, b, 0644); err != nil {
+		return err
+	}
+	if base == nil {
+		return nil
+	}
+	if n := compareBench(base, &report, *tolerance); n > 0 {
+		return fmt.Errorf("%d measurements regressed from %s", n, *baseline)
+	}
+	return nil
+}
+
+// benchScene measures renders of scene sc.
+// A scene whose surfaces are grouped in a BVH has that BVH rebuilt from its surfaces runs times;
+// the fastest build is timed, and the last one built is the BVH that's rendered.
+// Scenes without a top-level BVH are rendered as they're built, and report no build time.
+// One render counts the rays and intersection tests;
+// the fastest of runs more renders, without counting, is timed,
+// and its allocations are reported.
+func benchScene(sc scene, width, height, samples int, seed int64, runs int) benchResult {
+	cam, s := sc.build()
+	var build time.Duration
+	if b, ok := s.(*trace.BVH); ok {
+		ss := b.Surfaces()
+		for i := 0; i < runs; i++ {
+			start := time.Now()
+			s = trace.NewBVH(0, 1, ss...)
+			if elapsed := time.Since(start); i == 0 || elapsed < build {
+				build = elapsed
+			}
+		}
+	}
+
+	w := trace.NewWindow(width, height)
+	opts := trace.RenderOptions{Samples: samples, Seed: seed}
+	c := trace.NewCounter(s)
+	w.Render(context.Background(), cam, c, opts)
+	counts := c.Counts()
+
+	var best time.Duration
+	var allocs uint64
+	for i := 0; i < runs; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		w.Render(context.Background(), cam, s, opts)
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+		if i == 0 || elapsed < best {
+			best = elapsed
+			allocs = after.Mallocs - before.Mallocs
+		}
+	}
+	return benchResult{
+		Scene:               sc.name,
+		Width:               width,
+		Height:              height,
+		Samples:             samples,
+		Seed:                seed,
+		Rays:                counts.Rays,
+		Seconds:             best.Seconds(),
+		RaysPerSecond:       float64(counts.Rays) / best.Seconds(),
+		BVHBuildSeconds:     build.Seconds(),
+		IntersectionsPerRay: float64(counts.Tests) / float64(counts.Rays),
+		AllocsPerSample:     float64(allocs) / float64(width*height*samples),
+	}
+}
+
+// compareBench prints how each result in report compares to the same scene in base,
+// and returns the number of results that are worse by more than tolerance.
+// Results are only compared to baselines rendered with the same settings.
+func compareBench(base, report *benchReport, tolerance float64) (regressions int) {
+	for _, r := range report.Results {
+		var b *benchResult
+		for i := range base.Results {
+			if base.Results[i].Scene == r.Scene {
+				b = &base.Results[i]
+			}
+		}
+		if b == nil {
+			fmt.Fprintf(os.Stderr, "%s: not in baseline\n", r.Scene)
+			continue
+		}
+		if b.Width != r.Width || b.Height != r.Height || b.Samples != r.Samples || b.Seed != r.Seed {
+			fmt.Fprintf(os.Stderr, "%s: baseline has different settings (%dx%d, %d samples, seed %d)\n",
+				r.Scene, b.Width, b.Height, b.Samples, b.Seed)
+			regressions++
+			continue
+		}
+		metrics := []struct {
+			name         string
+			was, now     float64
+			higherBetter bool
+		}{
+			{"rays/s", b.RaysPerSecond, r.RaysPerSecond, true},
+			{"bvh build s", b.BVHBuildSeconds, r.BVHBuildSeconds, false},
+			{"intersections/ray", b.IntersectionsPerRay, r.IntersectionsPerRay, false},
+			{"allocs/sample", b.AllocsPerSample, r.AllocsPerSample, false},
+		}
+		for _, m := range metrics {
+			change := 0.0
+			if m.was != 0 {
+				change = (m.now - m.was) / m.was
+			}
+			worse := change > tolerance
+			if m.higherBetter {
+				worse = change < -tolerance
+			}
+			status := "ok"
+			if worse {
+				status = "REGRESSION"
+				regressions++
+			}
+			fmt.Fprintf(os.Stderr, "%-14s %-18s %12.4g -> %-12.4g %+6.1f%%  %s\n",
+				r.Scene, m.name, m.was, m.now, 100*change, status)
+		}
+	}
+	return regressions
+}
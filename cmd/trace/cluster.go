@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hunterloftis/oneweekend/pkg/cluster"
+	scenefile "github.com/hunterloftis/oneweekend/pkg/scene"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// coordinate splits a render among workers started with "trace worker" and writes the merged image.
+func coordinate(args []string) error {
+	fs := flag.NewFlagSet("trace coordinator", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:9000", "address to listen for workers on")
+	name := fs.String("scene", "final", "built-in scene (see trace -list-scenes), or a .json scene file")
+	width := fs.Int("width", 400, "image width in pixels")
+	height := fs.Int("height", 300, "image height in pixels")
+	samples := fs.Int("samples", 200, "samples per pixel (the most per pixel with -threshold)")
+	passes := fs.Int("passes", 1, "number of passes to split the samples into")
+	seed := fs.Int64("seed", 0, "seed for the random numbers used to sample each pixel")
+	threshold := fs.Float64("threshold", 0, "adaptive sampling: stop sampling pixels whose relative error is below this")
+	filter := fs.String("filter", "", "pixel filter: box, tent, gaussian, mitchell, or lanczos")
+	aovs := fs.String("aov", "", "comma-separated AOVs to render: depth, normal, albedo, position, uv, id")
+	lease := fs.Duration("lease", 30*time.Second, "how long a worker may take to return a tile before it's leased to another")
+	out := fs.String("out", "", "output file (default stdout)")
+	format := fs.String("format", "", "output format (default from -out extension, or ppm)")
+	exposure := fs.Float64("exposure", 0, "exposure adjustment in stops (EV)")
+	tonemap := fs.String("tonemap", "clamp", "tone mapping operator: clamp, reinhard, or filmic")
+	fs.Parse(args)
+
+	f, err := outputFormat(*out, *format)
+	if err != nil {
+		return err
+	}
+	tone, err := parseTone(*exposure, *tonemap, "")
+	if err != nil {
+		return err
+	}
+	split := *passes
+	if split < 1 {
+		split = 1
+	}
+	job := cluster.Job{
+		Scene:   *name,
+		Width:   *width,
+		Height:  *height,
+		Samples: (*samples + split - 1) / split,
+		Passes:  split,
+		Seed:    *seed,
+		Filter:  *filter,
+	}
+	if *threshold > 0 {
+		// render passes of 16 samples until every pixel converges or reaches -samples.
+		job.Samples, job.Passes = 16, 0
+		job.Threshold, job.MinSamples, job.MaxSamples = *threshold, 16, *samples
+	}
+	if *aovs != "" {
+		job.AOVs = strings.Split(*aovs, ",")
+	}
+	layers, err := parseAOVs(*aovs)
+	if err != nil {
+		return err
+	}
+	if err := checkLayers(f, layers); err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(*name), ".json") {
+		if job.Source, err = ioutil.ReadFile(*name); err != nil {
+			return err
+		}
+	}
+	// load the scene here too, so that mistakes show up before any workers start.
+	if _, _, err := loadJob(job); err != nil {
+		return err
+	}
+	c, err := cluster.NewCoordinator(job, *lease)
+	if err != nil {
+		return err
+	}
+	c.Progress = printProgress
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	hs := &http.Server{Handler: c}
+	go hs.Serve(l)
+	fmt.Fprintf(os.Stderr, "waiting for workers: trace worker -coordinator http://%s\n", l.Addr())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	frame, err := c.Wait(ctx)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "render stopped early:", err)
+	}
+	frame.SetTone(tone)
+	if err := writeFrame(*out, f, frame); err != nil {
+		return err
+	}
+	// give polling workers a moment to hear that the render is complete.
+	time.Sleep(time.Second)
+	return hs.Shutdown(context.Background())
+}
+
+// work renders tiles for a coordinator until its render is complete.
+func work(args []string) error {
+	fs := flag.NewFlagSet("trace worker", flag.ExitOnError)
+	url := fs.String("coordinator", "http://localhost:9000", "URL of the coordinator")
+	threads := fs.Int("threads", runtime.NumCPU(), "number of tiles to trace at once")
+	fs.Parse(args)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return cluster.Work(ctx, *url, *threads, loadJob)
+}
+
+// loadJob builds a cluster job's scene from its source, or from the built-in scenes.
+func loadJob(j cluster.Job) (*trace.Camera, trace.Surface, error) {
+	if len(j.Source) > 0 {
+		s, err := scenefile.Read(bytes.NewReader(j.Source), j.Scene)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s.Camera, s.Surface, nil
+	}
+	sc, err := findScene(j.Scene)
+	if err != nil {
+		return nil, nil, err
+	}
+	cam, s := sc.build()
+	return cam, s, nil
+}
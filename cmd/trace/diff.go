@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/hunterloftis/oneweekend/pkg/compare"
+)
+
+// diff compares two renders and prints how different they are.
+func diff(args []string) error {
+	fs := flag.NewFlagSet("trace diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: trace diff [flags] image reference")
+		fs.PrintDefaults()
+	}
+	heat := fs.String("heatmap", "", "PNG file to draw the relative error of each pixel to, in false color")
+	scale := fs.Float64("scale", 0, "relative error drawn as red in the heat map (default the largest error)")
+	downsample := fs.Int("downsample", 1, "compare averages of n x n blocks of pixels, to discount noise")
+	rmse := fs.Float64("rmse", 0, "fail if the root-mean-square error is above this")
+	ssim := fs.Float64("ssim", 0, "fail if the structural similarity is below this")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a, err := readImage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := readImage(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	r, err := compare.Images(compare.Downsample(a, *downsample), compare.Downsample(b, *downsample))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rmse      %.6f\n", r.RMSE)
+	fmt.Printf("psnr      %.3f dB\n", r.PSNR)
+	fmt.Printf("ssim      %.6f\n", r.SSIM)
+	fmt.Printf("relative  %.6f mean, %.6f max\n", r.MeanRelative, r.MaxRelative)
+	if *heat != "" {
+		f, err := os.Create(*heat)
+		if err != nil {
+			return err
+		}
+		if err := png.Encode(f, r.HeatMap(*scale)); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	if *rmse > 0 && r.RMSE > *rmse {
+		return fmt.Errorf("rmse %.6f is above %g", r.RMSE, *rmse)
+	}
+	if *ssim > 0 && r.SSIM < *ssim {
+		return fmt.Errorf("ssim %.6f is below %g", r.SSIM, *ssim)
+	}
+	return nil
+}
+
+// readImage decodes the PNG, JPEG, or PPM image at path.
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	im, _, err := image.Decode(f)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("%s: not a PNG, JPEG, or PPM image", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return im, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// inspect prints statistics about a scene and warns about likely mistakes in it.
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("trace inspect", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: trace inspect [flags] scene")
+		fmt.Fprintln(fs.Output(), "scene is a built-in scene (see trace -list-scenes), or a .json, .gltf, or .glb scene file")
+		fs.PrintDefaults()
+	}
+	t0 := fs.Float64("t0", 0, "start of the time range to inspect moving surfaces over")
+	t1 := fs.Float64("t1", 1, "end of the time range to inspect moving surfaces over")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	sc, err := findScene(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	_, s := sc.build()
+	printReport(os.Stdout, trace.Inspect(s, *t0, *t1))
+	return nil
+}
+
+// printReport writes report r to w, section by section.
+func printReport(w io.Writer, r *trace.Report) {
+	fmt.Fprintln(w, "surfaces:")
+	names := make([]string, 0, len(r.Surfaces))
+	for name := range r.Surfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %8d\n", name, r.Surfaces[name])
+	}
+
+	fmt.Fprintln(w, "materials:")
+	for i, m := range r.Materials {
+		fmt.Fprintf(w, "  %-16s %8d surfaces\n", fmt.Sprintf("#%d %s", i+1, trace.TypeName(m.Material)), m.Surfaces)
+	}
+
+	min, max := r.Bounds.Min(), r.Bounds.Max()
+	fmt.Fprintf(w, "bounds:\n  %.4g, %.4g, %.4g to %.4g, %.4g, %.4g\n", min.X(), min.Y(), min.Z(), max.X(), max.Y(), max.Z())
+
+	for i, b := range r.BVHs {
+		fmt.Fprintf(w, "bvh %d:\n", i+1)
+		fmt.Fprintf(w, "  %d surfaces in %d nodes, %d deep\n", b.Surfaces, b.Nodes, b.Depth)
+		fmt.Fprintf(w, "  sah cost %.2f (%.2f to test every surface)\n", b.Cost, 2*float64(b.Surfaces))
+		sizes := make([]int, 0, len(b.Leaves))
+		for n := range b.Leaves {
+			sizes = append(sizes, n)
+		}
+		sort.Ints(sizes)
+		for _, n := range sizes {
+			fmt.Fprintf(w, "  leaves with %3d surfaces: %6d\n", n, b.Leaves[n])
+		}
+	}
+
+	fmt.Fprintf(w, "memory:\n  about %s\n", formatBytes(r.Memory))
+
+	fmt.Fprintln(w, "emitters:")
+	for _, e := range r.Emitters {
+		fmt.Fprintf(w, "  %-12s area %-10.4g power %.4g, %.4g, %.4g\n", trace.TypeName(e.Surface), e.Area, e.Power.R(), e.Power.G(), e.Power.B())
+	}
+	fmt.Fprintf(w, "  total power %.4g, %.4g, %.4g\n", r.Power.R(), r.Power.G(), r.Power.B())
+
+	if len(r.Warnings) > 0 {
+		fmt.Fprintln(w, "warnings:")
+		for _, warning := range r.Warnings {
+			fmt.Fprintln(w, "  "+warning)
+		}
+	}
+}
+
+// formatBytes formats n bytes in the largest unit that keeps the number above 1.
+func formatBytes(n int) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	v := float64(n)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+func TestPrintReport(t *testing.T) {
+	sc, err := findScene("cornell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, s := sc.build()
+	var buf bytes.Buffer
+	printReport(&buf, trace.Inspect(s, 0, 1))
+	out := buf.String()
+
+	// sections appear in order.
+	last := -1
+	for _, section := range []string{"surfaces:\n", "materials:\n", "bounds:\n", "memory:\n", "emitters:\n"} {
+		i := strings.Index(out, section)
+		if i <= last {
+			t.Fatalf("section %q is missing or out of order in:\n%s", section, out)
+		}
+		last = i
+	}
+	for _, line := range []string{
+		"  Box                 2\n",
+		"  #3 Light                1 surfaces\n",
+		// the light is 130 by 105 units, emitting 15.
+		"  Rect         area 1.365e+04  power 6.432e+05, 6.432e+05, 6.432e+05\n",
+		"  total power 6.432e+05, 6.432e+05, 6.432e+05\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("no %q in:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "trace.") || strings.Contains(out, "warnings:") {
+		t.Errorf("unexpected package names or warnings in:\n%s", out)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0.0 B"},
+		{1023, "1023.0 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+		{2048 << 30, "2048.0 GiB"},
+	}
+	for _, test := range tests {
+		if got := formatBytes(test.n); got != test.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
@@ -1,174 +1,354 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"math/rand"
+	"fmt"
+	"image"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/preview"
 	"github.com/hunterloftis/oneweekend/pkg/trace"
 	"github.com/pkg/profile"
 )
 
+// commands are the subcommands of trace, like "trace serve".
+// Without a subcommand, trace renders a single image.
+var commands = map[string]func(args []string) error{
+	"serve":       serve,
+	"coordinator": coordinate,
+	"worker":      work,
+	"animate":     animate,
+	"bench":       bench,
+	"diff":        diff,
+	"inspect":     inspect,
+	"batch":       batch,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	p := flag.Bool("profile", false, "generate a cpu profile")
-	if flag.Parse(); *p {
+	width := flag.Int("width", 400, "image width in pixels")
+	height := flag.Int("height", 300, "image height in pixels")
+	samples := flag.Int("samples", 200, "samples per pixel (the most per pixel with -threshold or -budget)")
+	seed := flag.Int64("seed", 0, "seed for the random numbers used to sample each pixel")
+	name := flag.String("scene", "final", "built-in scene to render (see -list-scenes), or a .json, .gltf, or .glb scene file")
+	list := flag.Bool("list-scenes", false, "list the built-in scenes and exit")
+	out := flag.String("out", "", "output file (default stdout)")
+	format := flag.String("format", "", "output format: ppm, png, jpeg, hdr, pfm, or exr (default from -out extension, or ppm)")
+	passes := flag.Int("passes", 1, "number of passes to split the samples into (0 re-encodes a -checkpoint without tracing)")
+	checkpoint := flag.String("checkpoint", "", "checkpoint file to resume from, and to save after each pass")
+	threshold := flag.Float64("threshold", 0, "adaptive sampling: stop sampling pixels whose relative error is below this")
+	budget := flag.Duration("budget", 0, "render for this long instead of a fixed number of passes")
+	aovs := flag.String("aov", "", "comma-separated AOVs to render: depth, normal, albedo, position, uv, id")
+	exposure := flag.Float64("exposure", 0, "exposure adjustment in stops (EV)")
+	tonemap := flag.String("tonemap", "clamp", "tone mapping operator: clamp, reinhard, or filmic")
+	white := flag.String("white", "", "color to white balance to, as r,g,b")
+	filter := flag.String("filter", "", "pixel filter: box, tent, gaussian, mitchell, or lanczos (default: each sample only counts toward its own pixel)")
+	show := flag.String("preview", "", "draw the render in the terminal as it progresses: blocks, sixel, or auto")
+	cols := flag.Int("preview-cols", 80, "width of the terminal preview in character cells")
+	if flag.Parse(); *list {
+		listScenes()
+		return
+	}
+	if *p {
 		wd, _ := os.Getwd()
 		defer profile.Start(profile.ProfilePath(wd)).Stop()
 	}
-	w := trace.NewWindow(400, 300)
-	cam, scene := final()
-	if err := w.WritePPM(os.Stdout, cam, scene, 200); err != nil {
-		panic(err)
+	if *width < 1 || *height < 1 || *samples < 1 {
+		fmt.Fprintln(os.Stderr, "-width, -height, and -samples must be at least 1")
+		os.Exit(2)
 	}
-}
-
-func custom() (*trace.Camera, *trace.BVH) {
-	rand.Seed(10)
-	nb := 20
-	w := 100.0
-	var ss []trace.Surface
-	ground := trace.NewLambert(trace.NewUniform(0.48, 0.83, 0.53))
-	light := trace.NewLight(trace.NewUniform(1, 1, 1))
-	for i := 0; i < nb; i++ {
-		for j := 0; j < nb; j++ {
-			min := geom.Vec{-1000 + float64(i)*w, 0, -1000 + float64(j)*w}
-			max := geom.Vec{w, 1 + 99*rand.Float64(), w}.Plus(min)
-			ss = append(ss, trace.NewBox(min, max, ground))
+	sc, err := findScene(*name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	f, err := outputFormat(*out, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	layers, err := parseAOVs(*aovs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	tone, err := parseTone(*exposure, *tonemap, *white)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var fl trace.Filter
+	if *filter != "" {
+		if fl, err = trace.ParseFilter(*filter); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	var pv *preview.Preview
+	if *show != "" {
+		m, err := preview.ParseMode(*show)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
+		pv = preview.New(os.Stderr, m, *cols)
+	}
+	if len(layers) > 0 && f != trace.EXR && *out == "" {
+		fmt.Fprintln(os.Stderr, "-aov needs -out, or an exr format, to write the AOV images")
+		os.Exit(2)
+	}
+	if err := checkLayers(f, layers); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	ss = append(ss, trace.NewRect(geom.Vec{123, 554, 147}, geom.Vec{423, 554, 412}, light))
-	center := geom.Vec{400, 400, 200}
-	ss = append(ss, trace.NewMovingSphere(center, center.Plus(geom.Vec{30, 0, 0}), 0, 1, 50, trace.NewLambert(trace.NewUniform(0.7, 0.3, 0.1))))
-	ss = append(ss, trace.NewSphere(geom.Vec{260, 150, 45}, 50, trace.NewDielectric(1.5)))
-	boundary := trace.NewSphere(geom.Vec{0, 0, 0}, 5000, trace.NewDielectric(1.5))
-	ss = append(ss, trace.NewVolume(boundary, 0.0001, trace.NewIsotropic(trace.NewUniform(1, 1, 1))))
-	f, err := os.Open("images/earthmap.jpg")
+	dst := os.Stdout
+	if *out != "" {
+		if dst, err = os.Create(*out); err != nil {
+			panic(err)
+		}
+		defer dst.Close()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	w := trace.NewWindow(*width, *height)
+	cam, scene := sc.build()
+	split := *passes
+	if split < 1 {
+		split = 1
+	}
+	opts := trace.RenderOptions{
+		Samples:  (*samples + split - 1) / split,
+		Passes:   *passes,
+		Seed:     *seed,
+		AOVs:     layers,
+		Filter:   fl,
+		Progress: printProgress,
+	}
+	if *threshold > 0 || *budget > 0 {
+		adaptive(&opts, *samples, *threshold, *budget)
+	}
+	if *checkpoint != "" {
+		opts.PassDone = func(_ int, f *trace.Frame) {
+			if err := saveCheckpoint(*checkpoint, f); err != nil {
+				fmt.Fprintln(os.Stderr, "\nsaving checkpoint:", err)
+			}
+		}
+	}
+	if pv != nil {
+		opts.TileDone = previewTiles(pv, tone)
+	}
+	frame, err := loadCheckpoint(*checkpoint)
 	if err != nil {
 		panic(err)
 	}
-	earth, err := trace.NewImage(f)
+	if frame != nil && *passes > 0 {
+		if err := w.Resumable(frame, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "can't resume %s: %v\n", *checkpoint, err)
+			os.Exit(2)
+		}
+	}
+	if frame == nil {
+		frame, err = w.Render(ctx, cam, scene, opts)
+	} else if *passes > 0 {
+		err = w.Resume(ctx, frame, cam, scene, opts)
+	}
+	frame.SetTone(tone)
+	if pv != nil {
+		pv.Draw(frame)
+	}
+	fmt.Fprintln(os.Stderr)
 	if err != nil {
+		fmt.Fprintln(os.Stderr, "render stopped early:", err)
+	}
+	if err := frame.Encode(dst, f); err != nil {
 		panic(err)
 	}
-	ss = append(ss, trace.NewSphere(geom.Vec{100, 150, 100}, 50, trace.NewMetal(trace.NewBright(earth, 1.5), 0.1)))
-	ss = append(ss, trace.NewSphere(geom.Vec{400, 200, 400}, 100, trace.NewLight(trace.NewBright(earth, 3))))
-	perlin := trace.NewNoise(0.1, 0.1, 0)
-	ss = append(ss, trace.NewSphere(geom.Vec{220, 280, 300}, 80, trace.NewLambert(perlin)))
+	if f != trace.EXR {
+		for _, a := range frame.AOVs() {
+			if err := writeLayer(*out, f, frame, a); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
 
-	from := geom.Vec{478, 278, -600}
-	at := geom.Vec{278, 278, 0}
-	focus := 10.0
-	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
-	return cam, trace.NewBVH(0, 1, ss...)
+// adaptive changes opts to render passes of 16 samples until threshold or budget is met,
+// tracing at most samples per pixel (rounded up to a whole pass).
+func adaptive(opts *trace.RenderOptions, samples int, threshold float64, budget time.Duration) {
+	opts.Samples, opts.Passes = 16, 0
+	opts.Threshold, opts.Budget = threshold, budget
+	opts.MinSamples, opts.MaxSamples = 16, samples
 }
 
-func final() (*trace.Camera, *trace.BVH) {
-	rand.Seed(10)
-	nb := 20
-	w := 100.0
-	ns := 1000
-	var ss []trace.Surface
-	white := trace.NewLambert(trace.NewUniform(0.73, 0.73, 0.73))
-	ground := trace.NewLambert(trace.NewUniform(0.48, 0.83, 0.53))
-	light := trace.NewLight(trace.NewUniform(7, 7, 7))
-	for i := 0; i < nb; i++ {
-		for j := 0; j < nb; j++ {
-			min := geom.Vec{-1000 + float64(i)*w, 0, -1000 + float64(j)*w}
-			max := geom.Vec{w, 1 + 99*rand.Float64(), w}.Plus(min)
-			ss = append(ss, trace.NewBox(min, max, ground))
+// parseTone builds a tone mapping from command-line values.
+func parseTone(exposure float64, operator, white string) (t trace.Tone, err error) {
+	t.Exposure = exposure
+	if t.Operator, err = trace.ParseToneOperator(operator); err != nil {
+		return t, err
+	}
+	if white != "" {
+		if _, err := fmt.Sscanf(white, "%g,%g,%g", &t.White[0], &t.White[1], &t.White[2]); err != nil {
+			return t, fmt.Errorf("white should be r,g,b: %v", err)
 		}
 	}
-	ss = append(ss, trace.NewRect(geom.Vec{123, 554, 147}, geom.Vec{423, 554, 412}, light))
-	center := geom.Vec{400, 400, 200}
-	ss = append(ss, trace.NewMovingSphere(center, center.Plus(geom.Vec{30, 0, 0}), 0, 1, 50, trace.NewLambert(trace.NewUniform(0.7, 0.3, 0.1))))
-	ss = append(ss, trace.NewSphere(geom.Vec{260, 150, 45}, 50, trace.NewDielectric(1.5)))
-	ss = append(ss, trace.NewSphere(geom.Vec{0, 150, 145}, 50, trace.NewMetal(trace.NewUniform(0.8, 0.8, 0.9), 1)))
-	boundary := trace.NewSphere(geom.Vec{360, 150, 145}, 70, trace.NewDielectric(1.5))
-	ss = append(ss, boundary)
-	ss = append(ss, trace.NewVolume(boundary, 0.2, trace.NewIsotropic(trace.NewUniform(0.2, 0.4, 0.9))))
-	boundary = trace.NewSphere(geom.Vec{0, 0, 0}, 5000, trace.NewDielectric(1.5))
-	ss = append(ss, trace.NewVolume(boundary, 0.0001, trace.NewIsotropic(trace.NewUniform(1, 1, 1))))
-	f, err := os.Open("images/earthmap.jpg")
-	if err != nil {
-		panic(err)
+	return t, nil
+}
+
+// parseAOVs parses a comma-separated list of AOV names.
+func parseAOVs(list string) (as []trace.AOV, err error) {
+	if list == "" {
+		return nil, nil
+	}
+	for _, name := range strings.Split(list, ",") {
+		a, err := trace.ParseAOV(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// checkLayers returns an error if any of the AOVs as can't be written faithfully in format f.
+func checkLayers(f trace.Format, as []trace.AOV) error {
+	if f == trace.EXR || f == trace.PFM {
+		return nil
+	}
+	for _, a := range as {
+		if a.Data() {
+			return fmt.Errorf("the %s AOV needs a pfm or exr format, since %s would clamp its values", a, f)
+		}
+	}
+	return nil
+}
+
+// writeFrame encodes frame to path (or stdout if path is empty) in format f,
+// along with its AOV layers if f can't hold them itself.
+func writeFrame(path string, f trace.Format, frame *trace.Frame) error {
+	dst := os.Stdout
+	if path != "" {
+		var err error
+		if dst, err = os.Create(path); err != nil {
+			return err
+		}
+		defer dst.Close()
+	}
+	if err := frame.Encode(dst, f); err != nil {
+		return err
+	}
+	if f == trace.EXR {
+		return nil
 	}
-	earth, err := trace.NewImage(f)
+	for _, a := range frame.AOVs() {
+		if path == "" {
+			return fmt.Errorf("%s AOV needs an output file or the exr format", a)
+		}
+		if err := writeLayer(path, f, frame, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLayer writes AOV a of frame to its own image next to path,
+// so a depth layer for "out.png" is written to "out.depth.png".
+func writeLayer(path string, f trace.Format, frame *trace.Frame, a trace.AOV) error {
+	if err := checkLayers(f, []trace.AOV{a}); err != nil {
+		return err
+	}
+	ext := filepath.Ext(path)
+	dst, err := os.Create(strings.TrimSuffix(path, ext) + "." + a.String() + ext)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	ss = append(ss, trace.NewSphere(geom.Vec{400, 200, 400}, 100, trace.NewLambert(earth)))
-	perlin := trace.NewNoise(0.1, 0.1, 0)
-	ss = append(ss, trace.NewSphere(geom.Vec{220, 280, 300}, 80, trace.NewLambert(perlin)))
-	var ss2 []trace.Surface
-	for j := 0; j < ns; j++ {
-		ss2 = append(ss2, trace.NewSphere(geom.Vec{165 * rand.Float64(), 165 * rand.Float64(), 165 * rand.Float64()}, 10, white))
+	defer dst.Close()
+	return frame.Layer(a).Encode(dst, f)
+}
+
+// printProgress reports render progress on a single, updating line of stderr.
+func printProgress(p trace.Progress) {
+	fmt.Fprint(os.Stderr, "\r"+formatProgress(p))
+}
+
+// formatProgress describes render progress on one line.
+func formatProgress(p trace.Progress) string {
+	done := fmt.Sprintf("%d tiles", p.Done)
+	if p.Total > 0 {
+		done = fmt.Sprintf("%5.1f%%", 100*float64(p.Done)/float64(p.Total))
 	}
-	ss = append(ss, trace.NewTranslate(trace.NewRotateY(trace.NewBVH(0, 1, ss2...), 15), geom.Vec{-100, 270, 395}))
+	return fmt.Sprintf("%s %d samples, %v elapsed, %v remaining  ",
+		done, p.Samples, p.Elapsed.Round(time.Second), p.Remaining.Round(time.Second))
+}
 
-	from := geom.Vec{478, 278, -600}
-	at := geom.Vec{278, 278, 0}
-	focus := 10.0
-	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
-	return cam, trace.NewBVH(0, 1, ss...)
+// previewTiles returns a TileDone callback that redraws the render in the terminal,
+// tone mapped by tone, at most a few times a second.
+func previewTiles(pv *preview.Preview, tone trace.Tone) func(image.Rectangle, *trace.Frame) {
+	var last time.Time
+	return func(_ image.Rectangle, f *trace.Frame) {
+		if time.Since(last) < 250*time.Millisecond {
+			return
+		}
+		f.SetTone(tone)
+		pv.Draw(f)
+		last = time.Now()
+	}
 }
 
-func cornellSmoke() (*trace.Camera, *trace.List) {
-	green := trace.NewLambert(trace.NewUniform(0.12, 0.45, 0.15))
-	red := trace.NewLambert(trace.NewUniform(0.65, 0.05, 0.05))
-	light := trace.NewLight(trace.NewUniform(7, 7, 7))
-	white := trace.NewLambert(trace.NewUniform(0.73, 0.73, 0.73))
-	smoke := trace.NewIsotropic(trace.NewUniform(0, 0, 0))
-	fog := trace.NewIsotropic(trace.NewUniform(1, 1, 1))
-	b1 := trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 165, 165}, white), -18), geom.Vec{130, 0, 65})
-	b2 := trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 330, 165}, white), 15), geom.Vec{265, 0, 295})
-	from := geom.Vec{278, 278, -800}
-	at := geom.Vec{278, 278, 0}
-	focus := 10.0
-	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
-	return cam, trace.NewList(
-		trace.NewFlip(trace.NewRect(geom.Vec{555, 0, 0}, geom.Vec{555, 555, 555}, green)),
-		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{0, 555, 555}, red),
-		trace.NewRect(geom.Vec{113, 554, 127}, geom.Vec{443, 554, 432}, light),
-		trace.NewFlip(trace.NewRect(geom.Vec{0, 555, 0}, geom.Vec{555, 555, 555}, white)),
-		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{555, 0, 555}, white),
-		trace.NewFlip(trace.NewRect(geom.Vec{0, 0, 555}, geom.Vec{555, 555, 555}, white)),
-		trace.NewVolume(b1, 0.01, fog),
-		trace.NewVolume(b2, 0.01, smoke),
-	)
+// loadCheckpoint reads the checkpoint at path.
+// It returns a nil Frame if path is empty or doesn't exist yet.
+func loadCheckpoint(path string) (*trace.Frame, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return trace.ReadCheckpoint(f)
 }
 
-func cornell() (*trace.Camera, *trace.List) {
-	green := trace.NewLambert(trace.NewUniform(0.12, 0.45, 0.15))
-	red := trace.NewLambert(trace.NewUniform(0.65, 0.05, 0.05))
-	light := trace.NewLight(trace.NewUniform(15, 15, 15))
-	white := trace.NewLambert(trace.NewUniform(0.73, 0.73, 0.73))
-	from := geom.Vec{278, 278, -800}
-	at := geom.Vec{278, 278, 0}
-	focus := 10.0
-	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
-	return cam, trace.NewList(
-		trace.NewFlip(trace.NewRect(geom.Vec{555, 0, 0}, geom.Vec{555, 555, 555}, green)),
-		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{0, 555, 555}, red),
-		trace.NewRect(geom.Vec{213, 554, 227}, geom.Vec{343, 554, 332}, light),
-		trace.NewFlip(trace.NewRect(geom.Vec{0, 555, 0}, geom.Vec{555, 555, 555}, white)),
-		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{555, 0, 555}, white),
-		trace.NewFlip(trace.NewRect(geom.Vec{0, 0, 555}, geom.Vec{555, 555, 555}, white)),
-		trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 165, 165}, white), -18), geom.Vec{130, 0, 65}),
-		trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 330, 165}, white), 15), geom.Vec{265, 0, 295}),
-	)
+// saveCheckpoint writes frame to path, replacing any previous checkpoint only once the new one is complete.
+func saveCheckpoint(path string, frame *trace.Frame) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := frame.WriteCheckpoint(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
 
-func simpleLight() (*trace.Camera, *trace.List) {
-	perlin := trace.NewNoise(4, 1, 2)
-	from := geom.Vec{25, 4, 6}
-	at := geom.Vec{0, 2, 0}
-	focus := 10.0
-	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 20, 0, focus, 0, 1)
-	return cam, trace.NewList(
-		trace.NewSphere(geom.Vec{0, -1000, 0}, 1000, trace.NewLambert(perlin)),
-		trace.NewSphere(geom.Vec{0, 2, 0}, 2, trace.NewLambert(perlin)),
-		trace.NewSphere(geom.Vec{0, 7, 0}, 2, trace.NewLight(trace.NewUniform(4, 4, 4))),
-		trace.NewRect(geom.Vec{3, 1, -2}, geom.Vec{5, 3, -2}, trace.NewLight(trace.NewUniform(4, 4, 4))),
-	)
+// outputFormat picks an explicitly named format, or the format matching path's extension.
+func outputFormat(path, name string) (trace.Format, error) {
+	if name != "" {
+		return trace.ParseFormat(name)
+	}
+	if path == "" {
+		return trace.PPM, nil
+	}
+	return trace.FormatOf(path)
 }
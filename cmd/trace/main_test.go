@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// TestAdaptiveSamples checks that adaptive sampling traces no more than -samples through any pixel,
+// even when its threshold is never met.
+func TestAdaptiveSamples(t *testing.T) {
+	sc, err := findScene("cornell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cam, s := sc.build()
+	opts := trace.RenderOptions{Seed: 1}
+	adaptive(&opts, 48, 1e-9, 0)
+	f, err := trace.NewWindow(16, 12).Render(context.Background(), cam, s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	most := 0
+	b := f.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if n := f.Pixel(x, y).Samples; n > most {
+				most = n
+			}
+		}
+	}
+	if most != 48 {
+		t.Fatalf("got at most %d samples per pixel, want 48", most)
+	}
+}
+
+// TestDataLayers checks that data AOVs round-trip through a pfm layer,
+// including the negative values that an 8-bit format would clamp.
+func TestDataLayers(t *testing.T) {
+	for _, f := range []trace.Format{trace.PNG, trace.JPEG, trace.PPM, trace.HDR} {
+		if err := checkLayers(f, []trace.AOV{trace.AOVDepth}); err == nil {
+			t.Errorf("%s accepted the depth AOV", f)
+		}
+	}
+	if err := checkLayers(trace.PNG, []trace.AOV{trace.AOVAlbedo}); err != nil {
+		t.Errorf("png refused the albedo AOV: %v", err)
+	}
+
+	// a wall facing the camera, 2 units away along -z.
+	wall := trace.NewRect(geom.Vec{-10, -10, -2}, geom.Vec{10, 10, -2}, trace.NewLambert(trace.NewUniform(0.5, 0.5, 0.5)))
+	cam := trace.NewCamera(geom.Vec{0, 0, 0}, geom.Vec{0, 0, -1}, geom.Vec{0, 1, 0}.Unit(), 40, 0, 1, 0, 0)
+	opts := trace.RenderOptions{Samples: 4, Seed: 1, AOVs: []trace.AOV{trace.AOVDepth, trace.AOVNormal, trace.AOVPosition}}
+	frame, err := trace.NewWindow(4, 3).Render(context.Background(), cam, wall, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out.pfm")
+	if err := writeFrame(out, trace.PFM, frame); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range opts.AOVs {
+		layer := readPFM(t, filepath.Join(filepath.Dir(out), "out."+a.String()+".pfm"))
+		b := frame.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				want := frame.AOV(a, x, y)
+				got := layer[y-b.Min.Y][x-b.Min.X]
+				for i := range want {
+					if math.Abs(got[i]-want[i]) > 1e-6*math.Max(1, math.Abs(want[i])) {
+						t.Fatalf("%s at %d,%d: got %v, want %v", a, x, y, got, want)
+					}
+				}
+			}
+		}
+		switch a {
+		case trace.AOVNormal:
+			if got := layer[1][2]; got != [3]float64{0, 0, 1} {
+				t.Errorf("normal: got %v, want 0,0,1", got)
+			}
+		case trace.AOVPosition:
+			if got := layer[1][2][2]; math.Abs(got+2) > 1e-6 {
+				t.Errorf("position z: got %v, want -2", got)
+			}
+		}
+	}
+}
+
+// readPFM reads a little-endian Portable Float Map into rows of colors, from the top.
+func readPFM(t *testing.T, path string) [][][3]float64 {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var width, height int
+	var scale float64
+	n, err := fmt.Sscanf(string(b), "PF\n%d %d\n%g\n", &width, &height, &scale)
+	if n != 3 || scale >= 0 {
+		t.Fatalf("bad pfm header in %s: %v", path, err)
+	}
+	data := b[len(b)-width*height*12:]
+	rows := make([][][3]float64, height)
+	for y := range rows {
+		rows[y] = make([][3]float64, width)
+		// pfm rows run from the bottom up.
+		row := data[(height-1-y)*width*12:]
+		for x := range rows[y] {
+			for i := 0; i < 3; i++ {
+				rows[y][x][i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(row[x*12+i*4:])))
+			}
+		}
+	}
+	return rows
+}
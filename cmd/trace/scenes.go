@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/gltf"
+	scenefile "github.com/hunterloftis/oneweekend/pkg/scene"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// scene is a built-in scene that can be chosen with -scene.
+type scene struct {
+	name  string
+	about string
+	build func() (*trace.Camera, trace.Surface)
+}
+
+// scenes lists the built-in scenes.
+var scenes = []scene{
+	{"final", "the cover of The Next Week: every feature in one scene", final},
+	{"custom", "a variation on final with a glowing, metallic earth", custom},
+	{"cornell", "the Cornell box with two rotated blocks", cornell},
+	{"cornellSmoke", "the Cornell box with blocks of smoke and fog", cornellSmoke},
+	{"simpleLight", "Perlin-textured spheres lit by a sphere and a rectangle", simpleLight},
+	{"spheres", "the cover of In One Weekend, with nearly two thousand random spheres", spheres},
+}
+
+// findScene returns the built-in scene with the given name,
+// or loads the scene file at name if it ends in ".json", ".gltf", or ".glb".
+func findScene(name string) (scene, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gltf", ".glb":
+		s, err := gltf.Load(name, gltf.Options{})
+		if err != nil {
+			return scene{}, err
+		}
+		return scene{name: name, build: func() (*trace.Camera, trace.Surface) {
+			return s.Camera(), s.Surface
+		}}, nil
+	case ".json":
+		s, err := scenefile.Load(name)
+		if err != nil {
+			return scene{}, err
+		}
+		return scene{name: name, build: func() (*trace.Camera, trace.Surface) {
+			return s.Camera, s.Surface
+		}}, nil
+	}
+	for _, s := range scenes {
+		if strings.EqualFold(s.name, name) {
+			return s, nil
+		}
+	}
+	return scene{}, fmt.Errorf("unknown scene %q (try -list-scenes)", name)
+}
+
+// listScenes prints the names and descriptions of the built-in scenes.
+func listScenes() {
+	for _, s := range scenes {
+		fmt.Printf("%-14s %s\n", s.name, s.about)
+	}
+}
+
+func custom() (*trace.Camera, trace.Surface) {
+	rnd := rand.New(rand.NewSource(10))
+	nb := 20
+	w := 100.0
+	var ss []trace.Surface
+	ground := trace.NewLambert(trace.NewUniform(0.48, 0.83, 0.53))
+	light := trace.NewLight(trace.NewUniform(1, 1, 1))
+	for i := 0; i < nb; i++ {
+		for j := 0; j < nb; j++ {
+			min := geom.Vec{-1000 + float64(i)*w, 0, -1000 + float64(j)*w}
+			max := geom.Vec{w, 1 + 99*rnd.Float64(), w}.Plus(min)
+			ss = append(ss, trace.NewBox(min, max, ground))
+		}
+	}
+	ss = append(ss, trace.NewRect(geom.Vec{123, 554, 147}, geom.Vec{423, 554, 412}, light))
+	center := geom.Vec{400, 400, 200}
+	ss = append(ss, trace.NewMovingSphere(center, center.Plus(geom.Vec{30, 0, 0}), 0, 1, 50, trace.NewLambert(trace.NewUniform(0.7, 0.3, 0.1))))
+	ss = append(ss, trace.NewSphere(geom.Vec{260, 150, 45}, 50, trace.NewDielectric(1.5)))
+	boundary := trace.NewSphere(geom.Vec{0, 0, 0}, 5000, trace.NewDielectric(1.5))
+	ss = append(ss, trace.NewVolume(boundary, 0.0001, trace.NewIsotropic(trace.NewUniform(1, 1, 1))))
+	f, err := os.Open("images/earthmap.jpg")
+	if err != nil {
+		panic(err)
+	}
+	earth, err := trace.NewImage(f)
+	if err != nil {
+		panic(err)
+	}
+	ss = append(ss, trace.NewSphere(geom.Vec{100, 150, 100}, 50, trace.NewMetal(trace.NewBright(earth, 1.5), 0.1)))
+	ss = append(ss, trace.NewSphere(geom.Vec{400, 200, 400}, 100, trace.NewLight(trace.NewBright(earth, 3))))
+	perlin := trace.NewNoise(0.1, 0.1, 0)
+	ss = append(ss, trace.NewSphere(geom.Vec{220, 280, 300}, 80, trace.NewLambert(perlin)))
+
+	from := geom.Vec{478, 278, -600}
+	at := geom.Vec{278, 278, 0}
+	focus := 10.0
+	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
+	return cam, trace.NewBVH(0, 1, ss...)
+}
+
+func final() (*trace.Camera, trace.Surface) {
+	rnd := rand.New(rand.NewSource(10))
+	nb := 20
+	w := 100.0
+	ns := 1000
+	var ss []trace.Surface
+	white := trace.NewLambert(trace.NewUniform(0.73, 0.73, 0.73))
+	ground := trace.NewLambert(trace.NewUniform(0.48, 0.83, 0.53))
+	light := trace.NewLight(trace.NewUniform(7, 7, 7))
+	for i := 0; i < nb; i++ {
+		for j := 0; j < nb; j++ {
+			min := geom.Vec{-1000 + float64(i)*w, 0, -1000 + float64(j)*w}
+			max := geom.Vec{w, 1 + 99*rnd.Float64(), w}.Plus(min)
+			ss = append(ss, trace.NewBox(min, max, ground))
+		}
+	}
+	ss = append(ss, trace.NewRect(geom.Vec{123, 554, 147}, geom.Vec{423, 554, 412}, light))
+	center := geom.Vec{400, 400, 200}
+	ss = append(ss, trace.NewMovingSphere(center, center.Plus(geom.Vec{30, 0, 0}), 0, 1, 50, trace.NewLambert(trace.NewUniform(0.7, 0.3, 0.1))))
+	ss = append(ss, trace.NewSphere(geom.Vec{260, 150, 45}, 50, trace.NewDielectric(1.5)))
+	ss = append(ss, trace.NewSphere(geom.Vec{0, 150, 145}, 50, trace.NewMetal(trace.NewUniform(0.8, 0.8, 0.9), 1)))
+	boundary := trace.NewSphere(geom.Vec{360, 150, 145}, 70, trace.NewDielectric(1.5))
+	ss = append(ss, boundary)
+	ss = append(ss, trace.NewVolume(boundary, 0.2, trace.NewIsotropic(trace.NewUniform(0.2, 0.4, 0.9))))
+	boundary = trace.NewSphere(geom.Vec{0, 0, 0}, 5000, trace.NewDielectric(1.5))
+	ss = append(ss, trace.NewVolume(boundary, 0.0001, trace.NewIsotropic(trace.NewUniform(1, 1, 1))))
+	f, err := os.Open("images/earthmap.jpg")
+	if err != nil {
+		panic(err)
+	}
+	earth, err := trace.NewImage(f)
+	if err != nil {
+		panic(err)
+	}
+	ss = append(ss, trace.NewSphere(geom.Vec{400, 200, 400}, 100, trace.NewLambert(earth)))
+	perlin := trace.NewNoise(0.1, 0.1, 0)
+	ss = append(ss, trace.NewSphere(geom.Vec{220, 280, 300}, 80, trace.NewLambert(perlin)))
+	var ss2 []trace.Surface
+	for j := 0; j < ns; j++ {
+		ss2 = append(ss2, trace.NewSphere(geom.Vec{165 * rnd.Float64(), 165 * rnd.Float64(), 165 * rnd.Float64()}, 10, white))
+	}
+	ss = append(ss, trace.NewTranslate(trace.NewRotateY(trace.NewBVH(0, 1, ss2...), 15), geom.Vec{-100, 270, 395}))
+
+	from := geom.Vec{478, 278, -600}
+	at := geom.Vec{278, 278, 0}
+	focus := 10.0
+	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
+	return cam, trace.NewBVH(0, 1, ss...)
+}
+
+func cornellSmoke() (*trace.Camera, trace.Surface) {
+	green := trace.NewLambert(trace.NewUniform(0.12, 0.45, 0.15))
+	red := trace.NewLambert(trace.NewUniform(0.65, 0.05, 0.05))
+	light := trace.NewLight(trace.NewUniform(7, 7, 7))
+	white := trace.NewLambert(trace.NewUniform(0.73, 0.73, 0.73))
+	smoke := trace.NewIsotropic(trace.NewUniform(0, 0, 0))
+	fog := trace.NewIsotropic(trace.NewUniform(1, 1, 1))
+	b1 := trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 165, 165}, white), -18), geom.Vec{130, 0, 65})
+	b2 := trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 330, 165}, white), 15), geom.Vec{265, 0, 295})
+	from := geom.Vec{278, 278, -800}
+	at := geom.Vec{278, 278, 0}
+	focus := 10.0
+	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
+	return cam, trace.NewList(
+		trace.NewFlip(trace.NewRect(geom.Vec{555, 0, 0}, geom.Vec{555, 555, 555}, green)),
+		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{0, 555, 555}, red),
+		trace.NewRect(geom.Vec{113, 554, 127}, geom.Vec{443, 554, 432}, light),
+		trace.NewFlip(trace.NewRect(geom.Vec{0, 555, 0}, geom.Vec{555, 555, 555}, white)),
+		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{555, 0, 555}, white),
+		trace.NewFlip(trace.NewRect(geom.Vec{0, 0, 555}, geom.Vec{555, 555, 555}, white)),
+		trace.NewVolume(b1, 0.01, fog),
+		trace.NewVolume(b2, 0.01, smoke),
+	)
+}
+
+func cornell() (*trace.Camera, trace.Surface) {
+	green := trace.NewLambert(trace.NewUniform(0.12, 0.45, 0.15))
+	red := trace.NewLambert(trace.NewUniform(0.65, 0.05, 0.05))
+	light := trace.NewLight(trace.NewUniform(15, 15, 15))
+	white := trace.NewLambert(trace.NewUniform(0.73, 0.73, 0.73))
+	from := geom.Vec{278, 278, -800}
+	at := geom.Vec{278, 278, 0}
+	focus := 10.0
+	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 40, 0, focus, 0, 1)
+	return cam, trace.NewList(
+		trace.NewFlip(trace.NewRect(geom.Vec{555, 0, 0}, geom.Vec{555, 555, 555}, green)),
+		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{0, 555, 555}, red),
+		trace.NewRect(geom.Vec{213, 554, 227}, geom.Vec{343, 554, 332}, light),
+		trace.NewFlip(trace.NewRect(geom.Vec{0, 555, 0}, geom.Vec{555, 555, 555}, white)),
+		trace.NewRect(geom.Vec{0, 0, 0}, geom.Vec{555, 0, 555}, white),
+		trace.NewFlip(trace.NewRect(geom.Vec{0, 0, 555}, geom.Vec{555, 555, 555}, white)),
+		trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 165, 165}, white), -18), geom.Vec{130, 0, 65}),
+		trace.NewTranslate(trace.NewRotateY(trace.NewBox(geom.Vec{0, 0, 0}, geom.Vec{165, 330, 165}, white), 15), geom.Vec{265, 0, 295}),
+	)
+}
+
+func simpleLight() (*trace.Camera, trace.Surface) {
+	perlin := trace.NewNoise(4, 1, 2)
+	from := geom.Vec{25, 4, 6}
+	at := geom.Vec{0, 2, 0}
+	focus := 10.0
+	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 20, 0, focus, 0, 1)
+	return cam, trace.NewList(
+		trace.NewSphere(geom.Vec{0, -1000, 0}, 1000, trace.NewLambert(perlin)),
+		trace.NewSphere(geom.Vec{0, 2, 0}, 2, trace.NewLambert(perlin)),
+		trace.NewSphere(geom.Vec{0, 7, 0}, 2, trace.NewLight(trace.NewUniform(4, 4, 4))),
+		trace.NewRect(geom.Vec{3, 1, -2}, geom.Vec{5, 3, -2}, trace.NewLight(trace.NewUniform(4, 4, 4))),
+	)
+}
+
+func spheres() (*trace.Camera, trace.Surface) {
+	rnd := rand.New(rand.NewSource(10))
+	n := 22
+	var ss []trace.Surface
+	ss = append(ss, trace.NewSphere(geom.Vec{0, -1000, 0}, 1000, trace.NewLambert(trace.NewUniform(0.5, 0.5, 0.5))))
+	for a := -n; a < n; a++ {
+		for b := -n; b < n; b++ {
+			center := geom.Vec{float64(a) + 0.9*rnd.Float64(), 0.2, float64(b) + 0.9*rnd.Float64()}
+			if center.Minus(geom.Vec{4, 0.2, 0}).Len() <= 0.9 {
+				continue
+			}
+			switch m := rnd.Float64(); {
+			case m < 0.8:
+				c := trace.NewUniform(rnd.Float64()*rnd.Float64(), rnd.Float64()*rnd.Float64(), rnd.Float64()*rnd.Float64())
+				ss = append(ss, trace.NewSphere(center, 0.2, trace.NewLambert(c)))
+			case m < 0.95:
+				c := trace.NewUniform(0.5*(1+rnd.Float64()), 0.5*(1+rnd.Float64()), 0.5*(1+rnd.Float64()))
+				ss = append(ss, trace.NewSphere(center, 0.2, trace.NewMetal(c, 0.5*rnd.Float64())))
+			default:
+				ss = append(ss, trace.NewSphere(center, 0.2, trace.NewDielectric(1.5)))
+			}
+		}
+	}
+	ss = append(ss, trace.NewSphere(geom.Vec{0, 1, 0}, 1, trace.NewDielectric(1.5)))
+	ss = append(ss, trace.NewSphere(geom.Vec{-4, 1, 0}, 1, trace.NewLambert(trace.NewUniform(0.4, 0.2, 0.1))))
+	ss = append(ss, trace.NewSphere(geom.Vec{4, 1, 0}, 1, trace.NewMetal(trace.NewUniform(0.7, 0.6, 0.5), 0)))
+	// the book's sky, as a glowing sphere around the whole scene.
+	ss = append(ss, trace.NewSphere(geom.Vec{0, 0, 0}, 5000, trace.NewLight(trace.NewUniform(0.75, 0.85, 1))))
+
+	from := geom.Vec{13, 2, 3}
+	at := geom.Vec{0, 0, 0}
+	focus := 10.0
+	cam := trace.NewCamera(from, at, geom.Unit{0, 1, 0}, 20, 0.1, focus, 0, 1)
+	return cam, trace.NewBVH(0, 1, ss...)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+	"github.com/hunterloftis/oneweekend/pkg/trace/tracetest"
+)
+
+// golden is how far a render of a built-in scene may stray from its golden image.
+// Renders with the same seed are identical, but tiny differences in floating-point results,
+// as between CPU architectures, can send some paths in new directions.
+// Comparing blocks of 4x4 pixels lets those scattered differences pass,
+// while a change that darkens or lightens the whole image by a few percent doesn't.
+var golden = tracetest.Tolerance{Downsample: 4, RMSE: 0.006, SSIM: 0.99}
+
+func TestScenes(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the built-in scenes load their textures relative to the root of the repository.
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, sc := range scenes {
+		sc := sc
+		t.Run(sc.name, func(t *testing.T) {
+			cam, s := sc.build()
+			f, err := trace.NewWindow(64, 48).Render(context.Background(), cam, s, trace.RenderOptions{Samples: 16, Seed: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tracetest.Golden(t, filepath.Join(wd, "testdata", sc.name+".png"), f, golden)
+		})
+	}
+}
+
+// TestScenesDeterministic checks that each built-in scene is built the same way every time,
+// and that its renders depend only on their seed, not on how many workers trace them.
+func TestScenesDeterministic(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, sc := range scenes {
+		sc := sc
+		t.Run(sc.name, func(t *testing.T) {
+			var frames [2]*trace.Frame
+			for i, workers := range []int{1, 5} {
+				cam, s := sc.build()
+				// a filter spreads samples across tile edges, where workers' tiles meet.
+				filter, err := trace.ParseFilter("gaussian")
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts := trace.RenderOptions{Samples: 4, Seed: 7, Workers: workers, TileSize: 8, Filter: filter}
+				f, err := trace.NewWindow(32, 24).Render(context.Background(), cam, s, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				frames[i] = f
+			}
+			b := frames[0].Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if p0, p1 := frames[0].Pixel(x, y), frames[1].Pixel(x, y); p0 != p1 {
+						t.Fatalf("pixel %d, %d differs between renders with 1 and 5 workers: %v and %v", x, y, p0, p1)
+					}
+				}
+			}
+		})
+	}
+}
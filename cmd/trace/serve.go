@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/hunterloftis/oneweekend/pkg/server"
+)
+
+// serve runs a render server until it's interrupted.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("trace serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	root := fs.String("root", ".", "directory that scene files are loaded from; scenes can't use files outside of it")
+	concurrent := fs.Int("jobs", 1, "number of jobs to render at once")
+	queue := fs.Int("queue", 100, "most jobs that may wait to render")
+	keep := fs.Int("keep", 20, "most finished jobs to remember, with their images")
+	workers := fs.Int("workers", 0, "goroutines tracing each job (default: CPUs divided among -jobs)")
+	fs.Parse(args)
+
+	s := server.New(server.Config{Root: *root, Concurrent: *concurrent, Queue: *queue, Keep: *keep, Workers: *workers})
+	defer s.Close()
+	hs := &http.Server{Addr: *addr, Handler: s}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		hs.Shutdown(context.Background())
+	}()
+	fmt.Fprintf(os.Stderr, "serving on http://%s\n", *addr)
+	if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
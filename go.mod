@@ -1,3 +1,5 @@
 module github.com/hunterloftis/oneweekend
 
+go 1.16
+
 require github.com/pkg/profile v1.2.1
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// TestCluster checks that a render split among workers, one of which dies while holding a lease,
+// is identical to a local render.
+func TestCluster(t *testing.T) {
+	job := Job{Scene: "spheres", Width: 32, Height: 24, Samples: 2, Passes: 2, Seed: 3, Filter: "gaussian", AOVs: []string{"depth", "id"}, TileSize: 8}
+	load := func(Job) (*trace.Camera, trace.Surface, error) {
+		cam := trace.NewCamera(geom.Vec{0, 1, 5}, geom.Vec{0, 0, 0}, geom.Vec{0, 1, 0}.Unit(), 40, 0, 5, 0, 1)
+		s := trace.NewBVH(0, 1,
+			trace.NewSphere(geom.Vec{0, -100, 0}, 99.5, trace.NewLambert(trace.NewUniform(0.5, 0.5, 0.5))),
+			trace.NewSphere(geom.Vec{-0.6, 0, 0}, 0.5, trace.NewLambert(trace.NewUniform(0.8, 0.3, 0.3))),
+			trace.NewSphere(geom.Vec{0.6, 0, 0}, 0.5, trace.NewLight(trace.NewUniform(4, 4, 4))),
+		)
+		return cam, s, nil
+	}
+
+	c, err := NewCoordinator(job, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	// a worker that leases the first tile and dies without returning it.
+	res, err := http.Post(srv.URL+"/lease", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("leasing a tile: got %s", res.Status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- Work(ctx, srv.URL, 2, load) }()
+	}
+	got, err := c.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("worker: %v", err)
+		}
+	}
+
+	opts, err := job.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cam, s, _ := load(job)
+	want, err := trace.NewWindow(job.Width, job.Height).Render(context.Background(), cam, s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := want.Bounds()
+	if got.Bounds() != b {
+		t.Fatalf("got bounds %v, want %v", got.Bounds(), b)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if g, w := got.Pixel(x, y), want.Pixel(x, y); g != w {
+				t.Fatalf("pixel %d,%d: got %+v, want %+v", x, y, g, w)
+			}
+			for _, a := range []trace.AOV{trace.AOVDepth, trace.AOVID} {
+				if g, w := got.AOV(a, x, y), want.AOV(a, x, y); g != w {
+					t.Fatalf("%s at %d,%d: got %v, want %v", a, x, y, g, w)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Coordinator splits a render into tiles and merges the tiles that workers return.
+// It implements http.Handler.
+type Coordinator struct {
+	// Progress, if non-nil, is called after each tile is merged into the frame.
+	Progress func(trace.Progress)
+
+	job    Job
+	frame  *trace.Frame
+	tiles  []image.Rectangle
+	passes int
+	lease  time.Duration
+	start  time.Time
+	done   chan struct{}
+
+	mu       sync.Mutex
+	pass     int
+	cursor   int                  // the next tile of the pass to merge
+	expires  []time.Time          // when each tile's lease expires; zero if it isn't leased
+	results  map[int]*trace.Frame // returned tiles waiting to be merged in order
+	progress trace.Progress
+	stopped  bool
+}
+
+// NewCoordinator returns a Coordinator for job.
+// Tiles that aren't returned within lease of being leased are leased again.
+func NewCoordinator(job Job, lease time.Duration) (*Coordinator, error) {
+	opts, err := job.Options()
+	if err != nil {
+		return nil, err
+	}
+	w := trace.NewWindow(job.Width, job.Height)
+	c := &Coordinator{
+		job:     job,
+		frame:   w.Frame(opts),
+		passes:  job.passes(),
+		lease:   lease,
+		start:   time.Now(),
+		done:    make(chan struct{}),
+		results: make(map[int]*trace.Frame),
+	}
+	c.tiles = w.Tiles(c.frame, opts)
+	c.expires = make([]time.Time, len(c.tiles))
+	c.progress.Total = len(c.tiles) * c.passes
+	return c, nil
+}
+
+// Wait waits for the render to complete and returns its frame.
+// If ctx is cancelled first, Wait stops accepting tiles
+// and returns the partially-rendered frame along with ctx's error.
+func (c *Coordinator) Wait(ctx context.Context) (*trace.Frame, error) {
+	select {
+	case <-c.done:
+		return c.frame, nil
+	case <-ctx.Done():
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	return c.frame, ctx.Err()
+}
+
+// finished reports whether the coordinator has no more tiles to lease.
+// c.mu must be held.
+func (c *Coordinator) finished() bool {
+	return c.stopped || c.pass >= c.passes
+}
+
+// ServeHTTP serves the job, leases, and results to workers.
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/job" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.job)
+	case r.URL.Path == "/lease" && r.Method == http.MethodPost:
+		c.serveLease(w)
+	case r.URL.Path == "/result" && r.Method == http.MethodPost:
+		c.serveResult(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveLease leases the first tile of the current pass that isn't leased,
+// or whose lease has expired.
+func (c *Coordinator) serveLease(w http.ResponseWriter) {
+	c.mu.Lock()
+	if c.finished() {
+		c.mu.Unlock()
+		http.Error(w, "render is complete", http.StatusGone)
+		return
+	}
+	now := time.Now()
+	index := -1
+	for i := c.cursor; i < len(c.tiles); i++ {
+		if c.results[i] == nil && now.After(c.expires[i]) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		c.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	c.expires[index] = now.Add(c.lease)
+	prior := c.frame.Crop(c.tiles[index])
+	id := leaseID(c.pass, index)
+	c.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := prior.WriteCheckpoint(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Lease", id)
+	buf.WriteTo(w)
+}
+
+// serveResult accepts a leased tile's samples, and merges every tile that's ready.
+// Results for tiles that another worker has already returned are ignored.
+func (c *Coordinator) serveResult(w http.ResponseWriter, r *http.Request) {
+	pass, index, err := parseLeaseID(r.URL.Query().Get("lease"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tile, err := trace.ReadCheckpoint(io.LimitReader(r.Body, 1<<30))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading tile: %v", err), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.finished() || pass != c.pass || index < c.cursor || c.results[index] != nil {
+		http.Error(w, "tile has already been returned", http.StatusConflict)
+		return
+	}
+	if index >= len(c.tiles) || !c.tiles[index].In(tile.Bounds()) || !tile.Bounds().In(c.frame.Bounds()) {
+		http.Error(w, "tile doesn't match its lease", http.StatusBadRequest)
+		return
+	}
+	c.results[index] = tile
+	c.merge()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// merge merges returned tiles into the frame in order, starting a new pass after the last tile.
+// Filtered tiles overlap their neighbors,
+// so a consistent order keeps the sums of overlapping pixels identical to a local render's.
+// c.mu must be held.
+func (c *Coordinator) merge() {
+	for c.results[c.cursor] != nil {
+		tile := c.results[c.cursor]
+		delete(c.results, c.cursor)
+		c.frame.Merge(tile)
+		c.cursor++
+		c.progress.Done++
+		c.progress.Samples += tile.Samples()
+		if c.Progress != nil {
+			p := &c.progress
+			p.Elapsed = time.Since(c.start)
+			p.Remaining = p.Elapsed * time.Duration(p.Total-p.Done) / time.Duration(p.Done)
+			c.Progress(*p)
+		}
+	}
+	if c.cursor < len(c.tiles) {
+		return
+	}
+	c.pass++
+	c.cursor = 0
+	c.expires = make([]time.Time, len(c.tiles))
+	if c.pass == c.passes {
+		close(c.done)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Package cluster splits a render among worker processes.
+
+A Coordinator owns the render's frame and serves its tiles over HTTP, one pass at a time.
+Workers lease tiles, trace them with trace.Window.Tile, and return the new samples,
+which the coordinator merges in the same order as a local render would,
+so the result is identical to rendering on one machine with the same seed.
+
+Leases expire: if a worker dies, or is too slow,
+its tiles are leased again to other workers.
+
+The HTTP API is:
+
+	GET  /job           the Job being rendered, as JSON
+	POST /lease         lease a tile: responds with the tile's prior samples as a checkpoint
+	                    and its lease in the X-Lease header, 204 No Content if no tile is
+	                    available yet, or 410 Gone once the render is complete
+	POST /result?lease  return a leased tile's new samples as a checkpoint
+*/
+package cluster
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Job describes a render that a Coordinator splits among workers.
+type Job struct {
+	// Scene names the scene: a file path, or the name of a scene that every worker knows.
+	Scene string `json:"scene"`
+	// Source is the contents of the scene file, if the scene is a file,
+	// so that workers don't need their own copy.
+	Source []byte `json:"source,omitempty"`
+
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Samples is the number of samples per pixel in each of Passes passes.
+	Samples int   `json:"samples"`
+	Passes  int   `json:"passes"`
+	Seed    int64 `json:"seed"`
+	// Threshold enables adaptive sampling, as in trace.RenderOptions.
+	// It needs MaxSamples, which (with Samples) determines the number of passes.
+	Threshold  float64 `json:"threshold,omitempty"`
+	MinSamples int     `json:"minSamples,omitempty"`
+	MaxSamples int     `json:"maxSamples,omitempty"`
+	// Filter and AOVs are names as accepted by trace.ParseFilter and trace.ParseAOV.
+	Filter   string   `json:"filter,omitempty"`
+	AOVs     []string `json:"aovs,omitempty"`
+	TileSize int      `json:"tileSize,omitempty"`
+}
+
+// Options returns the render options for the job.
+func (j Job) Options() (opts trace.RenderOptions, err error) {
+	if j.Width < 1 || j.Height < 1 || j.Samples < 1 {
+		return opts, errors.New("width, height, and samples must be at least 1")
+	}
+	if j.Threshold > 0 && j.MaxSamples < 1 {
+		return opts, errors.New("adaptive sampling needs a maximum number of samples")
+	}
+	opts = trace.RenderOptions{
+		Samples:    j.Samples,
+		Passes:     j.Passes,
+		Threshold:  j.Threshold,
+		MinSamples: j.MinSamples,
+		MaxSamples: j.MaxSamples,
+		Seed:       j.Seed,
+		TileSize:   j.TileSize,
+	}
+	if j.Filter != "" {
+		if opts.Filter, err = trace.ParseFilter(j.Filter); err != nil {
+			return opts, err
+		}
+	}
+	for _, name := range j.AOVs {
+		a, err := trace.ParseAOV(name)
+		if err != nil {
+			return opts, err
+		}
+		opts.AOVs = append(opts.AOVs, a)
+	}
+	return opts, nil
+}
+
+// passes returns the number of passes the job takes.
+// With adaptive sampling, that's enough passes to reach MaxSamples;
+// converged pixels get no samples in the later passes.
+func (j Job) passes() int {
+	if j.Threshold > 0 && j.Passes <= 0 {
+		return (j.MaxSamples + j.Samples - 1) / j.Samples
+	}
+	if j.Passes <= 0 {
+		return 1
+	}
+	return j.Passes
+}
+
+// leaseID identifies a lease on tile index of pass.
+func leaseID(pass, index int) string {
+	return fmt.Sprintf("%d.%d", pass, index)
+}
+
+// parseLeaseID returns the pass and tile index of a lease.
+func parseLeaseID(id string) (pass, index int, err error) {
+	if _, err := fmt.Sscanf(id, "%d.%d", &pass, &index); err != nil {
+		return 0, 0, fmt.Errorf("invalid lease %q", id)
+	}
+	return pass, index, nil
+}
@@ -0,0 +1,152 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+const (
+	// poll is how long a worker waits before asking again when no tile is available.
+	poll = 200 * time.Millisecond
+	// patience is how long a worker keeps retrying when it can't reach the coordinator.
+	patience = 10 * time.Second
+	// timeout is how long a worker waits for each request to the coordinator,
+	// so that a coordinator that stops responding can't stall it.
+	timeout = 30 * time.Second
+)
+
+var client = &http.Client{Timeout: timeout}
+
+// Loader builds the camera and surface of the scene that a Job names.
+type Loader func(Job) (*trace.Camera, trace.Surface, error)
+
+// Work renders tiles for the coordinator at url until the coordinator's render is complete.
+// threads tiles are traced at once.
+func Work(ctx context.Context, url string, threads int, load Loader) error {
+	url = strings.TrimSuffix(url, "/")
+	var job Job
+	err := retry(ctx, func() error {
+		res, err := client.Get(url + "/job")
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("getting job: %s", res.Status)
+		}
+		return json.NewDecoder(res.Body).Decode(&job)
+	})
+	if err != nil {
+		return err
+	}
+	opts, err := job.Options()
+	if err != nil {
+		return err
+	}
+	cam, s, err := load(job)
+	if err != nil {
+		return err
+	}
+	w := trace.NewWindow(job.Width, job.Height)
+
+	if threads < 1 {
+		threads = 1
+	}
+	errs := make(chan error, threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			errs <- work(ctx, url, w, cam, s, opts)
+		}()
+	}
+	for i := 0; i < threads; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// work leases, traces, and returns tiles one at a time, until the render is complete.
+func work(ctx context.Context, url string, w *trace.Window, cam *trace.Camera, s trace.Surface, opts trace.RenderOptions) error {
+	for {
+		var prior *trace.Frame
+		var id string
+		done := false
+		err := retry(ctx, func() error {
+			res, err := client.Post(url+"/lease", "", nil)
+			if err != nil {
+				return err
+			}
+			defer res.Body.Close()
+			switch res.StatusCode {
+			case http.StatusOK:
+				id = res.Header.Get("X-Lease")
+				prior, err = trace.ReadCheckpoint(res.Body)
+				return err
+			case http.StatusNoContent:
+				prior = nil
+				return nil
+			case http.StatusGone:
+				done = true
+				return nil
+			}
+			return fmt.Errorf("leasing a tile: %s", res.Status)
+		})
+		if err != nil || done {
+			return err
+		}
+		if prior == nil {
+			if err := sleep(ctx, poll); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tile := w.Tile(ctx, prior, cam, s, opts)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var buf bytes.Buffer
+		if err := tile.WriteCheckpoint(&buf); err != nil {
+			return err
+		}
+		// if the result can't be delivered, the lease expires and the tile is leased again.
+		if res, err := client.Post(url+"/result?lease="+id, "application/octet-stream", &buf); err == nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+	}
+}
+
+// retry calls fn until it succeeds, giving up if it keeps failing for longer than patience.
+func retry(ctx context.Context, fn func() error) error {
+	start := time.Now()
+	for {
+		err := fn()
+		if err == nil || time.Since(start) > patience {
+			return err
+		}
+		if err := sleep(ctx, poll); err != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Package compare measures the differences between two images,
+like a new render and a reference render of the same scene.
+
+Images are compared by their 8-bit (or 16-bit) sRGB values,
+as they're displayed, scaled to the range 0-1.
+Besides the overall error (RMSE and PSNR) and structural similarity (SSIM),
+a Result has the relative error of each pixel, which HeatMap draws in false color.
+
+Renders are noisy, so two renders of the same scene with different seeds still differ.
+Downsample averages blocks of pixels before comparing,
+so that the comparison measures the difference between the renders' expected values
+more than the difference between their noise.
+*/
+package compare
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// epsilon keeps relative errors finite where the reference is black.
+const epsilon = 0.01
+
+// Result describes the differences between two images.
+type Result struct {
+	// Bounds is the rectangle of the images compared, relative to the first image.
+	Bounds image.Rectangle
+	// RMSE is the root-mean-square difference between the color channels of the images.
+	RMSE float64
+	// PSNR is the peak signal-to-noise ratio in decibels, or +Inf if the images are identical.
+	PSNR float64
+	// SSIM is the mean structural similarity of the images' luminance, from -1 to 1,
+	// where 1 means identical.
+	SSIM float64
+	// MeanRelative and MaxRelative are the mean and largest of the per-pixel relative errors.
+	MeanRelative float64
+	MaxRelative  float64
+	// Relative is the relative error of each pixel, row by row:
+	// the mean of |a - b| / (b + 0.01) over the pixel's channels, where b is the reference.
+	Relative []float64
+}
+
+// Images compares image a to reference image b, which must be the same size.
+func Images(a, b image.Image) (*Result, error) {
+	ra, rb := a.Bounds(), b.Bounds()
+	if ra.Dx() != rb.Dx() || ra.Dy() != rb.Dy() {
+		return nil, fmt.Errorf("images are different sizes: %dx%d and %dx%d", ra.Dx(), ra.Dy(), rb.Dx(), rb.Dy())
+	}
+	if ra.Empty() {
+		return nil, errors.New("images are empty")
+	}
+	pa, pb := values(a), values(b)
+	r := &Result{Bounds: ra, Relative: make([]float64, len(pa))}
+	var sumSq, sumRel float64
+	for i := range pa {
+		rel := 0.0
+		for c := 0; c < 3; c++ {
+			d := pa[i][c] - pb[i][c]
+			sumSq += d * d
+			rel += math.Abs(d) / (pb[i][c] + epsilon) / 3
+		}
+		r.Relative[i] = rel
+		sumRel += rel
+		r.MaxRelative = math.Max(r.MaxRelative, rel)
+	}
+	r.MeanRelative = sumRel / float64(len(pa))
+	r.RMSE = math.Sqrt(sumSq / float64(3*len(pa)))
+	r.PSNR = 20 * math.Log10(1/r.RMSE)
+	r.SSIM = ssim(luma(pa), luma(pb), ra.Dx(), ra.Dy())
+	return r, nil
+}
+
+// String summarizes the result on one line.
+func (r *Result) String() string {
+	return fmt.Sprintf("rmse %.5f, psnr %.2f dB, ssim %.5f, relative error %.5f mean, %.5f max",
+		r.RMSE, r.PSNR, r.SSIM, r.MeanRelative, r.MaxRelative)
+}
+
+// values returns the color channels of each pixel of im, row by row, from 0 to 1.
+func values(im image.Image) [][3]float64 {
+	b := im.Bounds()
+	v := make([][3]float64, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := im.At(x, y).RGBA()
+			v = append(v, [3]float64{float64(r) / 0xffff, float64(g) / 0xffff, float64(bl) / 0xffff})
+		}
+	}
+	return v
+}
+
+// luma returns the Rec. 709 luminance of each pixel in v.
+func luma(v [][3]float64) []float64 {
+	l := make([]float64, len(v))
+	for i, c := range v {
+		l[i] = 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+	}
+	return l
+}
+
+// ssim returns the mean structural similarity of width x height luminance images a and b,
+// measured in 8x8 windows that overlap by half.
+// Images smaller than a window are measured as a single window.
+func ssim(a, b []float64, width, height int) float64 {
+	const (
+		c1 = 0.01 * 0.01
+		c2 = 0.03 * 0.03
+	)
+	size, step := 8, 4
+	ww, wh := size, size
+	if width < size {
+		ww = width
+	}
+	if height < size {
+		wh = height
+	}
+	var sum float64
+	var n int
+	for y0 := 0; y0+wh <= height; y0 += step {
+		for x0 := 0; x0+ww <= width; x0 += step {
+			var ma, mb, va, vb, cov float64
+			for y := y0; y < y0+wh; y++ {
+				for x := x0; x < x0+ww; x++ {
+					ma += a[y*width+x]
+					mb += b[y*width+x]
+				}
+			}
+			count := float64(ww * wh)
+			ma, mb = ma/count, mb/count
+			for y := y0; y < y0+wh; y++ {
+				for x := x0; x < x0+ww; x++ {
+					da, db := a[y*width+x]-ma, b[y*width+x]-mb
+					va += da * da
+					vb += db * db
+					cov += da * db
+				}
+			}
+			va, vb, cov = va/count, vb/count, cov/count
+			sum += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// Downsample returns a new image in which each pixel is the average of an n x n block of pixels in im.
+// Blocks at the right and bottom edges may be smaller.
+func Downsample(im image.Image, n int) image.Image {
+	if n <= 1 {
+		return im
+	}
+	b := im.Bounds()
+	w, h := (b.Dx()+n-1)/n, (b.Dy()+n-1)/n
+	out := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [3]float64
+			count := 0.0
+			for sy := b.Min.Y + y*n; sy < b.Min.Y+(y+1)*n && sy < b.Max.Y; sy++ {
+				for sx := b.Min.X + x*n; sx < b.Min.X+(x+1)*n && sx < b.Max.X; sx++ {
+					r, g, bl, _ := im.At(sx, sy).RGBA()
+					sum[0] += float64(r)
+					sum[1] += float64(g)
+					sum[2] += float64(bl)
+					count++
+				}
+			}
+			out.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(sum[0]/count + 0.5),
+				G: uint16(sum[1]/count + 0.5),
+				B: uint16(sum[2]/count + 0.5),
+				A: 0xffff,
+			})
+		}
+	}
+	return out
+}
+
+// heat is the false color scale of HeatMap, from no error to the most.
+var heat = [][3]float64{
+	{0, 0, 0},
+	{0, 0, 1},
+	{0, 1, 0},
+	{1, 1, 0},
+	{1, 0, 0},
+}
+
+// HeatMap draws the relative error of each pixel in false color:
+// black where the images match, through blue, green, and yellow, to red
+// where the relative error reaches max.
+// If max is zero, the scale runs to the largest relative error.
+func (r *Result) HeatMap(max float64) *image.RGBA {
+	if max <= 0 {
+		max = r.MaxRelative
+	}
+	w := r.Bounds.Dx()
+	im := image.NewRGBA(image.Rect(0, 0, w, r.Bounds.Dy()))
+	for i, rel := range r.Relative {
+		t := 0.0
+		if max > 0 {
+			t = math.Min(rel/max, 1) * float64(len(heat)-1)
+		}
+		k := int(t)
+		if k >= len(heat)-1 {
+			k = len(heat) - 2
+		}
+		f := t - float64(k)
+		var c [3]uint8
+		for ch := range c {
+			c[ch] = uint8(255*(heat[k][ch]*(1-f)+heat[k+1][ch]*f) + 0.5)
+		}
+		im.SetRGBA(i%w, i/w, color.RGBA{c[0], c[1], c[2], 255})
+	}
+	return im
+}
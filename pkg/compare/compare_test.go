@@ -0,0 +1,116 @@
+package compare
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// gray returns an 8-bit grayscale image over r whose pixels are v(x, y).
+func gray(r image.Rectangle, v func(x, y int) uint8) *image.Gray {
+	im := image.NewGray(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			im.SetGray(x, y, color.Gray{v(x, y)})
+		}
+	}
+	return im
+}
+
+func TestImages(t *testing.T) {
+	ramp := func(x, y int) uint8 { return uint8(5*x + 10*y) }
+	r := image.Rect(0, 0, 12, 9)
+	flat := func(v uint8) *image.Gray { return gray(r, func(x, y int) uint8 { return v }) }
+	tests := []struct {
+		name       string
+		a, b       image.Image
+		rmse, ssim float64
+		maxRel     float64
+	}{
+		{"identical", gray(r, ramp), gray(r, ramp), 0, 1, 0},
+		// the same image, but with bounds away from the origin.
+		{"identical, moved", gray(r.Add(image.Pt(5, -3)), func(x, y int) uint8 { return ramp(x-5, y+3) }), gray(r, ramp), 0, 1, 0},
+		// 102/255 and 51/255 differ by 0.2, and flat images have no variance,
+		// so the structural similarity is just the luminance term.
+		{"offset, flat", flat(102), flat(51), 0.2, (2*0.4*0.2 + 1e-4) / (0.4*0.4 + 0.2*0.2 + 1e-4), 0.2 / 0.21},
+		// an offset doesn't change the structure, so only the luminance term lowers ssim.
+		{"offset, ramp", gray(r, func(x, y int) uint8 { return ramp(x, y) + 51 }), gray(r, ramp), 0.2, 0.8, 0.2 / 0.01},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := Images(test.a, test.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(res.RMSE-test.rmse) > 1e-9 {
+				t.Errorf("rmse %v, want %v", res.RMSE, test.rmse)
+			}
+			if test.rmse == 0 && !math.IsInf(res.PSNR, 1) {
+				t.Errorf("psnr %v, want +Inf", res.PSNR)
+			}
+			if test.rmse > 0 && math.Abs(res.PSNR-20*math.Log10(1/test.rmse)) > 1e-6 {
+				t.Errorf("psnr %v, want %v", res.PSNR, 20*math.Log10(1/test.rmse))
+			}
+			if test.ssim == 1 && res.SSIM != 1 || test.ssim < 1 && (res.SSIM >= 1 || res.SSIM < test.ssim-1e-9) {
+				t.Errorf("ssim %v, want %v", res.SSIM, test.ssim)
+			}
+			if math.Abs(res.MaxRelative-test.maxRel) > 1e-9 {
+				t.Errorf("max relative error %v, want %v", res.MaxRelative, test.maxRel)
+			}
+			if res.Bounds != test.a.Bounds() || len(res.Relative) != r.Dx()*r.Dy() {
+				t.Errorf("bounds %v with %d relative errors, want %v with %d", res.Bounds, len(res.Relative), test.a.Bounds(), r.Dx()*r.Dy())
+			}
+		})
+	}
+
+	// an image and its negative have opposite structure.
+	neg := gray(r, func(x, y int) uint8 { return 255 - ramp(x, y) })
+	if res, err := Images(neg, gray(r, ramp)); err != nil || res.SSIM >= 0 {
+		t.Errorf("ssim of an image and its negative: %v, %v", res, err)
+	}
+}
+
+func TestImagesSize(t *testing.T) {
+	tests := []struct {
+		a, b image.Rectangle
+	}{
+		{image.Rect(0, 0, 4, 3), image.Rect(0, 0, 3, 4)},
+		{image.Rect(0, 0, 4, 3), image.Rect(0, 0, 4, 2)},
+		{image.Rect(0, 0, 0, 0), image.Rect(0, 0, 0, 0)},
+		{image.Rect(2, 2, 2, 5), image.Rect(0, 0, 0, 3)},
+	}
+	for _, test := range tests {
+		if _, err := Images(image.NewGray(test.a), image.NewGray(test.b)); err == nil {
+			t.Errorf("compared %v to %v without an error", test.a, test.b)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	// a 5 x 3 image, away from the origin, in blocks of 2 x 2,
+	// with narrower blocks on the right and shorter ones on the bottom.
+	im := gray(image.Rect(3, 1, 8, 4), func(x, y int) uint8 { return uint8(x-3) * 20 * uint8(y) })
+	got := Downsample(im, 2)
+	want := [][]uint8{
+		{(0 + 20 + 0 + 40) / 4, (40 + 60 + 80 + 120) / 4, (80 + 160) / 2},
+		{(0 + 60) / 2, (120 + 180) / 2, 240},
+	}
+	if b := got.Bounds(); b != image.Rect(0, 0, 3, 2) {
+		t.Fatalf("bounds %v, want %v", b, image.Rect(0, 0, 3, 2))
+	}
+	for y, row := range want {
+		for x, v := range row {
+			r, g, b, a := got.At(x, y).RGBA()
+			w := uint32(v) * 0x101
+			if r != w || g != w || b != w || a != 0xffff {
+				t.Errorf("pixel %d,%d is %d, %d, %d, %d, want %d", x, y, r, g, b, a, w)
+			}
+		}
+	}
+	for _, n := range []int{0, 1} {
+		if got := Downsample(im, n); got != image.Image(im) {
+			t.Errorf("Downsample by %d returned a new image", n)
+		}
+	}
+}
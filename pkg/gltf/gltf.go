@@ -0,0 +1,796 @@
+/*
+Package gltf loads glTF 2.0 scenes, from .gltf files with their buffers and images
+(in separate files or in data URIs), and from binary .glb files.
+
+A scene's nodes are placed by their translation, rotation, and scale, or their matrix,
+each relative to its parent.
+Meshes become TriangleMeshes, with each node's transform applied to a copy of its mesh's vertices.
+Primitives can be triangles, triangle strips, or triangle fans; points and lines are skipped.
+
+# Cameras
+
+Perspective cameras become trace Cameras, looking down their node's -z axis with +y up.
+The image's aspect ratio comes from the render, rather than the camera.
+Orthographic cameras aren't supported.
+
+# Materials
+
+Metallic-roughness materials become trace materials:
+emissive materials become Lights of emissiveFactor times emissiveTexture,
+materials with a metallicFactor of at least 0.5 become Metals with their roughnessFactor,
+and the rest become Lamberts.
+Either takes its color from baseColorFactor times baseColorTexture,
+and a material's normalTexture bends the normals of the meshes it's on.
+The metallicRoughnessTexture, occlusion, and alpha are ignored.
+Primitives without a material are a light grey Lambert.
+*/
+package gltf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Scene is a loaded glTF scene.
+type Scene struct {
+	// Surface is all of the scene's meshes, in a BVH.
+	Surface trace.Surface
+	// Cameras are the cameras of the scene's nodes, in the order the nodes are found,
+	// visiting each node before its children.
+	Cameras []*trace.Camera
+	// Materials are the file's materials, in order.
+	Materials []trace.Material
+}
+
+// Options change how a scene is loaded.
+type Options struct {
+	// Open, if not nil, opens the buffers and images that the scene refers to, instead of os.Open,
+	// so that a scene from an untrusted source can be kept from reading files it shouldn't.
+	Open func(path string) (io.ReadCloser, error)
+}
+
+// Load loads the glTF or GLB file at path.
+// The files that a .gltf file refers to are relative to its directory.
+func Load(path string, opts Options) (*Scene, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := read(data, filepath.Dir(path), opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// document is the JSON of a glTF file, as far as it's used.
+type document struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+	Scene              *int     `json:"scene"`
+	Scenes             []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Children    []int     `json:"children"`
+		Mesh        *int      `json:"mesh"`
+		Camera      *int      `json:"camera"`
+		Matrix      []float64 `json:"matrix"`
+		Translation []float64 `json:"translation"`
+		Rotation    []float64 `json:"rotation"`
+		Scale       []float64 `json:"scale"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Material   *int           `json:"material"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Cameras []struct {
+		Type        string `json:"type"`
+		Perspective *struct {
+			YFov float64 `json:"yfov"`
+		} `json:"perspective"`
+	} `json:"cameras"`
+	Materials []struct {
+		PBR *struct {
+			BaseColorFactor  []float64   `json:"baseColorFactor"`
+			BaseColorTexture *textureRef `json:"baseColorTexture"`
+			MetallicFactor   *float64    `json:"metallicFactor"`
+			RoughnessFactor  *float64    `json:"roughnessFactor"`
+		} `json:"pbrMetallicRoughness"`
+		NormalTexture   *textureRef `json:"normalTexture"`
+		EmissiveTexture *textureRef `json:"emissiveTexture"`
+		EmissiveFactor  []float64   `json:"emissiveFactor"`
+		Extensions      struct {
+			EmissiveStrength *struct {
+				EmissiveStrength float64 `json:"emissiveStrength"`
+			} `json:"KHR_materials_emissive_strength"`
+		} `json:"extensions"`
+	} `json:"materials"`
+	Textures []struct {
+		Sampler *int `json:"sampler"`
+		Source  *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		URI        string `json:"uri"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Samplers []struct {
+		WrapS *int `json:"wrapS"`
+		WrapT *int `json:"wrapT"`
+	} `json:"samplers"`
+	Buffers []struct {
+		URI        string `json:"uri"`
+		ByteLength int    `json:"byteLength"`
+	} `json:"buffers"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+		ByteStride int `json:"byteStride"`
+	} `json:"bufferViews"`
+	Accessors []struct {
+		BufferView    *int             `json:"bufferView"`
+		ByteOffset    int              `json:"byteOffset"`
+		ComponentType int              `json:"componentType"`
+		Normalized    bool             `json:"normalized"`
+		Count         int              `json:"count"`
+		Type          string           `json:"type"`
+		Sparse        *json.RawMessage `json:"sparse"`
+	} `json:"accessors"`
+}
+
+// textureRef is a material's reference to a texture.
+type textureRef struct {
+	Index    int      `json:"index"`
+	TexCoord int      `json:"texCoord"`
+	Scale    *float64 `json:"scale"`
+}
+
+// loader builds a Scene from a document.
+type loader struct {
+	doc     document
+	dir     string
+	opts    Options
+	bin     []byte // the GLB file's binary chunk
+	buffers [][]byte
+	images  map[int]*trace.Image
+	meshes  [][]primitive // each mesh's primitives, before they're placed by nodes
+	ss      []trace.Surface
+	scene   *Scene
+}
+
+// primitive is one part of a mesh, in the mesh's own space.
+type primitive struct {
+	mesh trace.Mesh
+	mat  trace.Material
+}
+
+const (
+	glbMagic = 0x46546C67 // "glTF"
+	glbJSON  = 0x4E4F534A
+	glbBIN   = 0x004E4942
+)
+
+// read reads a glTF scene from a .gltf or .glb file's data,
+// with its other files relative to dir.
+func read(data []byte, dir string, opts Options) (*Scene, error) {
+	l := loader{dir: dir, opts: opts, images: make(map[int]*trace.Image), scene: &Scene{}}
+	js := data
+	if len(data) >= 12 && binary.LittleEndian.Uint32(data) == glbMagic {
+		var err error
+		if js, l.bin, err = splitGLB(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(js, &l.doc); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(l.doc.Asset.Version, "2.") {
+		return nil, fmt.Errorf("glTF version %q isn't supported, only 2.x", l.doc.Asset.Version)
+	}
+	if len(l.doc.ExtensionsRequired) > 0 {
+		return nil, fmt.Errorf("file requires extensions that aren't supported: %s", strings.Join(l.doc.ExtensionsRequired, ", "))
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l.scene, nil
+}
+
+// splitGLB returns the JSON and binary chunks of a GLB file.
+func splitGLB(data []byte) (js, bin []byte, err error) {
+	if v := binary.LittleEndian.Uint32(data[4:]); v != 2 {
+		return nil, nil, fmt.Errorf("GLB version %d isn't supported, only 2", v)
+	}
+	if n := binary.LittleEndian.Uint32(data[8:]); int(n) > len(data) {
+		return nil, nil, errors.New("GLB file is truncated")
+	}
+	for off := 12; off+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[off:]))
+		typ := binary.LittleEndian.Uint32(data[off+4:])
+		if off+8+n > len(data) {
+			return nil, nil, errors.New("GLB chunk runs past the end of the file")
+		}
+		chunk := data[off+8 : off+8+n]
+		switch typ {
+		case glbJSON:
+			js = chunk
+		case glbBIN:
+			bin = chunk
+		}
+		off += 8 + n
+	}
+	if js == nil {
+		return nil, nil, errors.New("GLB file has no JSON chunk")
+	}
+	return js, bin, nil
+}
+
+func (l *loader) load() error {
+	for i := range l.doc.Materials {
+		m, err := l.material(i)
+		if err != nil {
+			return fmt.Errorf("material %d: %v", i, err)
+		}
+		l.scene.Materials = append(l.scene.Materials, m)
+	}
+	l.meshes = make([][]primitive, len(l.doc.Meshes))
+	for i := range l.doc.Meshes {
+		ps, err := l.mesh(i)
+		if err != nil {
+			return fmt.Errorf("mesh %d: %v", i, err)
+		}
+		l.meshes[i] = ps
+	}
+
+	var roots []int
+	switch {
+	case l.doc.Scene != nil && *l.doc.Scene < len(l.doc.Scenes):
+		roots = l.doc.Scenes[*l.doc.Scene].Nodes
+	case len(l.doc.Scenes) > 0:
+		roots = l.doc.Scenes[0].Nodes
+	default:
+		// without scenes, every node that isn't a child of another is a root.
+		child := make(map[int]bool)
+		for _, n := range l.doc.Nodes {
+			for _, c := range n.Children {
+				child[c] = true
+			}
+		}
+		for i := range l.doc.Nodes {
+			if !child[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+	for _, n := range roots {
+		if err := l.node(n, identity, 0); err != nil {
+			return err
+		}
+	}
+	switch len(l.ss) {
+	case 0:
+		return errors.New("scene has no meshes")
+	case 1:
+		l.scene.Surface = l.ss[0]
+	default:
+		l.scene.Surface = trace.NewBVH(0, 1, l.ss...)
+	}
+	return nil
+}
+
+// node adds node i, placed by its parent's transform, and its children.
+func (l *loader) node(i int, parent matrix, depth int) error {
+	if i < 0 || i >= len(l.doc.Nodes) {
+		return fmt.Errorf("node %d doesn't exist", i)
+	}
+	if depth > len(l.doc.Nodes) {
+		return fmt.Errorf("node %d is its own ancestor", i)
+	}
+	n := l.doc.Nodes[i]
+	local := identity
+	switch {
+	case len(n.Matrix) == 16:
+		for c := 0; c < 4; c++ {
+			for r := 0; r < 4; r++ {
+				local[r][c] = n.Matrix[c*4+r] // column-major
+			}
+		}
+	case len(n.Matrix) != 0:
+		return fmt.Errorf("node %d has a matrix of %d numbers, rather than 16", i, len(n.Matrix))
+	default:
+		if len(n.Scale) == 3 {
+			local = scaling(geom.Vec{n.Scale[0], n.Scale[1], n.Scale[2]})
+		}
+		if len(n.Rotation) == 4 {
+			local = rotation(n.Rotation).times(local)
+		}
+		if len(n.Translation) == 3 {
+			local = translation(geom.Vec{n.Translation[0], n.Translation[1], n.Translation[2]}).times(local)
+		}
+	}
+	world := parent.times(local)
+
+	if n.Camera != nil {
+		c, err := l.camera(*n.Camera, world)
+		if err != nil {
+			return fmt.Errorf("node %d: %v", i, err)
+		}
+		if c != nil {
+			l.scene.Cameras = append(l.scene.Cameras, c)
+		}
+	}
+	if n.Mesh != nil {
+		if *n.Mesh < 0 || *n.Mesh >= len(l.meshes) {
+			return fmt.Errorf("node %d refers to mesh %d, which doesn't exist", i, *n.Mesh)
+		}
+		for _, p := range l.meshes[*n.Mesh] {
+			m, err := trace.NewTriangleMesh(world.mesh(p.mesh), p.mat)
+			if err != nil {
+				// primitives without any area, like flattened helpers, aren't worth failing for.
+				continue
+			}
+			l.ss = append(l.ss, m)
+		}
+	}
+	for _, c := range n.Children {
+		if err := l.node(c, world, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// camera returns camera i, placed by the transform m,
+// or nil if it's a kind of camera that isn't supported.
+func (l *loader) camera(i int, m matrix) (*trace.Camera, error) {
+	if i < 0 || i >= len(l.doc.Cameras) {
+		return nil, fmt.Errorf("camera %d doesn't exist", i)
+	}
+	c := l.doc.Cameras[i]
+	if c.Type != "perspective" || c.Perspective == nil {
+		return nil, nil
+	}
+	fov := c.Perspective.YFov * 180 / math.Pi
+	if fov <= 0 || fov >= 180 {
+		return nil, fmt.Errorf("camera %d has a yfov of %g degrees", i, fov)
+	}
+	from := m.point(geom.Vec{})
+	forward := m.dir(geom.Vec{0, 0, -1})
+	up := m.dir(geom.Vec{0, 1, 0})
+	if forward.LenSq() == 0 || up.Cross(forward).LenSq() == 0 {
+		return nil, fmt.Errorf("camera %d's node has a transform that flattens it", i)
+	}
+	return trace.NewCamera(from, from.Plus(forward), up.Unit(), fov, 0, 1, 0, 1), nil
+}
+
+// mesh reads the primitives of mesh i.
+func (l *loader) mesh(i int) ([]primitive, error) {
+	var ps []primitive
+	for j, p := range l.doc.Meshes[i].Primitives {
+		mode := 4
+		if p.Mode != nil {
+			mode = *p.Mode
+		}
+		if mode < 4 {
+			continue // points and lines
+		}
+		pos, ok := p.Attributes["POSITION"]
+		if !ok {
+			return nil, fmt.Errorf("primitive %d has no POSITION", j)
+		}
+		var m trace.Mesh
+		vs, err := l.accessor(pos, 3)
+		if err != nil {
+			return nil, fmt.Errorf("primitive %d POSITION: %v", j, err)
+		}
+		for _, v := range vs {
+			m.Verts = append(m.Verts, geom.Vec{v[0], v[1], v[2]})
+		}
+		if a, ok := p.Attributes["NORMAL"]; ok {
+			ns, err := l.accessor(a, 3)
+			if err != nil {
+				return nil, fmt.Errorf("primitive %d NORMAL: %v", j, err)
+			}
+			for _, n := range ns {
+				m.Norms = append(m.Norms, geom.Vec{n[0], n[1], n[2]}.Unit())
+			}
+		}
+		if a, ok := p.Attributes["TEXCOORD_0"]; ok {
+			uvs, err := l.accessor(a, 2)
+			if err != nil {
+				return nil, fmt.Errorf("primitive %d TEXCOORD_0: %v", j, err)
+			}
+			// glTF's v runs down the image, and trace's runs up it.
+			for _, uv := range uvs {
+				m.UVs = append(m.UVs, geom.Vec{uv[0], 1 - uv[1], 0})
+			}
+		}
+		if len(m.Norms) > 0 && len(m.Norms) != len(m.Verts) || len(m.UVs) > 0 && len(m.UVs) != len(m.Verts) {
+			return nil, fmt.Errorf("primitive %d has attributes of different lengths", j)
+		}
+
+		var index []int
+		if p.Indices != nil {
+			is, err := l.accessor(*p.Indices, 1)
+			if err != nil {
+				return nil, fmt.Errorf("primitive %d indices: %v", j, err)
+			}
+			for _, v := range is {
+				index = append(index, int(v[0]))
+			}
+		} else {
+			for k := range m.Verts {
+				index = append(index, k)
+			}
+		}
+		for _, v := range index {
+			if v < 0 || v >= len(m.Verts) {
+				return nil, fmt.Errorf("primitive %d refers to vertex %d, but there are %d", j, v, len(m.Verts))
+			}
+		}
+		switch mode {
+		case 4:
+			for k := 0; k+2 < len(index); k += 3 {
+				m.Faces = append(m.Faces, [3]int{index[k], index[k+1], index[k+2]})
+			}
+		case 5: // strips alternate their winding
+			for k := 0; k+2 < len(index); k++ {
+				if k%2 == 0 {
+					m.Faces = append(m.Faces, [3]int{index[k], index[k+1], index[k+2]})
+				} else {
+					m.Faces = append(m.Faces, [3]int{index[k+1], index[k], index[k+2]})
+				}
+			}
+		case 6:
+			for k := 1; k+1 < len(index); k++ {
+				m.Faces = append(m.Faces, [3]int{index[0], index[k], index[k+1]})
+			}
+		default:
+			return nil, fmt.Errorf("primitive %d has unknown mode %d", j, mode)
+		}
+
+		prim := primitive{mesh: m}
+		if p.Material != nil {
+			if *p.Material < 0 || *p.Material >= len(l.scene.Materials) {
+				return nil, fmt.Errorf("primitive %d refers to material %d, which doesn't exist", j, *p.Material)
+			}
+			prim.mat = l.scene.Materials[*p.Material]
+			if nt := l.doc.Materials[*p.Material].NormalTexture; nt != nil && len(m.UVs) > 0 {
+				t, err := l.texture(nt)
+				if err != nil {
+					return nil, fmt.Errorf("material %d normalTexture: %v", *p.Material, err)
+				}
+				if nt.Scale != nil && *nt.Scale != 1 {
+					t = &normalScale{Mapper: t, scale: *nt.Scale}
+				}
+				prim.mesh.NormalMap = t
+			}
+		}
+		if prim.mat == nil {
+			prim.mat = trace.NewLambert(trace.NewUniform(0.8, 0.8, 0.8))
+		}
+		ps = append(ps, prim)
+	}
+	return ps, nil
+}
+
+// material builds material i.
+func (l *loader) material(i int) (trace.Material, error) {
+	m := l.doc.Materials[i]
+	if len(m.EmissiveFactor) == 3 && (m.EmissiveFactor[0] > 0 || m.EmissiveFactor[1] > 0 || m.EmissiveFactor[2] > 0) {
+		c := trace.Color{m.EmissiveFactor[0], m.EmissiveFactor[1], m.EmissiveFactor[2]}
+		if s := m.Extensions.EmissiveStrength; s != nil {
+			c = c.Scaled(s.EmissiveStrength)
+		}
+		t, err := l.tinted(m.EmissiveTexture, c)
+		if err != nil {
+			return nil, fmt.Errorf("emissiveTexture: %v", err)
+		}
+		return trace.NewLight(t), nil
+	}
+	base := trace.Color{1, 1, 1}
+	metallic, roughness := 1.0, 1.0
+	var baseTex *textureRef
+	if p := m.PBR; p != nil {
+		if len(p.BaseColorFactor) == 4 {
+			base = trace.Color{p.BaseColorFactor[0], p.BaseColorFactor[1], p.BaseColorFactor[2]}
+		}
+		if p.MetallicFactor != nil {
+			metallic = *p.MetallicFactor
+		}
+		if p.RoughnessFactor != nil {
+			roughness = *p.RoughnessFactor
+		}
+		baseTex = p.BaseColorTexture
+	}
+	t, err := l.tinted(baseTex, base)
+	if err != nil {
+		return nil, fmt.Errorf("baseColorTexture: %v", err)
+	}
+	if metallic >= 0.5 {
+		return trace.NewMetal(t, roughness), nil
+	}
+	return trace.NewLambert(t), nil
+}
+
+// tinted returns the texture that ref refers to, times color c,
+// or a uniform texture of c if ref is nil.
+func (l *loader) tinted(ref *textureRef, c trace.Color) (trace.Mapper, error) {
+	if ref == nil {
+		return trace.NewUniform(c.R(), c.G(), c.B()), nil
+	}
+	t, err := l.texture(ref)
+	if err != nil {
+		return nil, err
+	}
+	if c == (trace.Color{1, 1, 1}) {
+		return t, nil
+	}
+	return &tint{Mapper: t, c: c}, nil
+}
+
+// texture returns the texture that ref refers to, with its sampler's wrapping.
+func (l *loader) texture(ref *textureRef) (trace.Mapper, error) {
+	if ref.TexCoord != 0 {
+		return nil, fmt.Errorf("uses TEXCOORD_%d, but only TEXCOORD_0 is supported", ref.TexCoord)
+	}
+	if ref.Index < 0 || ref.Index >= len(l.doc.Textures) {
+		return nil, fmt.Errorf("texture %d doesn't exist", ref.Index)
+	}
+	tex := l.doc.Textures[ref.Index]
+	if tex.Source == nil {
+		return nil, fmt.Errorf("texture %d has no image", ref.Index)
+	}
+	img, err := l.image(*tex.Source)
+	if err != nil {
+		return nil, fmt.Errorf("image %d: %v", *tex.Source, err)
+	}
+	w := &wrap{Mapper: img, s: repeat, t: repeat}
+	if tex.Sampler != nil {
+		if *tex.Sampler < 0 || *tex.Sampler >= len(l.doc.Samplers) {
+			return nil, fmt.Errorf("sampler %d doesn't exist", *tex.Sampler)
+		}
+		s := l.doc.Samplers[*tex.Sampler]
+		if s.WrapS != nil {
+			w.s = *s.WrapS
+		}
+		if s.WrapT != nil {
+			w.t = *s.WrapT
+		}
+	}
+	return w, nil
+}
+
+// image decodes image i, sharing images that are used by more than one texture.
+func (l *loader) image(i int) (*trace.Image, error) {
+	if img, ok := l.images[i]; ok {
+		return img, nil
+	}
+	if i < 0 || i >= len(l.doc.Images) {
+		return nil, errors.New("doesn't exist")
+	}
+	im := l.doc.Images[i]
+	var data []byte
+	var err error
+	if im.BufferView != nil {
+		data, err = l.bufferView(*im.BufferView)
+	} else {
+		data, err = l.uri(im.URI)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, err := trace.NewImage(ioutil.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	l.images[i] = img
+	return img, nil
+}
+
+// uri returns the data of a data URI, or of the file it names relative to the glTF file.
+func (l *loader) uri(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		i := strings.Index(uri, ",")
+		if i < 0 || !strings.HasSuffix(uri[:i], ";base64") {
+			return nil, errors.New("data URI isn't base64")
+		}
+		return base64.StdEncoding.DecodeString(uri[i+1:])
+	}
+	path, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(l.dir, filepath.FromSlash(path))
+	}
+	if l.opts.Open == nil {
+		return ioutil.ReadFile(path)
+	}
+	f, err := l.opts.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// buffer returns the data of buffer i.
+func (l *loader) buffer(i int) ([]byte, error) {
+	if i < 0 || i >= len(l.doc.Buffers) {
+		return nil, fmt.Errorf("buffer %d doesn't exist", i)
+	}
+	if l.buffers == nil {
+		l.buffers = make([][]byte, len(l.doc.Buffers))
+	}
+	if l.buffers[i] == nil {
+		b := l.doc.Buffers[i]
+		var data []byte
+		if b.URI == "" {
+			// a buffer without a URI is the GLB file's binary chunk.
+			if i != 0 || l.bin == nil {
+				return nil, fmt.Errorf("buffer %d has no uri", i)
+			}
+			data = l.bin
+		} else {
+			var err error
+			if data, err = l.uri(b.URI); err != nil {
+				return nil, fmt.Errorf("buffer %d: %v", i, err)
+			}
+		}
+		if len(data) < b.ByteLength {
+			return nil, fmt.Errorf("buffer %d has %d bytes, rather than %d", i, len(data), b.ByteLength)
+		}
+		l.buffers[i] = data
+	}
+	return l.buffers[i], nil
+}
+
+// bufferView returns the data of buffer view i.
+func (l *loader) bufferView(i int) ([]byte, error) {
+	if i < 0 || i >= len(l.doc.BufferViews) {
+		return nil, fmt.Errorf("buffer view %d doesn't exist", i)
+	}
+	v := l.doc.BufferViews[i]
+	b, err := l.buffer(v.Buffer)
+	if err != nil {
+		return nil, err
+	}
+	if v.ByteOffset < 0 || v.ByteLength < 0 || v.ByteOffset > len(b) || v.ByteLength > len(b)-v.ByteOffset {
+		return nil, fmt.Errorf("buffer view %d runs past the end of its buffer", i)
+	}
+	if v.ByteStride != 0 && (v.ByteStride < 4 || v.ByteStride > 252 || v.ByteStride%4 != 0) {
+		return nil, fmt.Errorf("buffer view %d has byte stride %d, rather than a multiple of 4 from 4 to 252", i, v.ByteStride)
+	}
+	return b[v.ByteOffset : v.ByteOffset+v.ByteLength], nil
+}
+
+// componentSizes are the sizes in bytes of each component type.
+var componentSizes = map[int]int{5120: 1, 5121: 1, 5122: 2, 5123: 2, 5125: 4, 5126: 4}
+
+// typeSizes are the number of components of each accessor type.
+var typeSizes = map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT2": 4, "MAT3": 9, "MAT4": 16}
+
+// maxZeros is the most elements an accessor without a buffer view may have.
+const maxZeros = 1 << 20
+
+// accessor reads the elements of accessor i, which must have n components each.
+func (l *loader) accessor(i, n int) ([][]float64, error) {
+	if i < 0 || i >= len(l.doc.Accessors) {
+		return nil, fmt.Errorf("accessor %d doesn't exist", i)
+	}
+	a := l.doc.Accessors[i]
+	if a.Sparse != nil {
+		return nil, fmt.Errorf("accessor %d is sparse, which isn't supported", i)
+	}
+	size, ok := componentSizes[a.ComponentType]
+	if !ok {
+		return nil, fmt.Errorf("accessor %d has unknown component type %d", i, a.ComponentType)
+	}
+	if typeSizes[a.Type] != n {
+		return nil, fmt.Errorf("accessor %d has type %s, rather than %d components", i, a.Type, n)
+	}
+	if a.Count < 0 || a.ByteOffset < 0 {
+		return nil, fmt.Errorf("accessor %d has count %d and byte offset %d", i, a.Count, a.ByteOffset)
+	}
+	var data []byte
+	stride := size * n
+	if a.BufferView == nil {
+		// an accessor without a buffer view is all zeros, which no real file needs many of.
+		if a.Count > maxZeros {
+			return nil, fmt.Errorf("accessor %d has %d elements but no buffer view", i, a.Count)
+		}
+	} else {
+		var err error
+		if data, err = l.bufferView(*a.BufferView); err != nil {
+			return nil, err
+		}
+		if s := l.doc.BufferViews[*a.BufferView].ByteStride; s != 0 {
+			if s < size*n {
+				return nil, fmt.Errorf("accessor %d has elements of %d bytes, longer than its buffer view's stride of %d", i, size*n, s)
+			}
+			stride = s
+		}
+		// the last element ends at ByteOffset+(Count-1)*stride+size*n, which mustn't pass the end of data.
+		if a.Count > 0 && (a.ByteOffset > len(data)-size*n || a.Count-1 > (len(data)-size*n-a.ByteOffset)/stride) {
+			return nil, fmt.Errorf("accessor %d runs past the end of its buffer view", i)
+		}
+	}
+	out := make([][]float64, a.Count)
+	vals := make([]float64, a.Count*n)
+	for k := range out {
+		out[k] = vals[k*n : (k+1)*n]
+	}
+	if a.BufferView == nil {
+		return out, nil
+	}
+	le := binary.LittleEndian
+	for k := 0; k < a.Count; k++ {
+		for c := 0; c < n; c++ {
+			b := data[a.ByteOffset+k*stride+c*size:]
+			var v float64
+			switch a.ComponentType {
+			case 5120:
+				v = float64(int8(b[0]))
+				if a.Normalized {
+					v = math.Max(v/127, -1)
+				}
+			case 5121:
+				v = float64(b[0])
+				if a.Normalized {
+					v /= 255
+				}
+			case 5122:
+				v = float64(int16(le.Uint16(b)))
+				if a.Normalized {
+					v = math.Max(v/32767, -1)
+				}
+			case 5123:
+				v = float64(le.Uint16(b))
+				if a.Normalized {
+					v /= 65535
+				}
+			case 5125:
+				v = float64(le.Uint32(b))
+			case 5126:
+				v = float64(math.Float32frombits(le.Uint32(b)))
+			}
+			out[k][c] = v
+		}
+	}
+	return out, nil
+}
+
+// Camera returns the scene's first camera,
+// or if it has none, a camera that looks at the whole scene from the front, along -z.
+func (s *Scene) Camera() *trace.Camera {
+	if len(s.Cameras) > 0 {
+		return s.Cameras[0]
+	}
+	b := s.Surface.Bounds(0, 1)
+	mid := b.Mid()
+	radius := b.Max().Minus(b.Min()).Len() / 2
+	const fov = 40.0
+	dist := radius / math.Sin(fov/2*math.Pi/180)
+	return trace.NewCamera(mid.Plus(geom.Vec{0, 0, dist}), mid, geom.Unit{0, 1, 0}, fov, 0, dist, 0, 1)
+}
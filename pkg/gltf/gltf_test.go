@@ -0,0 +1,232 @@
+package gltf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+func TestLoad(t *testing.T) {
+	fromAbove, fromBelow := geom.Vec{0, 0, -1}, geom.Vec{0, 1, 0}
+	tests := []struct {
+		name   string
+		at     geom.Vec // where the ray hits, or would hit
+		dir    geom.Vec
+		miss   bool
+		norm   geom.Vec
+		uv     *geom.Vec
+		matted bool // whether the hit has the file's first material
+	}{
+		// the unit square, as two indexed triangles, moved by a translation.
+		{name: "triangles", at: geom.Vec{-2.5, 0.5, 0}, dir: fromAbove, norm: geom.Vec{0, 0, 1}, matted: true},
+		{name: "triangles, second", at: geom.Vec{-2.8, 0.9, 0}, dir: fromAbove, norm: geom.Vec{0, 0, 1}, matted: true},
+		// the same mesh, turned around the y axis by a rotation.
+		{name: "rotated", at: geom.Vec{-6.5, 0.5, 0}, dir: fromAbove, norm: geom.Vec{0, 0, -1}, matted: true},
+		{name: "rotated, outside", at: geom.Vec{-5.5, 0.5, 0}, dir: fromAbove, miss: true},
+		// a strip, from interleaved positions and uvs, scaled by its node and moved by its parent's.
+		// its second triangle's winding is reversed, so both face the same way.
+		{name: "strip", at: geom.Vec{2.5, 1.5, 0}, dir: fromAbove, norm: geom.Vec{0, 0, 1}, uv: &geom.Vec{0.25, 0.75, 0}},
+		{name: "strip, second", at: geom.Vec{3.5, 0.5, 0}, dir: fromAbove, norm: geom.Vec{0, 0, 1}, uv: &geom.Vec{0.75, 0.25, 0}},
+		{name: "strip, outside", at: geom.Vec{4.5, 1, 0}, dir: fromAbove, miss: true},
+		// a fan, placed upright at y = 5 by a column-major matrix.
+		{name: "fan", at: geom.Vec{0.8, 5, 0.2}, dir: fromBelow, norm: geom.Vec{0, -1, 0}},
+		{name: "fan, second", at: geom.Vec{0.2, 5, 0.8}, dir: fromBelow, norm: geom.Vec{0, -1, 0}},
+		{name: "fan, outside", at: geom.Vec{0.5, 5, 1.5}, dir: fromBelow, miss: true},
+	}
+	for _, file := range []string{"squares.gltf", "squares.glb"} {
+		t.Run(file, func(t *testing.T) {
+			s, err := Load("testdata/"+file, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Materials) != 1 {
+				t.Fatalf("got %d materials, want 1", len(s.Materials))
+			}
+			if c := s.Materials[0].(trace.Albedoer).Albedo(geom.Vec{}, geom.Vec{}); c != (trace.Color{0.2, 0.4, 0.6}) {
+				t.Errorf("material has albedo %v, want 0.2, 0.4, 0.6", c)
+			}
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					r := trace.NewRay(test.at.Minus(test.dir), test.dir.Unit(), 0)
+					hit := s.Surface.Hit(r, 0, math.MaxFloat64, nil)
+					if test.miss {
+						if hit != nil {
+							t.Fatalf("got a hit at %v, want a miss", hit.Pt)
+						}
+						return
+					}
+					if hit == nil {
+						t.Fatal("missed")
+					}
+					if !near(hit.Pt, test.at) {
+						t.Errorf("hit at %v, want %v", hit.Pt, test.at)
+					}
+					if !near(geom.Vec(hit.Norm), test.norm) {
+						t.Errorf("normal %v, want %v", hit.Norm, test.norm)
+					}
+					if test.uv != nil && !near(hit.UV, *test.uv) {
+						t.Errorf("uv %v, want %v", hit.UV, *test.uv)
+					}
+					if (hit.Mat == s.Materials[0]) != test.matted {
+						t.Errorf("hit has material %v", hit.Mat)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/squares.gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		change func(doc map[string]interface{})
+		want   string
+	}{
+		{"negative count", accessor(0, "count", -1), "accessor 0 has count -1"},
+		{"negative offset", accessor(0, "byteOffset", -4), "accessor 0 has count 4 and byte offset -4"},
+		{"count past view", accessor(0, "count", 5), "accessor 0 runs past the end of its buffer view"},
+		{"huge count", accessor(0, "count", math.MaxInt64/2), "accessor 0 runs past the end of its buffer view"},
+		{"huge offset", accessor(0, "byteOffset", math.MaxInt64-8), "accessor 0 runs past the end of its buffer view"},
+		{"offset past view", accessor(2, "byteOffset", 16), "accessor 2 runs past the end of its buffer view"},
+		{"no view", func(doc map[string]interface{}) {
+			delete(item(doc, "accessors", 0), "bufferView")
+			item(doc, "accessors", 0)["count"] = math.MaxInt64 / 2
+		}, "accessor 0 has 4611686018427387903 elements but no buffer view"},
+		{"short stride", bufferView(1, "byteStride", 8), "accessor 1 has elements of 12 bytes, longer than its buffer view's stride of 8"},
+		{"negative stride", bufferView(1, "byteStride", -20), "buffer view 1 has byte stride -20"},
+		{"odd stride", bufferView(1, "byteStride", 18), "buffer view 1 has byte stride 18"},
+		{"negative view offset", bufferView(0, "byteOffset", -48), "buffer view 0 runs past the end of its buffer"},
+		{"huge view length", bufferView(0, "byteLength", math.MaxInt64), "buffer view 0 runs past the end of its buffer"},
+		{"view past buffer", bufferView(3, "byteOffset", 142), "buffer view 3 runs past the end of its buffer"},
+		{"index out of range", func(doc map[string]interface{}) {
+			item(doc, "accessors", 4)["componentType"] = 5123
+			item(doc, "accessors", 4)["count"] = 2
+		}, "primitive 0 refers to vertex 256, but there are 4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var doc map[string]interface{}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			test.change(doc)
+			js, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = read(js, "testdata", Options{})
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+// item returns the ith object of the document's array name.
+func item(doc map[string]interface{}, name string, i int) map[string]interface{} {
+	return doc[name].([]interface{})[i].(map[string]interface{})
+}
+
+// accessor returns a change to a document that sets a property of accessor i.
+func accessor(i int, prop string, v interface{}) func(map[string]interface{}) {
+	return func(doc map[string]interface{}) { item(doc, "accessors", i)[prop] = v }
+}
+
+// bufferView returns a change to a document that sets a property of buffer view i.
+func bufferView(i int, prop string, v interface{}) func(map[string]interface{}) {
+	return func(doc map[string]interface{}) { item(doc, "bufferViews", i)[prop] = v }
+}
+
+// near reports whether a and b are within a small distance of each other.
+func near(a, b geom.Vec) bool {
+	return a.Minus(b).Len() < 1e-9
+}
+
+// TestOpen checks that buffers are read through Options.Open, which can refuse them.
+func TestOpen(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/squares.gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	uri := item(doc, "buffers", 0)["uri"].(string)
+	bin, err := base64.StdEncoding.DecodeString(uri[strings.Index(uri, ",")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(root, "squares.bin"), filepath.Join(base, "secret.bin")} {
+		if err := ioutil.WriteFile(path, bin, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var opened []string
+	open := func(path string) (io.ReadCloser, error) {
+		opened = append(opened, path)
+		if rel, err := filepath.Rel(root, path); err != nil || strings.HasPrefix(rel, "..") {
+			return nil, errors.New("outside the root")
+		}
+		return os.Open(path)
+	}
+	tests := []struct {
+		uri  string
+		path string // the file opened
+		ok   bool
+	}{
+		{"squares.bin", filepath.Join(root, "squares.bin"), true},
+		{"sub/../squares.bin", filepath.Join(root, "squares.bin"), true},
+		{"../secret.bin", filepath.Join(base, "secret.bin"), false},
+		{"%2E%2E/secret.bin", filepath.Join(base, "secret.bin"), false},
+		{filepath.ToSlash(filepath.Join(base, "secret.bin")), filepath.Join(base, "secret.bin"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			item(doc, "buffers", 0)["uri"] = test.uri
+			js, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(root, "scene.gltf")
+			if err := ioutil.WriteFile(path, js, 0644); err != nil {
+				t.Fatal(err)
+			}
+			opened = nil
+			_, err = Load(path, Options{Open: open})
+			if len(opened) != 1 || opened[0] != test.path {
+				t.Errorf("opened %v, want %s", opened, test.path)
+			}
+			if test.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !test.ok && (err == nil || !strings.Contains(err.Error(), "outside the root")) {
+				t.Fatalf("got error %v, want one from Open", err)
+			}
+			// without Open, any file may be read.
+			if _, err := Load(path, Options{}); err != nil {
+				t.Errorf("without Open: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package gltf
+
+import (
+	"math"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// matrix is an affine transform, as a 4x4 matrix in rows, that transforms column vectors.
+type matrix [4][4]float64
+
+var identity = matrix{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+
+func translation(v geom.Vec) matrix {
+	m := identity
+	m[0][3], m[1][3], m[2][3] = v[0], v[1], v[2]
+	return m
+}
+
+func scaling(v geom.Vec) matrix {
+	m := identity
+	m[0][0], m[1][1], m[2][2] = v[0], v[1], v[2]
+	return m
+}
+
+// rotation returns the rotation of the quaternion q, as x, y, z, and w.
+func rotation(q []float64) matrix {
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	if n := math.Sqrt(x*x + y*y + z*z + w*w); n > 0 {
+		x, y, z, w = x/n, y/n, z/n, w/n
+	}
+	return matrix{
+		{1 - 2*(y*y+z*z), 2 * (x*y - z*w), 2 * (x*z + y*w), 0},
+		{2 * (x*y + z*w), 1 - 2*(x*x+z*z), 2 * (y*z - x*w), 0},
+		{2 * (x*z - y*w), 2 * (y*z + x*w), 1 - 2*(x*x+y*y), 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// times returns the transform that applies n, then m.
+func (m matrix) times(n matrix) (p matrix) {
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			for k := 0; k < 4; k++ {
+				p[r][c] += m[r][k] * n[k][c]
+			}
+		}
+	}
+	return p
+}
+
+func (m matrix) point(v geom.Vec) geom.Vec {
+	return m.dir(v).Plus(geom.Vec{m[0][3], m[1][3], m[2][3]})
+}
+
+func (m matrix) dir(v geom.Vec) geom.Vec {
+	return geom.Vec{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// det returns the determinant of m's upper 3x3, which is negative if m mirrors.
+func (m matrix) det() float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// normal transforms normal n by the inverse transpose of m's upper 3x3,
+// which is its cofactor matrix, scaled; the scale doesn't matter once the result is a unit.
+func (m matrix) normal(n geom.Unit) geom.Unit {
+	var c matrix
+	for r := 0; r < 3; r++ {
+		for k := 0; k < 3; k++ {
+			r1, r2 := (r+1)%3, (r+2)%3
+			k1, k2 := (k+1)%3, (k+2)%3
+			c[r][k] = m[r1][k1]*m[r2][k2] - m[r1][k2]*m[r2][k1]
+		}
+	}
+	v := c.dir(geom.Vec(n))
+	if m.det() < 0 {
+		v = v.Inv()
+	}
+	if v.LenSq() == 0 {
+		return n
+	}
+	return v.Unit()
+}
+
+// mesh returns a copy of mesh, transformed by m.
+// Mirroring transforms reverse the order of each face's vertices, so that faces keep facing out.
+func (m matrix) mesh(mesh trace.Mesh) trace.Mesh {
+	out := mesh
+	out.Verts = make([]geom.Vec, len(mesh.Verts))
+	for i, v := range mesh.Verts {
+		out.Verts[i] = m.point(v)
+	}
+	if mesh.Norms != nil {
+		out.Norms = make([]geom.Unit, len(mesh.Norms))
+		for i, n := range mesh.Norms {
+			out.Norms[i] = m.normal(n)
+		}
+	}
+	if m.det() < 0 {
+		out.Faces = make([][3]int, len(mesh.Faces))
+		for i, f := range mesh.Faces {
+			out.Faces[i] = [3]int{f[0], f[2], f[1]}
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package gltf
+
+import (
+	"math"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// sampler wrap modes
+const (
+	repeat = 10497
+	clamp  = 33071
+	mirror = 33648
+)
+
+// wrap is a texture that's repeated, clamped, or mirrored outside of uvs from 0 to 1,
+// as its sampler says.
+type wrap struct {
+	trace.Mapper
+	s, t int
+}
+
+// Map maps a uv coordinate at point p, wrapped to the range 0 to 1, to a color.
+func (w *wrap) Map(uv, p geom.Vec) trace.Color {
+	uv[0] = wrapped(uv[0], w.s)
+	// v was flipped when it was read, so it's flipped back to wrap as the file expects.
+	uv[1] = 1 - wrapped(1-uv[1], w.t)
+	return w.Mapper.Map(uv, p)
+}
+
+func wrapped(x float64, mode int) float64 {
+	switch mode {
+	case clamp:
+		return math.Max(0, math.Min(1, x))
+	case mirror:
+		x = math.Mod(math.Abs(x), 2)
+		if x > 1 {
+			x = 2 - x
+		}
+		return x
+	}
+	return x - math.Floor(x)
+}
+
+// tint is a texture multiplied by a color.
+type tint struct {
+	trace.Mapper
+	c trace.Color
+}
+
+// Map maps a uv coordinate at point p to the texture's color times the tint.
+func (t *tint) Map(uv, p geom.Vec) trace.Color {
+	return t.Mapper.Map(uv, p).Times(t.c)
+}
+
+// normalScale is a normal map whose tangent directions are scaled,
+// which makes bumps steeper or shallower.
+type normalScale struct {
+	trace.Mapper
+	scale float64
+}
+
+// Map maps a uv coordinate at point p to the normal map's color, with its red and green scaled about the middle.
+func (n *normalScale) Map(uv, p geom.Vec) trace.Color {
+	c := n.Mapper.Map(uv, p)
+	c[0] = (c[0]*2-1)*n.scale/2 + 0.5
+	c[1] = (c[1]*2-1)*n.scale/2 + 0.5
+	return c
+}
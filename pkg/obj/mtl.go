@@ -0,0 +1,219 @@
+package obj
+
+import (
+	"bufio"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// mtl is a material as described in an MTL file.
+type mtl struct {
+	kd, ks, ke   trace.Color
+	mapKd, mapKe trace.Mapper
+	ns, ni, d    float64
+	illum        int
+}
+
+func newMtl() *mtl {
+	return &mtl{kd: trace.Color{0.8, 0.8, 0.8}, d: 1}
+}
+
+// material returns the trace material that m is most like.
+func (m *mtl) material() trace.Material {
+	if m.mapKe != nil || brightest(m.ke) > 0 {
+		return trace.NewLight(orUniform(m.mapKe, m.ke))
+	}
+	if m.d < 1 {
+		ni := m.ni
+		if ni < 1 {
+			ni = 1.5
+		}
+		return trace.NewDielectric(ni)
+	}
+	if brightest(m.ks) > 0 && (brightest(m.ks) > brightest(m.kd) || m.illum == 3) {
+		// a Phong exponent ns gives highlights about as wide as a microfacet roughness of sqrt(2 / (ns + 2)).
+		return trace.NewMetal(trace.NewUniform(m.ks.R(), m.ks.G(), m.ks.B()), math.Sqrt(2/(m.ns+2)))
+	}
+	return trace.NewLambert(orUniform(m.mapKd, m.kd))
+}
+
+// orUniform returns texture t, or a texture of color c if t is nil.
+func orUniform(t trace.Mapper, c trace.Color) trace.Mapper {
+	if t != nil {
+		return t
+	}
+	return trace.NewUniform(c.R(), c.G(), c.B())
+}
+
+// brightest returns the brightest channel of c.
+func brightest(c trace.Color) float64 {
+	return math.Max(c.R(), math.Max(c.G(), c.B()))
+}
+
+// mtllib reads the materials in the MTL file at name, relative to the model.
+// Problems are reported at the line of the MTL file where they're found.
+func (p *parser) mtllib(name string) {
+	path := filepath.FromSlash(strings.Replace(name, `\`, "/", -1))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.dir, path)
+	}
+	f, err := p.open(path)
+	if err != nil {
+		p.fail("%v", err)
+	}
+	defer f.Close()
+
+	// problems within the MTL file are reported at its lines, rather than the model's.
+	objName, objLine := p.name, p.line
+	p.name, p.line = path, 0
+	defer func() { p.name, p.line = objName, objLine }()
+
+	var m *mtl
+	var mName string
+	finish := func() {
+		if m != nil {
+			p.model.Materials[mName] = m.material()
+		}
+	}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		p.line++
+		fields := strings.Fields(s.Text())
+		if i := commentStart(fields); i >= 0 {
+			fields = fields[:i]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+		if fields[0] == "newmtl" {
+			if len(args) == 0 {
+				p.fail("newmtl needs a material name")
+			}
+			finish()
+			m, mName = newMtl(), strings.Join(args, " ")
+			continue
+		}
+		if m == nil {
+			p.fail("%s comes before any newmtl", fields[0])
+		}
+		switch fields[0] {
+		case "Kd":
+			m.kd = p.color(args, "Kd")
+		case "Ks":
+			m.ks = p.color(args, "Ks")
+		case "Ke":
+			m.ke = p.color(args, "Ke")
+		case "Ns":
+			m.ns = p.scalar(args, "Ns")
+		case "Ni":
+			m.ni = p.scalar(args, "Ni")
+		case "d":
+			m.d = p.scalar(args, "d")
+		case "Tr":
+			m.d = 1 - p.scalar(args, "Tr")
+		case "illum":
+			m.illum = int(p.scalar(args, "illum"))
+		case "map_Kd":
+			m.mapKd = p.texture(args, filepath.Dir(path))
+		case "map_Ke":
+			m.mapKe = p.texture(args, filepath.Dir(path))
+		}
+	}
+	if err := s.Err(); err != nil {
+		p.line++
+		p.fail("%v", err)
+	}
+	finish()
+}
+
+func (p *parser) scalar(args []string, what string) float64 {
+	if len(args) != 1 {
+		p.fail("%s should have 1 number, not %d", what, len(args))
+	}
+	return p.number(args[0], what)
+}
+
+// color parses an MTL color, which is either three numbers or one number for all three channels.
+// Colors given as spectral curves or CIE XYZ aren't supported.
+func (p *parser) color(args []string, what string) trace.Color {
+	switch {
+	case len(args) > 0 && (args[0] == "spectral" || args[0] == "xyz"):
+		p.fail("%s is a %s color, which isn't supported", what, args[0])
+	case len(args) == 1:
+		v := p.number(args[0], what)
+		return trace.Color{v, v, v}
+	case len(args) == 3:
+		return trace.Color(p.vec(args, what))
+	}
+	p.fail("%s should have 3 numbers, not %d", what, len(args))
+	return trace.Color{}
+}
+
+// mapOptions are the options that texture map statements can have, and how many arguments each takes.
+// -o, -s, and -t, which aren't listed, take one to three numbers.
+var mapOptions = map[string]int{
+	"-blendu": 1, "-blendv": 1, "-boost": 1, "-cc": 1, "-clamp": 1, "-imfchan": 1,
+	"-mm": 2, "-texres": 1, "-bm": 1, "-type": 1,
+}
+
+// texture loads the image named by a texture map statement with arguments args.
+// The map's options are skipped, and its file is relative to dir.
+func (p *parser) texture(args []string, dir string) trace.Mapper {
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		opt := args[i]
+		i++
+		if n, ok := mapOptions[opt]; ok {
+			i += n
+			continue
+		}
+		if opt != "-o" && opt != "-s" && opt != "-t" {
+			p.fail("unknown texture map option %q", opt)
+		}
+		for n := 0; n < 3 && i < len(args); n++ {
+			if _, err := strconv.ParseFloat(args[i], 64); err != nil {
+				break
+			}
+			i++
+		}
+	}
+	if i >= len(args) {
+		p.fail("texture map needs a file name")
+	}
+	path := filepath.FromSlash(strings.Replace(strings.Join(args[i:], " "), `\`, "/", -1))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	img, ok := p.images[path]
+	if !ok {
+		f, err := p.open(path)
+		if err != nil {
+			p.fail("%v", err)
+		}
+		img, err = trace.NewImage(f)
+		f.Close()
+		if err != nil {
+			p.fail("reading image %s: %v", path, err)
+		}
+		p.images[path] = img
+	}
+	return &tiled{img}
+}
+
+// tiled is a texture that repeats outside of uvs from 0 to 1, as models expect.
+type tiled struct {
+	trace.Mapper
+}
+
+// Map maps a uv coordinate at point p, wrapped to the range 0 to 1, to a color.
+func (t *tiled) Map(uv, p geom.Vec) trace.Color {
+	uv[0] -= math.Floor(uv[0])
+	uv[1] -= math.Floor(uv[1])
+	return t.Mapper.Map(uv, p)
+}
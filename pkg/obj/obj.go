@@ -0,0 +1,370 @@
+/*
+Package obj loads Wavefront OBJ models, with their MTL materials, as trace surfaces.
+
+Models can have vertex positions (v), texture coordinates (vt), and normals (vn),
+and faces (f) of any number of vertices, which are split into triangles
+and may refer to vertices with negative indices, counting back from the latest.
+Faces are grouped into a TriangleMesh for each material (usemtl) within each object (o) or group (g).
+Other statements, like lines and smoothing groups, are ignored.
+
+# Materials
+
+Materials are read from the MTL files named by mtllib, and become trace materials:
+
+	Ke, map_Ke   a Light, if the emission isn't black
+	d, Tr, Ni    a Dielectric, with the refractive index Ni (default 1.5), if it's transparent
+	Ks, Ns       a Metal, if the specular color is brighter than the diffuse color,
+	             or illum is 3; its roughness comes from the specular exponent Ns
+	Kd, map_Kd   a Lambert otherwise
+
+Texture maps replace their color rather than multiplying it, and repeat outside uvs of 0 to 1.
+Faces without a material, or with one that the MTL files don't define, are a light grey Lambert.
+*/
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Model is a loaded OBJ model.
+type Model struct {
+	// Surface is all of the model's parts, in a BVH.
+	Surface trace.Surface
+	// Parts are the model's meshes, in the order they first appear in the file.
+	Parts []Part
+	// Materials are the materials from the model's MTL files, by name.
+	Materials map[string]trace.Material
+}
+
+// Part is the faces of one material within one object or group of a model.
+type Part struct {
+	Object, Group, Material string
+	Mesh                    *trace.TriangleMesh
+}
+
+// Options change how a model is loaded.
+type Options struct {
+	// Material, if not nil, is used for every face instead of the model's own materials,
+	// and MTL files aren't read.
+	Material trace.Material
+	// Open, if not nil, opens the MTL files and textures that the model refers to, instead of os.Open,
+	// so that a model from an untrusted source can be kept from reading files it shouldn't.
+	Open func(path string) (io.ReadCloser, error)
+}
+
+// Error is a problem on a specific line of an OBJ or MTL file.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+// Error returns the error's location and message, like "chair.obj:12: face has 2 vertices".
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Load loads the OBJ model at path.
+// MTL files are relative to the model's directory, and textures are relative to their MTL file's.
+func Load(path string, opts Options) (*Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f, path, opts)
+}
+
+// Read reads an OBJ model from r.
+// name is used in error messages, and relative file paths are resolved against its directory.
+func Read(r io.Reader, name string, opts Options) (m *Model, err error) {
+	p := parser{
+		name:   name,
+		dir:    filepath.Dir(name),
+		opts:   opts,
+		model:  &Model{Materials: make(map[string]trace.Material)},
+		parts:  make(map[partKey]*part),
+		images: make(map[string]*trace.Image),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			m, err = nil, e
+		}
+	}()
+	p.read(r)
+	return p.build(), nil
+}
+
+// open opens a file that the model refers to, with the Open option if it's set.
+func (p *parser) open(path string) (io.ReadCloser, error) {
+	if p.opts.Open != nil {
+		return p.opts.Open(path)
+	}
+	return os.Open(path)
+}
+
+// partKey identifies the part that a face belongs to.
+type partKey struct {
+	object, group, material string
+}
+
+// part gathers the faces of a Part as they're read.
+// Each combination of position, uv, and normal indices becomes one vertex of the part's mesh.
+type part struct {
+	key   partKey
+	mesh  trace.Mesh
+	verts map[[3]int]int
+	uvs   bool
+	line  int // the line of the part's first face
+}
+
+// parser reads an OBJ file.
+// Its methods report problems by panicking with an *Error, which Read recovers.
+type parser struct {
+	name, dir string
+	opts      Options
+	model     *Model
+	line      int
+
+	verts []geom.Vec
+	uvs   []geom.Vec
+	norms []geom.Unit
+
+	object, group, material string
+	parts                   map[partKey]*part
+	order                   []*part
+	faces                   int
+	images                  map[string]*trace.Image
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&Error{File: p.name, Line: p.line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) read(r io.Reader) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		p.line++
+		fields := strings.Fields(s.Text())
+		if i := commentStart(fields); i >= 0 {
+			fields = fields[:i]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+		switch fields[0] {
+		case "v":
+			// some exporters add a vertex color after the position, which is ignored.
+			if len(args) != 3 && len(args) != 4 && len(args) != 6 {
+				p.fail("vertex should have 3 coordinates, not %d", len(args))
+			}
+			p.verts = append(p.verts, p.vec(args[:3], "vertex"))
+		case "vt":
+			if len(args) < 1 || len(args) > 3 {
+				p.fail("texture coordinate should have 1 to 3 numbers, not %d", len(args))
+			}
+			uv := geom.Vec{p.number(args[0], "texture coordinate"), 0, 0}
+			if len(args) > 1 {
+				uv[1] = p.number(args[1], "texture coordinate")
+			}
+			p.uvs = append(p.uvs, uv)
+		case "vn":
+			if len(args) != 3 {
+				p.fail("normal should have 3 coordinates, not %d", len(args))
+			}
+			n := p.vec(args, "normal")
+			if n.LenSq() == 0 {
+				p.fail("normal has zero length")
+			}
+			p.norms = append(p.norms, n.Unit())
+		case "f":
+			p.face(args)
+		case "o":
+			p.object = strings.Join(args, " ")
+		case "g":
+			p.group = strings.Join(args, " ")
+		case "usemtl":
+			if len(args) == 0 {
+				p.fail("usemtl needs a material name")
+			}
+			p.material = strings.Join(args, " ")
+		case "mtllib":
+			if len(args) == 0 {
+				p.fail("mtllib needs a file name")
+			}
+			if p.opts.Material == nil {
+				for _, f := range args {
+					p.mtllib(f)
+				}
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		p.line++
+		p.fail("%v", err)
+	}
+}
+
+// commentStart returns the index of the first field that starts a comment, or -1 if there's none.
+func commentStart(fields []string) int {
+	for i, f := range fields {
+		if strings.HasPrefix(f, "#") {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *parser) number(s, what string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p.fail("%s has %q, which isn't a number", what, s)
+	}
+	return f
+}
+
+func (p *parser) vec(args []string, what string) geom.Vec {
+	return geom.Vec{p.number(args[0], what), p.number(args[1], what), p.number(args[2], what)}
+}
+
+// index returns the zero-based index of the element that OBJ index s refers to,
+// in a list that has n elements so far.
+func (p *parser) index(s string, n int, what string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		p.fail("face has %s index %q, which isn't a whole number", what, s)
+	}
+	switch {
+	case i > 0 && i <= n:
+		return i - 1
+	case i < 0 && -i <= n:
+		return n + i
+	}
+	p.fail("face refers to %s %d, but there are %d so far", what, i, n)
+	return 0
+}
+
+// face adds a face with vertices args, like "1/2/3", split into a fan of triangles.
+func (p *parser) face(args []string) {
+	if len(args) < 3 {
+		p.fail("face should have at least 3 vertices, not %d", len(args))
+	}
+	key := partKey{p.object, p.group, p.material}
+	pt, ok := p.parts[key]
+	if !ok {
+		pt = &part{key: key, verts: make(map[[3]int]int), line: p.line}
+		p.parts[key] = pt
+		p.order = append(p.order, pt)
+	}
+	p.faces++
+
+	// vertices without normals are given one for this face alone, so that they're shaded flat.
+	ids := make([][3]int, len(args))
+	flat := false
+	for i, a := range args {
+		refs := strings.Split(a, "/")
+		if len(refs) > 3 {
+			p.fail("face vertex %q has more than 3 indices", a)
+		}
+		id := [3]int{p.index(refs[0], len(p.verts), "vertex"), -1, -p.faces}
+		if len(refs) > 1 && refs[1] != "" {
+			id[1] = p.index(refs[1], len(p.uvs), "texture coordinate")
+		}
+		if len(refs) > 2 && refs[2] != "" {
+			id[2] = p.index(refs[2], len(p.norms), "normal")
+		} else {
+			flat = true
+		}
+		ids[i] = id
+	}
+	var norm geom.Unit
+	if flat {
+		a, b, c := p.verts[ids[0][0]], p.verts[ids[1][0]], p.verts[ids[2][0]]
+		if n := b.Minus(a).Cross(c.Minus(a)); n.LenSq() > 0 {
+			norm = n.Unit()
+		}
+	}
+
+	vs := make([]int, len(ids))
+	for i, id := range ids {
+		v, ok := pt.verts[id]
+		if !ok {
+			v = len(pt.mesh.Verts)
+			pt.verts[id] = v
+			pt.mesh.Verts = append(pt.mesh.Verts, p.verts[id[0]])
+			uv := geom.Vec{}
+			if id[1] >= 0 {
+				uv = p.uvs[id[1]]
+				pt.uvs = true
+			}
+			pt.mesh.UVs = append(pt.mesh.UVs, uv)
+			n := norm
+			if id[2] >= 0 {
+				n = p.norms[id[2]]
+			}
+			pt.mesh.Norms = append(pt.mesh.Norms, n)
+		}
+		vs[i] = v
+	}
+	for i := 1; i+1 < len(vs); i++ {
+		pt.mesh.Faces = append(pt.mesh.Faces, [3]int{vs[0], vs[i], vs[i+1]})
+	}
+}
+
+// build makes the model's meshes from the parts that were read.
+func (p *parser) build() *Model {
+	if len(p.order) == 0 {
+		p.fail("model has no faces")
+	}
+	var ss []trace.Surface
+	for _, pt := range p.order {
+		if !pt.uvs {
+			pt.mesh.UVs = nil
+		}
+		m := p.opts.Material
+		if m == nil {
+			m = p.model.Materials[pt.key.material]
+		}
+		if m == nil {
+			m = trace.NewLambert(trace.NewUniform(0.8, 0.8, 0.8))
+		}
+		mesh, err := trace.NewTriangleMesh(pt.mesh, m)
+		if err != nil {
+			// a part can be left without any area, like a group of lines drawn as faces.
+			// that's only a problem if the whole model is.
+			continue
+		}
+		p.model.Parts = append(p.model.Parts, Part{
+			Object:   pt.key.object,
+			Group:    pt.key.group,
+			Material: pt.key.material,
+			Mesh:     mesh,
+		})
+		ss = append(ss, mesh)
+	}
+	switch len(ss) {
+	case 0:
+		p.line = p.order[0].line
+		p.fail("model has no faces with any area")
+	case 1:
+		p.model.Surface = ss[0]
+	default:
+		p.model.Surface = trace.NewBVH(0, 1, ss...)
+	}
+	return p.model
+}
@@ -0,0 +1,166 @@
+package obj
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+func TestLoad(t *testing.T) {
+	m, err := Load("testdata/shapes.obj", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("parts", func(t *testing.T) {
+		want := []struct {
+			object, group, material string
+			tris                    int
+		}{
+			{"pentagon", "", "matte", 3}, // a fan of three triangles
+			{"square", "top", "textured", 2},
+			{"square", "corner", "undefined", 1},
+		}
+		if len(m.Parts) != len(want) {
+			t.Fatalf("got %d parts, want %d", len(m.Parts), len(want))
+		}
+		for i, w := range want {
+			p := m.Parts[i]
+			if p.Object != w.object || p.Group != w.group || p.Material != w.material {
+				t.Errorf("part %d is %q, %q, %q, want %q, %q, %q", i, p.Object, p.Group, p.Material, w.object, w.group, w.material)
+			}
+			if n := len(p.Mesh.Triangles()); n != w.tris {
+				t.Errorf("part %d has %d triangles, want %d", i, n, w.tris)
+			}
+		}
+	})
+
+	t.Run("hits", func(t *testing.T) {
+		tests := []struct {
+			name string
+			at   geom.Vec // where a ray straight down from just above hits, or would hit
+			part int      // the part it hits, or -1 for a miss
+			uv   geom.Vec
+		}{
+			// every corner of the pentagon's fan is covered.
+			{"pentagon near first vertex", geom.Vec{0.1, 0.05, 0}, 0, geom.Vec{}},
+			{"pentagon near third vertex", geom.Vec{2.9, 1.5, 0}, 0, geom.Vec{}},
+			{"pentagon near last vertex", geom.Vec{-0.9, 1.5, 0}, 0, geom.Vec{}},
+			{"beside pentagon", geom.Vec{2.5, 2.5, 0}, -1, geom.Vec{}},
+			// the square's negative indices refer back to its own vertices, uvs, and normal.
+			{"square", geom.Vec{0.75, 0.25, 1}, 1, geom.Vec{0.75, 0.25, 0}},
+			{"square corner", geom.Vec{0.1, 0.2, 1}, 1, geom.Vec{0.1, 0.2, 0}},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				r := trace.NewRay(test.at.Plus(geom.Vec{0, 0, 0.5}), geom.Vec{0, 0, -1}.Unit(), 0)
+				hit := m.Surface.Hit(r, 0, math.MaxFloat64, nil)
+				if test.part < 0 {
+					if hit != nil {
+						t.Fatalf("got a hit at %v, want a miss", hit.Pt)
+					}
+					return
+				}
+				if hit == nil {
+					t.Fatal("missed")
+				}
+				if hit.Surface != m.Parts[test.part].Mesh {
+					t.Errorf("hit another part than %d", test.part)
+				}
+				if hit.Pt.Minus(test.at).Len() > 1e-9 {
+					t.Errorf("hit at %v, want %v", hit.Pt, test.at)
+				}
+				if hit.Norm != (geom.Vec{0, 0, 1}.Unit()) {
+					t.Errorf("normal %v, want 0,0,1", hit.Norm)
+				}
+				if test.part == 1 && hit.UV.Minus(test.uv).Len() > 1e-9 {
+					t.Errorf("uv %v, want %v", hit.UV, test.uv)
+				}
+			})
+		}
+	})
+
+	t.Run("materials", func(t *testing.T) {
+		tests := []struct {
+			name string
+			want trace.Material
+		}{
+			{"matte", &trace.Lambert{}},
+			{"shiny", &trace.Metal{}},
+			{"lamp", &trace.Light{}},
+			{"glass", &trace.Dielectric{}},
+			{"textured", &trace.Lambert{}},
+		}
+		if len(m.Materials) != len(tests) {
+			t.Errorf("got %d materials, want %d", len(m.Materials), len(tests))
+		}
+		for _, test := range tests {
+			got, ok := m.Materials[test.name]
+			if !ok {
+				t.Errorf("%s: missing", test.name)
+				continue
+			}
+			if g, w := fmt.Sprintf("%T", got), fmt.Sprintf("%T", test.want); g != w {
+				t.Errorf("%s: got a %s, want a %s", test.name, g, w)
+			}
+		}
+		albedo := func(name string, uv geom.Vec) trace.Color {
+			return m.Materials[name].(trace.Albedoer).Albedo(uv, geom.Vec{})
+		}
+		if c := albedo("matte", geom.Vec{}); c != (trace.Color{0.2, 0.4, 0.6}) {
+			t.Errorf("matte: got albedo %v, want 0.2, 0.4, 0.6", c)
+		}
+		// the texture's top left pixel is red, and it repeats outside uvs of 0 to 1.
+		for _, uv := range []geom.Vec{{0.25, 0.75, 0}, {1.25, -0.25, 0}} {
+			if c := albedo("textured", uv); c.R() < 0.9 || c.G() > 0.1 || c.B() > 0.1 {
+				t.Errorf("textured at %v: got albedo %v, want red", uv, c)
+			}
+		}
+	})
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"two vertices", "v 0 0 0\nv 1 0 0\nf 1 2\n", "test.obj:3: face should have at least 3 vertices, not 2"},
+		{"missing vertex", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n", "test.obj:4: face refers to vertex 4, but there are 3 so far"},
+		{"negative too far", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf -1 -2 -4\n", "test.obj:4: face refers to vertex -4, but there are 3 so far"},
+		{"later vertex", "v 0 0 0\nv 1 0 0\nf 1 2 3\nv 0 1 0\n", "test.obj:3: face refers to vertex 3, but there are 2 so far"},
+		{"no faces", "v 0 0 0\n", "model has no faces"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(test.src), "test.obj", Options{Material: trace.NewLambert(trace.NewUniform(1, 1, 1))})
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var opened []string
+	open := func(path string) (io.ReadCloser, error) {
+		opened = append(opened, path)
+		if filepath.Base(path) == "checker.png" {
+			return nil, errors.New("not allowed")
+		}
+		return os.Open(path)
+	}
+	_, err := Load("testdata/shapes.obj", Options{Open: open})
+	if want := filepath.Join("testdata", "shapes.mtl") + ":19: not allowed"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	if want := []string{filepath.Join("testdata", "shapes.mtl"), filepath.Join("testdata", "checker.png")}; fmt.Sprint(opened) != fmt.Sprint(want) {
+		t.Errorf("opened %v, want %v", opened, want)
+	}
+}
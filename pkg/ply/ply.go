@@ -0,0 +1,427 @@
+/*
+Package ply loads polygon meshes from PLY (Stanford triangle format) files,
+in ASCII or in little- or big-endian binary.
+
+A file's "vertex" elements may have positions (x, y, z), normals (nx, ny, nz),
+colors (red, green, blue), and texture coordinates (u, v, or s, t).
+Its "face" elements each have a list of vertex indices ("vertex_indices" or "vertex_index"),
+and faces of more than three vertices are split into triangles.
+Other elements and properties are skipped.
+
+Integer colors are scaled from their type's range to 0 to 1, and floating-point colors are used as they are.
+*/
+package ply
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Model is a loaded PLY mesh.
+type Model struct {
+	// Mesh is the model's geometry. Its Norms and UVs are empty if the file doesn't have them.
+	Mesh trace.Mesh
+	// Colors are the colors of the mesh's vertices, or nil if the file doesn't have them.
+	Colors []trace.Color
+}
+
+// Load loads the PLY file at path.
+func Load(path string) (*Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f, path)
+}
+
+// Read reads a PLY file from r. name is used in error messages.
+func Read(r io.Reader, name string) (*Model, error) {
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	var vr valueReader
+	switch h.format {
+	case "ascii":
+		vr = &asciiReader{r: br}
+	case "binary_little_endian":
+		vr = &binaryReader{r: br, order: binary.LittleEndian}
+	case "binary_big_endian":
+		vr = &binaryReader{r: br, order: binary.BigEndian}
+	}
+	m, err := h.read(vr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return m, nil
+}
+
+// Surface returns a TriangleMesh of the model with material mat.
+// If colors is true, or the model has colors but no uvs, the mesh's uvs are its colors,
+// which a VertexColors texture maps.
+func (m *Model) Surface(mat trace.Material, colors bool) (*trace.TriangleMesh, error) {
+	mesh := m.Mesh
+	if colors || (len(mesh.UVs) == 0 && len(m.Colors) > 0) {
+		if len(m.Colors) == 0 {
+			return nil, errors.New("model has no vertex colors")
+		}
+		var err error
+		if mesh, err = mesh.WithColors(m.Colors); err != nil {
+			return nil, err
+		}
+	}
+	return trace.NewTriangleMesh(mesh, mat)
+}
+
+// header describes the contents of a PLY file.
+type header struct {
+	format   string
+	elements []*element
+}
+
+type element struct {
+	name  string
+	count int
+	props []property
+}
+
+// property is a property of an element.
+// Lists have a count type, which is the type of their length, and their type is the type of their items.
+type property struct {
+	name, typ, countTyp string
+}
+
+// sizes are the sizes in bytes of each type, by all of their names.
+var sizes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4,
+	"float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+func readHeader(r *bufio.Reader) (*header, error) {
+	var h header
+	line := 0
+	fail := func(format string, args ...interface{}) (*header, error) {
+		return nil, fmt.Errorf("header line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+	for {
+		s, err := r.ReadString('\n')
+		line++
+		if err == io.EOF {
+			return fail("file ends before end_header")
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(s)
+		if line == 1 {
+			if len(fields) != 1 || fields[0] != "ply" {
+				return fail("not a PLY file")
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "format":
+			if len(fields) != 3 {
+				return fail("format should be a format and a version")
+			}
+			switch fields[1] {
+			case "ascii", "binary_little_endian", "binary_big_endian":
+				h.format = fields[1]
+			default:
+				return fail("unknown format %q", fields[1])
+			}
+		case "element":
+			if len(fields) != 3 {
+				return fail("element should be a name and a count")
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil || n < 0 {
+				return fail("element %s has count %q", fields[1], fields[2])
+			}
+			h.elements = append(h.elements, &element{name: fields[1], count: n})
+		case "property":
+			if len(h.elements) == 0 {
+				return fail("property comes before any element")
+			}
+			e := h.elements[len(h.elements)-1]
+			var p property
+			switch {
+			case len(fields) == 5 && fields[1] == "list":
+				p = property{countTyp: fields[2], typ: fields[3], name: fields[4]}
+				if _, ok := sizes[p.countTyp]; !ok {
+					return fail("property %s has unknown type %q", p.name, p.countTyp)
+				}
+			case len(fields) == 3:
+				p = property{typ: fields[1], name: fields[2]}
+			default:
+				return fail("property should be a type and a name")
+			}
+			if _, ok := sizes[p.typ]; !ok {
+				return fail("property %s has unknown type %q", p.name, p.typ)
+			}
+			e.props = append(e.props, p)
+		case "comment", "obj_info":
+		case "end_header":
+			if h.format == "" {
+				return fail("header has no format")
+			}
+			return &h, nil
+		default:
+			return fail("unknown header line %q", fields[0])
+		}
+	}
+}
+
+// read reads the elements that h describes from vr.
+func (h *header) read(vr valueReader) (*Model, error) {
+	var m Model
+	var verts *element
+	for _, e := range h.elements {
+		switch e.name {
+		case "vertex":
+			if err := readVertices(e, vr, &m); err != nil {
+				return nil, err
+			}
+			verts = e
+		case "face":
+			if verts == nil {
+				return nil, errors.New("faces come before vertices")
+			}
+			if err := readFaces(e, vr, &m); err != nil {
+				return nil, err
+			}
+		default:
+			for i := 0; i < e.count; i++ {
+				for _, p := range e.props {
+					if _, _, err := readProperty(vr, p); err != nil {
+						return nil, fmt.Errorf("%s %d: %v", e.name, i, err)
+					}
+				}
+			}
+		}
+	}
+	if verts == nil {
+		return nil, errors.New("file has no vertices")
+	}
+	return &m, nil
+}
+
+// readProperty reads property p, returning its value, or the items of a list.
+func readProperty(vr valueReader, p property) (v float64, list []float64, err error) {
+	if p.countTyp == "" {
+		v, err = vr.value(p.typ)
+		return v, nil, err
+	}
+	n, err := vr.value(p.countTyp)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n < 0 || n != math.Trunc(n) {
+		return 0, nil, fmt.Errorf("%s has length %g", p.name, n)
+	}
+	list = make([]float64, int(n))
+	for i := range list {
+		if list[i], err = vr.value(p.typ); err != nil {
+			return 0, nil, err
+		}
+	}
+	return 0, list, nil
+}
+
+// colorScale is the value of a full color channel of each type.
+var colorScale = map[string]float64{
+	"char": 127, "int8": 127, "uchar": 255, "uint8": 255,
+	"short": 32767, "int16": 32767, "ushort": 65535, "uint16": 65535,
+	"int": math.MaxInt32, "int32": math.MaxInt32, "uint": math.MaxUint32, "uint32": math.MaxUint32,
+	"float": 1, "float32": 1, "double": 1, "float64": 1,
+}
+
+// readVertices reads vertex element e into m.
+func readVertices(e *element, vr valueReader, m *Model) error {
+	// slots maps each property to its place in a vertex's values:
+	// position 0-2, normal 3-5, color 6-8, and uv 9-10.
+	slots := map[string]int{
+		"x": 0, "y": 1, "z": 2, "nx": 3, "ny": 4, "nz": 5,
+		"red": 6, "green": 7, "blue": 8, "r": 6, "g": 7, "b": 8,
+		"diffuse_red": 6, "diffuse_green": 7, "diffuse_blue": 8,
+		"u": 9, "v": 10, "s": 9, "t": 10, "texture_u": 9, "texture_v": 10,
+	}
+	slot := make([]int, len(e.props))
+	var has [11]bool
+	var scale [11]float64
+	for i, p := range e.props {
+		s, ok := slots[p.name]
+		if !ok || p.countTyp != "" {
+			slot[i] = -1
+			continue
+		}
+		slot[i] = s
+		has[s] = true
+		scale[s] = 1
+		if s >= 6 && s <= 8 {
+			scale[s] = colorScale[p.typ]
+		}
+	}
+	if !has[0] || !has[1] || !has[2] {
+		return errors.New("vertices need x, y, and z")
+	}
+	norms := has[3] && has[4] && has[5]
+	colors := has[6] && has[7] && has[8]
+	uvs := has[9] && has[10]
+
+	m.Mesh.Verts = make([]geom.Vec, e.count)
+	if norms {
+		m.Mesh.Norms = make([]geom.Unit, e.count)
+	}
+	if colors {
+		m.Colors = make([]trace.Color, e.count)
+	}
+	if uvs {
+		m.Mesh.UVs = make([]geom.Vec, e.count)
+	}
+	var vals [11]float64
+	for i := 0; i < e.count; i++ {
+		for j, p := range e.props {
+			v, _, err := readProperty(vr, p)
+			if err != nil {
+				return fmt.Errorf("vertex %d: %v", i, err)
+			}
+			if s := slot[j]; s >= 0 {
+				vals[s] = v / scale[s]
+			}
+		}
+		m.Mesh.Verts[i] = geom.Vec{vals[0], vals[1], vals[2]}
+		if n := (geom.Vec{vals[3], vals[4], vals[5]}); norms && n.LenSq() > 0 {
+			m.Mesh.Norms[i] = n.Unit()
+		}
+		if colors {
+			m.Colors[i] = trace.Color{vals[6], vals[7], vals[8]}
+		}
+		if uvs {
+			m.Mesh.UVs[i] = geom.Vec{vals[9], vals[10], 0}
+		}
+	}
+	return nil
+}
+
+// readFaces reads face element e into m, splitting polygons into fans of triangles.
+func readFaces(e *element, vr valueReader, m *Model) error {
+	for i := 0; i < e.count; i++ {
+		for _, p := range e.props {
+			_, list, err := readProperty(vr, p)
+			if err != nil {
+				return fmt.Errorf("face %d: %v", i, err)
+			}
+			if p.name != "vertex_indices" && p.name != "vertex_index" {
+				continue
+			}
+			if p.countTyp == "" {
+				return fmt.Errorf("face %s should be a list", p.name)
+			}
+			if len(list) < 3 {
+				return fmt.Errorf("face %d has %d vertices", i, len(list))
+			}
+			vs := make([]int, len(list))
+			for j, v := range list {
+				if v < 0 || int(v) >= len(m.Mesh.Verts) {
+					return fmt.Errorf("face %d refers to vertex %g, but there are %d", i, v, len(m.Mesh.Verts))
+				}
+				vs[j] = int(v)
+			}
+			for j := 1; j+1 < len(vs); j++ {
+				m.Mesh.Faces = append(m.Mesh.Faces, [3]int{vs[0], vs[j], vs[j+1]})
+			}
+		}
+	}
+	return nil
+}
+
+// valueReader reads the values of a PLY file's elements, one at a time.
+type valueReader interface {
+	value(typ string) (float64, error)
+}
+
+// asciiReader reads values written as text, separated by whitespace.
+type asciiReader struct {
+	r *bufio.Reader
+}
+
+func (a *asciiReader) value(typ string) (float64, error) {
+	var word []byte
+	for {
+		c, err := a.r.ReadByte()
+		if err == io.EOF && len(word) > 0 {
+			break
+		}
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			if len(word) > 0 {
+				break
+			}
+			continue
+		}
+		word = append(word, c)
+	}
+	v, err := strconv.ParseFloat(string(word), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a number", word)
+	}
+	return v, nil
+}
+
+// binaryReader reads values in binary, in byte order order.
+type binaryReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	buf   [8]byte
+}
+
+func (b *binaryReader) value(typ string) (float64, error) {
+	n := sizes[typ]
+	if _, err := io.ReadFull(b.r, b.buf[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	buf := b.buf[:n]
+	switch typ {
+	case "char", "int8":
+		return float64(int8(buf[0])), nil
+	case "uchar", "uint8":
+		return float64(buf[0]), nil
+	case "short", "int16":
+		return float64(int16(b.order.Uint16(buf))), nil
+	case "ushort", "uint16":
+		return float64(b.order.Uint16(buf)), nil
+	case "int", "int32":
+		return float64(int32(b.order.Uint32(buf))), nil
+	case "uint", "uint32":
+		return float64(b.order.Uint32(buf)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(b.order.Uint32(buf))), nil
+	}
+	return math.Float64frombits(b.order.Uint64(buf)), nil
+}
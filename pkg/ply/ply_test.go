@@ -0,0 +1,62 @@
+package ply
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+func TestLoad(t *testing.T) {
+	z := geom.Vec{0, 0, 1}.Unit()
+	want := &Model{
+		Mesh: trace.Mesh{
+			Verts: []geom.Vec{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {2, 0.5, 0}},
+			Norms: []geom.Unit{z, z, z, z, z},
+			UVs:   []geom.Vec{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {1.5, 0.5, 0}},
+			// the square is split into a fan of two triangles.
+			Faces: [][3]int{{0, 1, 2}, {0, 2, 3}, {1, 4, 2}},
+		},
+		Colors: []trace.Color{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, 1, 1}, {0, 0, 0}},
+	}
+	for _, name := range []string{"shapes_ascii.ply", "shapes_le.ply", "shapes_be.ply"} {
+		t.Run(name, func(t *testing.T) {
+			m, err := Load("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, want) {
+				t.Errorf("got %+v, want %+v", m, want)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	const head = "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n"
+	tests := []struct {
+		name, src, want string
+	}{
+		{"not ply", "solid\n", "test.ply: header line 1: not a PLY file"},
+		{"no end", "ply\nformat ascii 1.0\n", "test.ply: header line 3: file ends before end_header"},
+		{"format", "ply\nformat binary_middle_endian 1.0\nend_header\n", `unknown format "binary_middle_endian"`},
+		{"type", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float128 x\nend_header\n", `property x has unknown type "float128"`},
+		{"no position", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nend_header\n0\n", "vertices need x, y, and z"},
+		{"short", head + "end_header\n0 0 0\n1 0 0\n", "vertex 2: unexpected EOF"},
+		{"not a number", head + "end_header\n0 0 0\n1 0 x\n0 1 0\n", `vertex 1: "x" isn't a number`},
+		{"face list", head + "element face 1\nproperty int vertex_indices\nend_header\n0 0 0 1 0 0 0 1 0\n0\n", "face vertex_indices should be a list"},
+		{"face vertices", head + "element face 1\nproperty list uchar int vertex_indices\nend_header\n0 0 0 1 0 0 0 1 0\n2 0 1\n", "face 0 has 2 vertices"},
+		{"face index", head + "element face 1\nproperty list uchar int vertex_indices\nend_header\n0 0 0 1 0 0 0 1 0\n3 0 1 3\n", "face 0 refers to vertex 3, but there are 3"},
+		{"faces first", "ply\nformat ascii 1.0\nelement face 0\nproperty list uchar int vertex_indices\n" + head[len("ply\nformat ascii 1.0\n"):] + "end_header\n", "faces come before vertices"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(test.src), "test.ply")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Package preview draws images in a terminal, for a quick look at a render
+without a GUI or copying files around.
+
+Blocks mode draws two pixels in each character cell with the upper half block (▀),
+coloring its foreground and background with 24-bit ANSI escape codes.
+Sixel mode draws real pixels in terminals that support DEC sixel graphics.
+
+A Preview redraws its image in place, so it can show a progressive render as it improves.
+*/
+package preview
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+)
+
+// Mode is how a Preview draws its image.
+type Mode int
+
+// Modes.
+const (
+	Blocks Mode = iota
+	Sixel
+)
+
+// ParseMode returns the mode with the given name: "blocks", "sixel",
+// or "auto", which picks sixel if Detect finds that the terminal supports it.
+func ParseMode(name string) (Mode, error) {
+	switch strings.ToLower(name) {
+	case "blocks":
+		return Blocks, nil
+	case "sixel":
+		return Sixel, nil
+	case "auto":
+		return Detect(), nil
+	}
+	return Blocks, fmt.Errorf("unknown preview mode %q", name)
+}
+
+// String returns the name of the mode.
+func (m Mode) String() string {
+	switch m {
+	case Blocks:
+		return "blocks"
+	case Sixel:
+		return "sixel"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// sixelTerms are terminals, by $TERM or $TERM_PROGRAM, that are known to support sixel graphics.
+var sixelTerms = []string{"mlterm", "foot", "wezterm", "contour", "yaft", "mintty", "iterm.app", "konsole"}
+
+// Detect guesses whether the terminal supports sixel graphics from the environment,
+// and returns Sixel if it does, or Blocks otherwise.
+// Asking the terminal itself would need raw access to it, which a render writing to stdout can't assume.
+func Detect() Mode {
+	term := strings.ToLower(os.Getenv("TERM"))
+	program := strings.ToLower(os.Getenv("TERM_PROGRAM"))
+	if strings.Contains(term, "sixel") {
+		return Sixel
+	}
+	for _, t := range sixelTerms {
+		if strings.HasPrefix(term, t) || program == t {
+			return Sixel
+		}
+	}
+	return Blocks
+}
+
+// cellWidth and cellHeight are the size in pixels assumed for a character cell in sixel mode.
+// cellHeight is on the small side, so that the space reserved for an image is enough to hold it.
+const (
+	cellWidth  = 8
+	cellHeight = 12
+)
+
+// Preview draws an image in a terminal, again and again, in the same place.
+type Preview struct {
+	w     io.Writer
+	mode  Mode
+	cols  int
+	lines int // lines moved down by the last drawing
+}
+
+// New returns a Preview that draws to w in mode m, cols character cells wide.
+func New(w io.Writer, m Mode, cols int) *Preview {
+	if cols < 1 {
+		cols = 1
+	}
+	return &Preview{w: w, mode: m, cols: cols}
+}
+
+// Draw draws im, scaled to the preview's width, over the previous drawing.
+// The cursor is left at the start of the line below the image.
+func (p *Preview) Draw(im image.Image) error {
+	b := im.Bounds()
+	if b.Empty() {
+		return nil
+	}
+	bw := bufio.NewWriter(p.w)
+	if p.lines > 0 {
+		fmt.Fprintf(bw, "\r\x1b[%dA", p.lines)
+	}
+	switch p.mode {
+	case Sixel:
+		width := p.cols * cellWidth
+		height := width * b.Dy() / b.Dx()
+		if height < 1 {
+			height = 1
+		}
+		lines := (height + cellHeight - 1) / cellHeight
+		if p.lines == 0 {
+			// reserve the lines first, so that drawing doesn't scroll the terminal
+			// and the next drawing can find its way back.
+			fmt.Fprintf(bw, "%s\x1b[%dA", strings.Repeat("\n", lines), lines)
+		}
+		// save the cursor, draw, and move to the line below the reserved space.
+		fmt.Fprint(bw, "\x1b7")
+		writeSixel(bw, scale(im, width, height))
+		fmt.Fprintf(bw, "\x1b8\x1b[%dB\r", lines)
+		p.lines = lines
+	default:
+		rows := (p.cols*b.Dy()/b.Dx() + 1) / 2
+		if rows < 1 {
+			rows = 1
+		}
+		writeBlocks(bw, scale(im, p.cols, rows*2))
+		p.lines = rows
+	}
+	return bw.Flush()
+}
+
+// writeBlocks draws im with half blocks, two rows of pixels to each line of text.
+func writeBlocks(w io.Writer, im *image.RGBA) {
+	b := im.Bounds()
+	for y := 0; y < b.Dy(); y += 2 {
+		for x := 0; x < b.Dx(); x++ {
+			i := im.PixOffset(x, y)
+			top := im.Pix[i : i+3]
+			bottom := top
+			if y+1 < b.Dy() {
+				j := im.PixOffset(x, y+1)
+				bottom = im.Pix[j : j+3]
+			}
+			fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", top[0], top[1], top[2], bottom[0], bottom[1], bottom[2])
+		}
+		fmt.Fprint(w, "\x1b[0m\n")
+	}
+}
+
+// writeSixel draws im in sixels, with its colors reduced to a 6x6x6 color cube.
+func writeSixel(w io.Writer, im *image.RGBA) {
+	const levels = 6
+	b := im.Bounds()
+	fmt.Fprintf(w, "\x1bPq\"1;1;%d;%d", b.Dx(), b.Dy())
+	for i := 0; i < levels*levels*levels; i++ {
+		r, g, bl := i/(levels*levels), i/levels%levels, i%levels
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, r*100/(levels-1), g*100/(levels-1), bl*100/(levels-1))
+	}
+	q := func(v uint8) int { return (int(v)*(levels-1) + 127) / 255 }
+	index := make([]int, b.Dx()*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := im.Pix[im.PixOffset(x, y):]
+			index[y*b.Dx()+x] = q(c[0])*levels*levels + q(c[1])*levels + q(c[2])
+		}
+	}
+
+	// each band of six rows is drawn once for each color in it,
+	// returning to the start of the band ($) between colors.
+	bits := make([]byte, b.Dx())
+	for y0 := 0; y0 < b.Dy(); y0 += 6 {
+		used := make(map[int]bool)
+		var colors []int
+		for y := y0; y < y0+6 && y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				if c := index[y*b.Dx()+x]; !used[c] {
+					used[c] = true
+					colors = append(colors, c)
+				}
+			}
+		}
+		for n, c := range colors {
+			for x := range bits {
+				bits[x] = 0
+				for y := y0; y < y0+6 && y < b.Dy(); y++ {
+					if index[y*b.Dx()+x] == c {
+						bits[x] |= 1 << uint(y-y0)
+					}
+				}
+			}
+			if n > 0 {
+				fmt.Fprint(w, "$")
+			}
+			fmt.Fprintf(w, "#%d", c)
+			writeRuns(w, bits)
+		}
+		fmt.Fprint(w, "-")
+	}
+	fmt.Fprint(w, "\x1b\\")
+}
+
+// writeRuns writes a row of sixels, run-length encoding repeated characters.
+func writeRuns(w io.Writer, bits []byte) {
+	for i := 0; i < len(bits); {
+		j := i
+		for j < len(bits) && bits[j] == bits[i] {
+			j++
+		}
+		ch := bits[i] + '?'
+		if n := j - i; n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, ch)
+		} else {
+			fmt.Fprint(w, strings.Repeat(string(ch), n))
+		}
+		i = j
+	}
+}
+
+// scale resizes im to width x height, averaging the pixels that fall within each new pixel.
+func scale(im image.Image, width, height int) *image.RGBA {
+	b := im.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := im.At(sx, sy).RGBA()
+					r, g, bl, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), n+1
+				}
+			}
+			i := out.PixOffset(x, y)
+			out.Pix[i] = uint8(r / n >> 8)
+			out.Pix[i+1] = uint8(g / n >> 8)
+			out.Pix[i+2] = uint8(bl / n >> 8)
+			out.Pix[i+3] = 255
+		}
+	}
+	return out
+}
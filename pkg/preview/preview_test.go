@@ -0,0 +1,103 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// square returns a 2x2 image: red and green on top, blue and white below.
+func square() *image.RGBA {
+	im := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	im.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	im.Set(1, 0, color.RGBA{0, 255, 0, 255})
+	im.Set(0, 1, color.RGBA{0, 0, 255, 255})
+	im.Set(1, 1, color.RGBA{255, 255, 255, 255})
+	return im
+}
+
+func TestDrawBlocks(t *testing.T) {
+	var buf bytes.Buffer
+	p := New(&buf, Blocks, 2)
+	// one line of two cells, each with a top pixel in the foreground and a bottom one in the background.
+	const line = "\x1b[38;2;255;0;0m\x1b[48;2;0;0;255m▀\x1b[38;2;0;255;0m\x1b[48;2;255;255;255m▀\x1b[0m\n"
+	if err := p.Draw(square()); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != line {
+		t.Errorf("first drawing %q, want %q", got, line)
+	}
+	// later drawings move back up over the earlier one.
+	buf.Reset()
+	if err := p.Draw(square()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "\r\x1b[1A"+line; got != want {
+		t.Errorf("second drawing %q, want %q", got, want)
+	}
+}
+
+func TestDrawSixel(t *testing.T) {
+	var palette strings.Builder
+	for i := 0; i < 216; i++ {
+		fmt.Fprintf(&palette, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+	}
+	// one cell is 8 pixels wide, so each pixel is scaled to 4x4:
+	// the first band of six rows has four rows of the top colors and two of the bottom,
+	// and the second band has the last two rows of the bottom colors.
+	// red, green, blue, and white are colors 180, 30, 5, and 215 of the 6x6x6 cube.
+	sixel := "\x1bPq\"1;1;8;8" + palette.String() +
+		"#180!4N!4?$#30!4?!4N$#5!4o!4?$#215!4?!4o-" +
+		"#5!4B!4?$#215!4?!4B-" +
+		"\x1b\\"
+
+	var buf bytes.Buffer
+	p := New(&buf, Sixel, 1)
+	if err := p.Draw(square()); err != nil {
+		t.Fatal(err)
+	}
+	// the first drawing reserves its line, saves the cursor, draws, and moves below the image.
+	if got, want := buf.String(), "\n\x1b[1A\x1b7"+sixel+"\x1b8\x1b[1B\r"; got != want {
+		t.Errorf("first drawing\n%q, want\n%q", got, want)
+	}
+	buf.Reset()
+	if err := p.Draw(square()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "\r\x1b[1A\x1b7"+sixel+"\x1b8\x1b[1B\r"; got != want {
+		t.Errorf("second drawing\n%q, want\n%q", got, want)
+	}
+}
+
+func TestWriteRuns(t *testing.T) {
+	tests := []struct {
+		bits []byte
+		want string
+	}{
+		{[]byte{0, 1, 63}, "?@~"},
+		{[]byte{2, 2, 2}, "AAA"},
+		{[]byte{2, 2, 2, 2, 0}, "!4A?"},
+		{bytes.Repeat([]byte{5}, 300), "!300D"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		writeRuns(&buf, test.bits)
+		if got := buf.String(); got != test.want {
+			t.Errorf("writeRuns(%v) = %q, want %q", test.bits, got, test.want)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, m := range []Mode{Blocks, Sixel} {
+		if got, err := ParseMode(strings.ToUpper(m.String())); err != nil || got != m {
+			t.Errorf("ParseMode(%q) = %v, %v", m, got, err)
+		}
+	}
+	if _, err := ParseMode("kitty"); err == nil {
+		t.Error("got no error for an unknown mode")
+	}
+}
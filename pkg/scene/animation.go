@@ -0,0 +1,122 @@
+package scene
+
+import (
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Animation is the timeline of an animated scene.
+// Frame i starts at time i / FPS, when its shutter opens.
+type Animation struct {
+	FPS    float64
+	Frames int
+	// Shutter is the fraction of each frame's duration that the shutter is open,
+	// like 0.5 for a 180-degree shutter.
+	// Every frame blurs the same amount of motion, so motion blur is consistent from frame to frame.
+	Shutter float64
+	rig     rig
+}
+
+// Time returns the times at which the shutter opens and closes for frame i.
+func (a *Animation) Time(i int) (open, close float64) {
+	t := float64(i) / a.FPS
+	return t, t + a.Shutter/a.FPS
+}
+
+// Camera returns the camera for frame i.
+// Keyframed camera properties take their values from the middle of the frame's shutter interval.
+func (a *Animation) Camera(i int) *trace.Camera {
+	return a.rig.camera(a.Time(i))
+}
+
+// rig holds a camera's parameters, some of which may be keyframed.
+type rig struct {
+	from, at, up  geom.Vec
+	fov, aperture float64
+	focus         float64 // if zero, the camera focuses at the distance from "from" to "at"
+	shutter       [2]float64
+	tracks        map[string]trace.Track
+}
+
+// camera returns the camera for a shutter interval from t0 to t1.
+func (r rig) camera(t0, t1 float64) *trace.Camera {
+	t := (t0 + t1) / 2
+	from, at, fov := r.from, r.at, r.fov
+	if tr, ok := r.tracks["from"]; ok {
+		from = tr.At(t)
+	}
+	if tr, ok := r.tracks["at"]; ok {
+		at = tr.At(t)
+	}
+	if tr, ok := r.tracks["fov"]; ok {
+		fov = tr.At(t).X()
+	}
+	focus := r.focus
+	if focus == 0 {
+		focus = from.Minus(at).Len()
+	}
+	return trace.NewCamera(from, at, r.up.Unit(), fov, r.aperture, focus, t0, t1)
+}
+
+func (l *loader) animation(n *node) *Animation {
+	l.object(n, "animation")
+	a := &Animation{
+		FPS:     l.numberOr(n, "fps", 24, "animation"),
+		Shutter: l.numberOr(n, "shutter", 0.5, "animation"),
+	}
+	frames := l.number(l.require(n, "frames", "animation"), "animation frames")
+	if frames < 1 || frames != float64(int(frames)) {
+		l.fail(n.fields["frames"], "animation frames should be a whole number, at least 1, not %g", frames)
+	}
+	a.Frames = int(frames)
+	if a.FPS <= 0 {
+		l.fail(n.fields["fps"], "animation fps should be positive, not %g", a.FPS)
+	}
+	if a.Shutter < 0 || a.Shutter > 1 {
+		l.fail(n.fields["shutter"], "animation shutter should be between 0 and 1 frames, not %g", a.Shutter)
+	}
+	l.done(n, "animation")
+	return a
+}
+
+// keys parses an array of keyframes into a track for each property.
+// Each key has a "time", an optional "interpolation" to the next key ("linear" or "bezier"),
+// and values for any of props, which maps property names to their number of components (1 or 3).
+func (l *loader) keys(n *node, props map[string]int, what string) map[string]trace.Track {
+	if n.kind != arrayKind || len(n.elems) == 0 {
+		l.fail(n, "%s keys should be an array of keyframes", what)
+	}
+	tracks := make(map[string]trace.Track)
+	last := 0.0
+	for i, k := range n.elems {
+		l.object(k, what+" key")
+		t := l.number(l.require(k, "time", what+" key"), what+" key time")
+		if i > 0 && t <= last {
+			l.fail(k.fields["time"], "%s key times should increase, but %g follows %g", what, t, last)
+		}
+		last = t
+		interp := trace.Linear
+		if in := l.field(k, "interpolation"); in != nil {
+			var err error
+			if interp, err = trace.ParseInterpolation(l.str(in, "interpolation")); err != nil {
+				l.fail(in, "%v (expected linear or bezier)", err)
+			}
+		}
+		for _, name := range k.keys {
+			dims, ok := props[name]
+			if !ok {
+				continue
+			}
+			v := l.field(k, name)
+			var value geom.Vec
+			if dims == 1 {
+				value[0] = l.number(v, what+" key "+name)
+			} else {
+				value = l.vec(v, what+" key "+name)
+			}
+			tracks[name] = append(tracks[name], trace.Key{Time: t, Value: value, Interp: interp})
+		}
+		l.done(k, what+" key")
+	}
+	return tracks
+}
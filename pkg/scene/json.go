@@ -0,0 +1,175 @@
+package scene
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// kind is the JSON type of a node.
+type kind int
+
+const (
+	nullKind kind = iota
+	boolKind
+	numberKind
+	stringKind
+	arrayKind
+	objectKind
+)
+
+var kindNames = []string{"null", "a boolean", "a number", "a string", "an array", "an object"}
+
+// String describes the kind for error messages, like "a number".
+func (k kind) String() string {
+	return kindNames[k]
+}
+
+// node is a parsed JSON value that remembers where it appeared in its file,
+// so that errors found while building the scene can point back at it.
+type node struct {
+	kind   kind
+	offset int64
+	b      bool
+	num    float64
+	str    string
+	elems  []*node
+	keys   []string // object keys, in file order
+	fields map[string]*node
+	used   map[string]bool // object keys that the loader has read
+}
+
+// parse parses a single JSON value from data.
+func parse(data []byte) (*node, error) {
+	p := parser{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	p.dec.UseNumber()
+	n, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	off := p.start()
+	if _, err := p.dec.Token(); err != io.EOF {
+		return nil, &syntaxError{off, "unexpected data after the top-level value"}
+	}
+	return n, nil
+}
+
+// syntaxError is a malformed JSON file at a byte offset.
+type syntaxError struct {
+	offset int64
+	msg    string
+}
+
+func (e *syntaxError) Error() string {
+	return e.msg
+}
+
+type parser struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// start returns the offset of the next token,
+// skipping the whitespace and separators the decoder hasn't consumed yet.
+func (p *parser) start() int64 {
+	off := p.dec.InputOffset()
+	for off < int64(len(p.data)) {
+		switch p.data[off] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			off++
+			continue
+		}
+		break
+	}
+	return off
+}
+
+// token reads the next token, converting decoder errors to syntaxErrors.
+func (p *parser) token() (json.Token, int64, error) {
+	off := p.start()
+	t, err := p.dec.Token()
+	switch e := err.(type) {
+	case nil:
+		return t, off, nil
+	case *json.SyntaxError:
+		off := e.Offset
+		if strings.HasPrefix(e.Error(), "invalid character") {
+			off-- // the decoder has read past the invalid character
+		}
+		return nil, off, &syntaxError{off, e.Error()}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, int64(len(p.data)), &syntaxError{int64(len(p.data)), "unexpected end of file"}
+	}
+	return nil, off, &syntaxError{off, err.Error()}
+}
+
+func (p *parser) value() (*node, error) {
+	t, off, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+	n := &node{offset: off}
+	switch v := t.(type) {
+	case nil:
+		n.kind = nullKind
+	case bool:
+		n.kind, n.b = boolKind, v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, &syntaxError{off, fmt.Sprintf("invalid number %s", v)}
+		}
+		n.kind, n.num = numberKind, f
+	case string:
+		n.kind, n.str = stringKind, v
+	case json.Delim:
+		if v == '[' {
+			n.kind = arrayKind
+			for p.dec.More() {
+				e, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				n.elems = append(n.elems, e)
+			}
+		} else {
+			n.kind = objectKind
+			n.fields = make(map[string]*node)
+			n.used = make(map[string]bool)
+			for p.dec.More() {
+				t, off, err := p.token()
+				if err != nil {
+					return nil, err
+				}
+				key := t.(string)
+				if _, ok := n.fields[key]; ok {
+					return nil, &syntaxError{off, fmt.Sprintf("duplicate key %q", key)}
+				}
+				e, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key)
+				n.fields[key] = e
+			}
+		}
+		if _, _, err := p.token(); err != nil { // the closing ']' or '}'
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// position converts a byte offset within data to a 1-based line and column.
+func position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte{'\n'}) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
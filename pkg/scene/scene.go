@@ -0,0 +1,719 @@
+/*
+Package scene loads trace scenes from declarative JSON files,
+so that scenes can be changed without recompiling.
+
+Format
+
+A scene file is a JSON object with a camera, optional named textures and materials,
+and a list of surfaces:
+
+	{
+	  "camera": {"from": [278, 278, -800], "at": [278, 278, 0], "fov": 40},
+	  "textures": {
+	    "earth": {"type": "image", "file": "earthmap.jpg"}
+	  },
+	  "materials": {
+	    "white": {"type": "lambert", "texture": [0.73, 0.73, 0.73]},
+	    "light": {"type": "light", "texture": [15, 15, 15]}
+	  },
+	  "surfaces": [
+	    {"type": "rect", "min": [213, 554, 227], "max": [343, 554, 332], "material": "light"},
+	    {"type": "translate", "offset": [130, 0, 65], "surface":
+	      {"type": "box", "min": [0, 0, 0], "max": [165, 165, 165], "material": "white"}}
+	  ]
+	}
+
+The camera has "from", "at", "up" (default [0, 1, 0]), "fov" in degrees,
+"aperture" (default 0), "focus" (default the distance from "from" to "at"),
+and "shutter", the [open, close] times (default [0, 1]).
+
+Wherever a material is expected, a scene can use the name of one from "materials",
+or describe one inline.
+Materials are "lambert", "metal", "light", and "isotropic", which take a "texture"
+("metal" also takes a "roughness" from 0 to 1), and "dielectric", which takes a refractive "index".
+
+Likewise, a texture can be the name of one from "textures", an [r, g, b] color, or an inline texture.
+Textures are "uniform" ("color"), "checker" ("size", "odd", "even"),
+"bright" ("texture", "scale"), "image" ("file", relative to the scene file),
+"noise" ("scale", "turbulence", "axis", "seed"),
+and "vertexColors", the colors of a mesh's vertices, which need the mesh's uvs to be its colors.
+
+Surfaces are "sphere" ("center", "radius", and "center1" for a sphere that moves during "time"),
+"rect" and "box" ("min", "max"), "quad" ("corner", and "u" and "v", the vectors along its edges),
+"disk" ("center", "normal", "radius"), "plane" ("point", "normal"; it's infinite), "triangle" ("vertices", three points, counter-clockwise around its front),
+"mesh" ("vertices", "faces" of three vertex indices each, and optional per-vertex "normals" and [u, v] "uvs"),
+"obj" (a Wavefront OBJ "file", with an optional "material" to use instead of its own; see package obj),
+"ply" and "stl" (a mesh "file" and its "material"; a "ply" with vertex colors can set "colors"
+to use them as its uvs even if it has uvs, for a "vertexColors" texture),
+"gltf" (the meshes and materials of a glTF or GLB "file", without its cameras; see package gltf),
+"volume" ("boundary", "density", "material"),
+the transforms "translate" ("offset", "surface"), "rotateY" ("angle", "surface"), and "flip" ("surface"),
+and the groups "list" and "bvh" ("surfaces").
+The top-level surfaces are grouped into a BVH unless the scene sets "bvh" to false.
+
+Animation
+
+Animated scenes have an "animation" with a number of "frames", their "fps" (default 24),
+and "shutter", the fraction of each frame that the shutter is open (default 0.5).
+Their camera can have "keys", and "animate" surfaces ("surface", "keys") move a surface over time:
+
+	{"type": "animate", "surface": {"type": "box", "min": [-1, 0, -1], "max": [1, 2, 1], "material": "white"},
+	 "keys": [{"time": 0, "angle": 0}, {"time": 2, "angle": 360}]}
+
+Each key has a "time" in seconds, the "interpolation" to the next key ("linear", the default, or "bezier"),
+and values for any of the keyframed properties:
+the camera's "from", "at", and "fov", and an animated surface's "offset" and "angle"
+(its rotation on the Y axis, in degrees).
+*/
+package scene
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/gltf"
+	"github.com/hunterloftis/oneweekend/pkg/obj"
+	"github.com/hunterloftis/oneweekend/pkg/ply"
+	"github.com/hunterloftis/oneweekend/pkg/stl"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Scene is everything needed to render a scene file.
+type Scene struct {
+	Camera  *trace.Camera
+	Surface trace.Surface
+	// Materials are the scene's named materials.
+	Materials map[string]trace.Material
+	// Animation is the scene's timeline, or nil if the scene is a still.
+	// Camera is the camera of the animation's first frame.
+	Animation *Animation
+}
+
+// Error is a problem at a specific place in a scene file.
+type Error struct {
+	File string
+	Line int
+	Col  int
+	Msg  string
+}
+
+// Error returns the error's location and message, like "room.json:12:5: unknown material "wite"".
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+}
+
+// Load loads the scene file at path.
+// Files that the scene refers to, like images, are relative to the scene file's directory.
+func Load(path string) (*Scene, error) {
+	return LoadWithin(path, "")
+}
+
+// LoadWithin is like Load, but the scene can't refer to files outside of the directory root,
+// as when scenes come from untrusted sources. If root is empty, any file may be used.
+func LoadWithin(path, root string) (*Scene, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadWithin(f, path, root)
+}
+
+// Read reads a scene from r.
+// name is used in error messages, and relative file paths are resolved against its directory.
+func Read(r io.Reader, name string) (*Scene, error) {
+	return ReadWithin(r, name, "")
+}
+
+// ReadWithin is like Read, but the scene can't refer to files outside of the directory root.
+// If root is empty, any file may be used.
+func ReadWithin(r io.Reader, name, root string) (s *Scene, err error) {
+	if root != "" {
+		if root, err = filepath.Abs(root); err != nil {
+			return nil, err
+		}
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parse(data)
+	if err != nil {
+		e := err.(*syntaxError)
+		line, col := position(data, e.offset)
+		return nil, &Error{File: name, Line: line, Col: col, Msg: e.msg}
+	}
+	l := loader{
+		name:      name,
+		dir:       filepath.Dir(name),
+		root:      root,
+		data:      data,
+		textures:  make(map[string]trace.Mapper),
+		materials: make(map[string]trace.Material),
+		images:    make(map[string]*trace.Image),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			s, err = nil, e
+		}
+	}()
+	return l.scene(doc), nil
+}
+
+// loader builds a Scene from parsed JSON.
+// Its methods report problems by panicking with an *Error, which Read recovers.
+type loader struct {
+	name, dir    string
+	root         string // the absolute directory that files must be within, or "" for any
+	data         []byte
+	textures     map[string]trace.Mapper
+	materials    map[string]trace.Material
+	images       map[string]*trace.Image
+	time0, time1 float64
+}
+
+func (l *loader) fail(n *node, format string, args ...interface{}) {
+	line, col := position(l.data, n.offset)
+	panic(&Error{File: l.name, Line: line, Col: col, Msg: fmt.Sprintf(format, args...)})
+}
+
+// object checks that n is an object.
+func (l *loader) object(n *node, what string) *node {
+	if n.kind != objectKind {
+		l.fail(n, "%s should be an object, not %v", what, n.kind)
+	}
+	return n
+}
+
+// field returns the value of key in object n, or nil if it's missing.
+func (l *loader) field(n *node, key string) *node {
+	n.used[key] = true
+	return n.fields[key]
+}
+
+// require returns the value of key in object n, failing if it's missing.
+func (l *loader) require(n *node, key, what string) *node {
+	v := l.field(n, key)
+	if v == nil {
+		l.fail(n, "%s is missing %q", what, key)
+	}
+	return v
+}
+
+// done fails if object n has keys that weren't read, which are usually typos.
+func (l *loader) done(n *node, what string) {
+	for _, k := range n.keys {
+		if !n.used[k] {
+			l.fail(n.fields[k], "unknown %s field %q", what, k)
+		}
+	}
+}
+
+func (l *loader) number(n *node, what string) float64 {
+	if n.kind != numberKind {
+		l.fail(n, "%s should be a number, not %v", what, n.kind)
+	}
+	return n.num
+}
+
+// numberOr returns the number at key in object n, or def if it's missing.
+func (l *loader) numberOr(n *node, key string, def float64, what string) float64 {
+	v := l.field(n, key)
+	if v == nil {
+		return def
+	}
+	return l.number(v, what+" "+key)
+}
+
+func (l *loader) str(n *node, what string) string {
+	if n.kind != stringKind {
+		l.fail(n, "%s should be a string, not %v", what, n.kind)
+	}
+	return n.str
+}
+
+// numbers returns the elements of array n, which must be count numbers.
+func (l *loader) numbers(n *node, count int, what string) []float64 {
+	if n.kind != arrayKind || len(n.elems) != count {
+		l.fail(n, "%s should be an array of %d numbers", what, count)
+	}
+	fs := make([]float64, count)
+	for i, e := range n.elems {
+		fs[i] = l.number(e, what)
+	}
+	return fs
+}
+
+func (l *loader) vec(n *node, what string) geom.Vec {
+	v := l.numbers(n, 3, what)
+	return geom.Vec{v[0], v[1], v[2]}
+}
+
+// normal returns the direction of n, which must be a non-zero [x, y, z] vector.
+func (l *loader) normal(n *node, what string) geom.Unit {
+	v := l.vec(n, what)
+	if v.LenSq() == 0 {
+		l.fail(n, "%s can't be zero", what)
+	}
+	return v.Unit()
+}
+
+// vecs returns the elements of array n, which must each be an [x, y, z] vector.
+func (l *loader) vecs(n *node, what string) []geom.Vec {
+	if n.kind != arrayKind {
+		l.fail(n, "%s should be an array, not %v", what, n.kind)
+	}
+	vs := make([]geom.Vec, len(n.elems))
+	for i, e := range n.elems {
+		vs[i] = l.vec(e, what)
+	}
+	return vs
+}
+
+func (l *loader) scene(n *node) *Scene {
+	l.object(n, "scene")
+	var anim *Animation
+	if a := l.field(n, "animation"); a != nil {
+		anim = l.animation(a)
+	}
+	r := l.camera(l.require(n, "camera", "scene"), anim)
+	l.time0, l.time1 = r.shutter[0], r.shutter[1]
+	if anim != nil {
+		anim.rig = r
+		_, l.time1 = anim.Time(anim.Frames - 1)
+		l.time0 = 0
+	}
+	if t := l.field(n, "textures"); t != nil {
+		l.object(t, "textures")
+		for _, k := range t.keys {
+			l.textures[k] = l.texture(t.fields[k])
+		}
+	}
+	if m := l.field(n, "materials"); m != nil {
+		l.object(m, "materials")
+		for _, k := range m.keys {
+			l.materials[k] = l.material(m.fields[k])
+		}
+	}
+	ss := l.surfaces(l.require(n, "surfaces", "scene"), "scene surfaces")
+	bvh := true
+	if b := l.field(n, "bvh"); b != nil {
+		if b.kind != boolKind {
+			l.fail(b, "bvh should be true or false")
+		}
+		bvh = b.b
+	}
+	l.done(n, "scene")
+	s := &Scene{Camera: r.camera(r.shutter[0], r.shutter[1]), Materials: l.materials, Animation: anim}
+	if anim != nil {
+		s.Camera = anim.Camera(0)
+	}
+	if bvh {
+		s.Surface = trace.NewBVH(l.time0, l.time1, ss...)
+	} else {
+		s.Surface = trace.NewList(ss...)
+	}
+	return s
+}
+
+// camera parses a camera into a rig, which can build the camera for any shutter interval.
+// Animated scenes may keyframe the camera's "from", "at", and "fov".
+func (l *loader) camera(n *node, anim *Animation) rig {
+	l.object(n, "camera")
+	from := l.vec(l.require(n, "from", "camera"), "camera from")
+	at := l.vec(l.require(n, "at", "camera"), "camera at")
+	if from == at {
+		l.fail(n, "camera from and at are the same point, so the camera has no direction")
+	}
+	up := geom.Vec{0, 1, 0}
+	if u := l.field(n, "up"); u != nil {
+		up = l.vec(u, "camera up")
+	}
+	if up.Cross(from.Minus(at)).LenSq() == 0 {
+		l.fail(n, "camera up %v is parallel to the view direction", up)
+	}
+	fov := l.number(l.require(n, "fov", "camera"), "camera fov")
+	if fov <= 0 || fov >= 180 {
+		l.fail(n.fields["fov"], "camera fov should be between 0 and 180 degrees, not %g", fov)
+	}
+	aperture := l.numberOr(n, "aperture", 0, "camera")
+	if aperture < 0 {
+		l.fail(n.fields["aperture"], "camera aperture can't be negative")
+	}
+	focus := l.numberOr(n, "focus", 0, "camera")
+	if focus < 0 || (focus == 0 && n.fields["focus"] != nil) {
+		l.fail(n.fields["focus"], "camera focus distance should be positive")
+	}
+	r := rig{from: from, at: at, up: up, fov: fov, aperture: aperture, focus: focus, shutter: [2]float64{0, 1}}
+	if sh := l.field(n, "shutter"); sh != nil {
+		if anim != nil {
+			l.fail(sh, "animated scenes set the shutter in their animation, not their camera")
+		}
+		t := l.numbers(sh, 2, "camera shutter")
+		if t[1] < t[0] {
+			l.fail(sh, "camera shutter closes (%g) before it opens (%g)", t[1], t[0])
+		}
+		r.shutter = [2]float64{t[0], t[1]}
+	}
+	if k := l.field(n, "keys"); k != nil {
+		if anim == nil {
+			l.fail(k, "camera keys need an animation")
+		}
+		r.tracks = l.keys(k, map[string]int{"from": 3, "at": 3, "fov": 1}, "camera")
+		for _, key := range r.tracks["fov"] {
+			if fov := key.Value.X(); fov <= 0 || fov >= 180 {
+				l.fail(k, "camera fov at time %g should be between 0 and 180 degrees, not %g", key.Time, fov)
+			}
+		}
+	}
+	l.done(n, "camera")
+	return r
+}
+
+// texture builds a texture from a name, an [r, g, b] color, or an inline description.
+func (l *loader) texture(n *node) trace.Mapper {
+	switch n.kind {
+	case stringKind:
+		t, ok := l.textures[n.str]
+		if !ok {
+			l.fail(n, "unknown texture %q", n.str)
+		}
+		return t
+	case arrayKind:
+		c := l.numbers(n, 3, "texture color")
+		return trace.NewUniform(c[0], c[1], c[2])
+	}
+	l.object(n, "texture")
+	var t trace.Mapper
+	switch typ := l.str(l.require(n, "type", "texture"), "texture type"); typ {
+	case "uniform":
+		c := l.numbers(l.require(n, "color", "uniform texture"), 3, "uniform color")
+		t = trace.NewUniform(c[0], c[1], c[2])
+	case "checker":
+		size := l.number(l.require(n, "size", "checker texture"), "checker size")
+		odd := l.texture(l.require(n, "odd", "checker texture"))
+		even := l.texture(l.require(n, "even", "checker texture"))
+		t = trace.NewChecker(size, odd, even)
+	case "bright":
+		src := l.texture(l.require(n, "texture", "bright texture"))
+		t = trace.NewBright(src, l.number(l.require(n, "scale", "bright texture"), "bright scale"))
+	case "image":
+		t = l.image(l.require(n, "file", "image texture"))
+	case "noise":
+		scale := l.numberOr(n, "scale", 1, "noise")
+		turb := l.numberOr(n, "turbulence", 1, "noise")
+		axis := l.numberOr(n, "axis", 0, "noise")
+		if axis != 0 && axis != 1 && axis != 2 {
+			l.fail(n.fields["axis"], "noise axis should be 0, 1, or 2 (x, y, or z), not %g", axis)
+		}
+		p := trace.NewPerlin(int64(l.numberOr(n, "seed", 0, "noise")))
+		t = trace.NewPerlinNoise(p, scale, turb, int(axis))
+	case "vertexColors":
+		t = trace.NewVertexColors()
+	default:
+		l.fail(n.fields["type"], "unknown texture type %q (expected uniform, checker, bright, image, noise, or vertexColors)", typ)
+	}
+	l.done(n, "texture")
+	return t
+}
+
+// path returns the file named by n, relative to the scene file's directory.
+// It fails if the file is outside of the loader's root.
+func (l *loader) path(n *node, what string) string {
+	path := l.str(n, what)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(l.dir, path)
+	}
+	if l.root != "" && !within(l.root, path) {
+		l.fail(n, "%s %q is outside the scene's root directory", what, l.str(n, what))
+	}
+	return path
+}
+
+// open opens a file that a model or glTF scene refers to, if it's within the loader's root.
+func (l *loader) open(path string) (io.ReadCloser, error) {
+	if l.root != "" && !within(l.root, path) {
+		return nil, fmt.Errorf("%s is outside the scene's root directory", path)
+	}
+	return os.Open(path)
+}
+
+// within reports whether path is root or a file or directory inside it.
+// Symbolic links within root are trusted, wherever they lead.
+func within(root, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// image loads the image file named by n, sharing images that are used more than once.
+func (l *loader) image(n *node) *trace.Image {
+	path := l.path(n, "image file")
+	if img, ok := l.images[path]; ok {
+		return img
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		l.fail(n, "%v", err)
+	}
+	img, err := trace.NewImage(f)
+	if err != nil {
+		l.fail(n, "reading image %s: %v", path, err)
+	}
+	l.images[path] = img
+	return img
+}
+
+// material builds a material from a name or an inline description.
+func (l *loader) material(n *node) trace.Material {
+	if n.kind == stringKind {
+		m, ok := l.materials[n.str]
+		if !ok {
+			l.fail(n, "unknown material %q", n.str)
+		}
+		return m
+	}
+	l.object(n, "material")
+	var m trace.Material
+	switch typ := l.str(l.require(n, "type", "material"), "material type"); typ {
+	case "lambert":
+		m = trace.NewLambert(l.texture(l.require(n, "texture", "lambert material")))
+	case "metal":
+		t := l.texture(l.require(n, "texture", "metal material"))
+		rough := l.numberOr(n, "roughness", 0, "metal")
+		if rough < 0 || rough > 1 {
+			l.fail(n.fields["roughness"], "metal roughness should be between 0 and 1, not %g", rough)
+		}
+		m = trace.NewMetal(t, rough)
+	case "dielectric":
+		index := l.number(l.require(n, "index", "dielectric material"), "dielectric index")
+		if index <= 0 {
+			l.fail(n.fields["index"], "dielectric index should be positive, not %g", index)
+		}
+		m = trace.NewDielectric(index)
+	case "light":
+		m = trace.NewLight(l.texture(l.require(n, "texture", "light material")))
+	case "isotropic":
+		m = trace.NewIsotropic(l.texture(l.require(n, "texture", "isotropic material")))
+	default:
+		l.fail(n.fields["type"], "unknown material type %q (expected lambert, metal, dielectric, light, or isotropic)", typ)
+	}
+	l.done(n, "material")
+	return m
+}
+
+// surfaces builds the surfaces in array n.
+func (l *loader) surfaces(n *node, what string) []trace.Surface {
+	if n.kind != arrayKind {
+		l.fail(n, "%s should be an array, not %v", what, n.kind)
+	}
+	if len(n.elems) == 0 {
+		l.fail(n, "%s is empty", what)
+	}
+	ss := make([]trace.Surface, len(n.elems))
+	for i, e := range n.elems {
+		ss[i] = l.surface(e)
+	}
+	return ss
+}
+
+func (l *loader) surface(n *node) trace.Surface {
+	l.object(n, "surface")
+	var s trace.Surface
+	typ := l.str(l.require(n, "type", "surface"), "surface type")
+	switch typ {
+	case "sphere":
+		center := l.vec(l.require(n, "center", "sphere"), "sphere center")
+		radius := l.number(l.require(n, "radius", "sphere"), "sphere radius")
+		if radius <= 0 {
+			l.fail(n.fields["radius"], "sphere radius should be positive, not %g", radius)
+		}
+		m := l.material(l.require(n, "material", "sphere"))
+		if c1 := l.field(n, "center1"); c1 != nil {
+			t := []float64{l.time0, l.time1}
+			if tn := l.field(n, "time"); tn != nil {
+				t = l.numbers(tn, 2, "sphere time")
+			}
+			if t[0] == t[1] {
+				l.fail(n, "moving sphere's time range is empty")
+			}
+			s = trace.NewMovingSphere(center, l.vec(c1, "sphere center1"), t[0], t[1], radius, m)
+		} else {
+			s = trace.NewSphere(center, radius, m)
+		}
+	case "rect":
+		min := l.vec(l.require(n, "min", "rect"), "rect min")
+		max := l.vec(l.require(n, "max", "rect"), "rect max")
+		flat, other := 0, 0
+		for i := 0; i < 3; i++ {
+			if min[i] == max[i] {
+				flat++
+			} else if min[i] > max[i] {
+				other++
+			}
+		}
+		if flat != 1 {
+			l.fail(n, "rect min %v and max %v must share exactly one axis, which is the axis of the rect's plane", min, max)
+		}
+		if other > 0 {
+			l.fail(n, "rect min %v must be less than max %v on the two axes it spans", min, max)
+		}
+		s = trace.NewRect(min, max, l.material(l.require(n, "material", "rect")))
+	case "box":
+		min := l.vec(l.require(n, "min", "box"), "box min")
+		max := l.vec(l.require(n, "max", "box"), "box max")
+		for i := 0; i < 3; i++ {
+			if min[i] >= max[i] {
+				l.fail(n, "box min %v must be less than max %v on every axis", min, max)
+			}
+		}
+		s = trace.NewBox(min, max, l.material(l.require(n, "material", "box")))
+	case "quad":
+		corner := l.vec(l.require(n, "corner", "quad"), "quad corner")
+		u := l.vec(l.require(n, "u", "quad"), "quad u")
+		v := l.vec(l.require(n, "v", "quad"), "quad v")
+		if u.Cross(v).LenSq() == 0 {
+			l.fail(n, "quad u %v and v %v must point in different directions", u, v)
+		}
+		s = trace.NewQuad(corner, u, v, l.material(l.require(n, "material", "quad")))
+	case "disk":
+		center := l.vec(l.require(n, "center", "disk"), "disk center")
+		normal := l.normal(l.require(n, "normal", "disk"), "disk normal")
+		radius := l.number(l.require(n, "radius", "disk"), "disk radius")
+		if radius <= 0 {
+			l.fail(n.fields["radius"], "disk radius should be positive, not %g", radius)
+		}
+		s = trace.NewDisk(center, normal, radius, l.material(l.require(n, "material", "disk")))
+	case "plane":
+		point := l.vec(l.require(n, "point", "plane"), "plane point")
+		normal := l.normal(l.require(n, "normal", "plane"), "plane normal")
+		s = trace.NewPlane(point, normal, l.material(l.require(n, "material", "plane")))
+	case "triangle":
+		v := l.vecs(l.require(n, "vertices", "triangle"), "triangle vertices")
+		if len(v) != 3 {
+			l.fail(n.fields["vertices"], "triangle should have 3 vertices, not %d", len(v))
+		}
+		s = trace.NewTriangle(v[0], v[1], v[2], l.material(l.require(n, "material", "triangle")))
+	case "mesh":
+		var m trace.Mesh
+		m.Verts = l.vecs(l.require(n, "vertices", "mesh"), "mesh vertices")
+		if ns := l.field(n, "normals"); ns != nil {
+			for _, v := range l.vecs(ns, "mesh normals") {
+				if v.LenSq() == 0 {
+					l.fail(ns, "mesh normals can't be zero")
+				}
+				m.Norms = append(m.Norms, v.Unit())
+			}
+		}
+		if uvs := l.field(n, "uvs"); uvs != nil {
+			if uvs.kind != arrayKind {
+				l.fail(uvs, "mesh uvs should be an array, not %v", uvs.kind)
+			}
+			for _, e := range uvs.elems {
+				uv := l.numbers(e, 2, "mesh uv")
+				m.UVs = append(m.UVs, geom.Vec{uv[0], uv[1], 0})
+			}
+		}
+		faces := l.require(n, "faces", "mesh")
+		if faces.kind != arrayKind {
+			l.fail(faces, "mesh faces should be an array, not %v", faces.kind)
+		}
+		for _, e := range faces.elems {
+			f := l.numbers(e, 3, "mesh face")
+			for _, i := range f {
+				if i != float64(int(i)) {
+					l.fail(e, "mesh face indices should be whole numbers, not %g", i)
+				}
+			}
+			m.Faces = append(m.Faces, [3]int{int(f[0]), int(f[1]), int(f[2])})
+		}
+		mesh, err := trace.NewTriangleMesh(m, l.material(l.require(n, "material", "mesh")))
+		if err != nil {
+			l.fail(n, "%v", err)
+		}
+		s = mesh
+	case "obj":
+		f := l.require(n, "file", "obj")
+		opts := obj.Options{Open: l.open}
+		if m := l.field(n, "material"); m != nil {
+			opts.Material = l.material(m)
+		}
+		model, err := obj.Load(l.path(f, "obj file"), opts)
+		if err != nil {
+			l.fail(n.fields["file"], "%v", err)
+		}
+		s = model.Surface
+	case "ply":
+		model, err := ply.Load(l.path(l.require(n, "file", "ply"), "ply file"))
+		if err != nil {
+			l.fail(n.fields["file"], "%v", err)
+		}
+		colors := false
+		if c := l.field(n, "colors"); c != nil {
+			if c.kind != boolKind {
+				l.fail(c, "ply colors should be true or false")
+			}
+			colors = c.b
+		}
+		mesh, err := model.Surface(l.material(l.require(n, "material", "ply")), colors)
+		if err != nil {
+			l.fail(n, "%v", err)
+		}
+		s = mesh
+	case "stl":
+		m, err := stl.Load(l.path(l.require(n, "file", "stl"), "stl file"))
+		if err != nil {
+			l.fail(n.fields["file"], "%v", err)
+		}
+		mesh, err := trace.NewTriangleMesh(m, l.material(l.require(n, "material", "stl")))
+		if err != nil {
+			l.fail(n.fields["file"], "%v", err)
+		}
+		s = mesh
+	case "gltf":
+		model, err := gltf.Load(l.path(l.require(n, "file", "gltf"), "gltf file"), gltf.Options{Open: l.open})
+		if err != nil {
+			l.fail(n.fields["file"], "%v", err)
+		}
+		s = model.Surface
+	case "volume":
+		boundary := l.surface(l.require(n, "boundary", "volume"))
+		density := l.number(l.require(n, "density", "volume"), "volume density")
+		if density <= 0 {
+			l.fail(n.fields["density"], "volume density should be positive, not %g", density)
+		}
+		s = trace.NewVolume(boundary, density, l.material(l.require(n, "material", "volume")))
+	case "translate":
+		offset := l.vec(l.require(n, "offset", "translate"), "translate offset")
+		s = trace.NewTranslate(l.surface(l.require(n, "surface", "translate")), offset)
+	case "rotateY":
+		angle := l.number(l.require(n, "angle", "rotateY"), "rotateY angle")
+		s = trace.NewRotateY(l.surface(l.require(n, "surface", "rotateY")), angle)
+	case "flip":
+		s = trace.NewFlip(l.surface(l.require(n, "surface", "flip")))
+	case "animate":
+		child := l.surface(l.require(n, "surface", "animate"))
+		tracks := l.keys(l.require(n, "keys", "animate"), map[string]int{"offset": 3, "angle": 1}, "animate")
+		s = trace.NewAnimated(child, tracks["offset"], tracks["angle"])
+	case "list":
+		s = trace.NewList(l.surfaces(l.require(n, "surfaces", "list"), "list surfaces")...)
+	case "bvh":
+		s = trace.NewBVH(l.time0, l.time1, l.surfaces(l.require(n, "surfaces", "bvh"), "bvh surfaces")...)
+	default:
+		l.fail(n.fields["type"], "unknown surface type %q (expected sphere, rect, box, quad, disk, plane, triangle, mesh, obj, ply, stl, gltf, volume, translate, rotateY, flip, animate, list, or bvh)", typ)
+	}
+	l.done(n, typ)
+	return s
+}
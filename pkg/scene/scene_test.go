@@ -0,0 +1,203 @@
+package scene
+
+import (
+	"image"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+const camera = `"camera": {"from": [0, 0, 5], "at": [0, 0, 0], "fov": 40},`
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"syntax", `{
+	"camera": {"from": [0, 0, 5] "at": [0, 0, 0]}
+}`, `test.json:2:31: invalid character '"' after object key:value pair`},
+		{"end of file", `{
+	` + camera + `
+	"surfaces": [`, `test.json:3:15: unexpected end of JSON input`},
+		{"trailing data", `{
+	` + camera + `
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1, "material": {"type": "lambert", "texture": [1, 1, 1]}}]
+} {}`, `test.json:4:3: unexpected data after the top-level value`},
+		{"duplicate key", `{
+	` + camera + `
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1, "radius": 2}]
+}`, `test.json:3:68: duplicate key "radius"`},
+		{"unknown scene field", `{
+	` + camera + `
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1, "material": {"type": "lambert", "texture": [1, 1, 1]}}],
+	"lights": []
+}`, `test.json:4:12: unknown scene field "lights"`},
+		{"unknown surface field", `{
+	` + camera + `
+	"surfaces": [
+		{"type": "sphere", "center": [0, 0, 0], "radus": 1, "radius": 1, "material": {"type": "lambert", "texture": [1, 1, 1]}}
+	]
+}`, `test.json:4:52: unknown sphere field "radus"`},
+		{"missing field", `{
+	` + camera + `
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "material": {"type": "lambert", "texture": [1, 1, 1]}}]
+}`, `test.json:3:15: sphere is missing "radius"`},
+		{"wrong type", `{
+	` + camera + `
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": "1", "material": {"type": "lambert", "texture": [1, 1, 1]}}]
+}`, `test.json:3:65: sphere radius should be a number, not a string`},
+		{"rect without a flat axis", `{
+	` + camera + `
+	"surfaces": [{"type": "rect", "min": [0, 0, 0], "max": [1, 1, 1], "material": {"type": "lambert", "texture": [1, 1, 1]}}]
+}`, `test.json:3:15: rect min [0 0 0] and max [1 1 1] must share exactly one axis, which is the axis of the rect's plane`},
+		{"rect with two flat axes", `{
+	` + camera + `
+	"surfaces": [{"type": "rect", "min": [0, 0, 0], "max": [1, 0, 0], "material": {"type": "lambert", "texture": [1, 1, 1]}}]
+}`, `test.json:3:15: rect min [0 0 0] and max [1 0 0] must share exactly one axis, which is the axis of the rect's plane`},
+		{"rect backwards", `{
+	` + camera + `
+	"surfaces": [{"type": "rect", "min": [0, 1, 0], "max": [1, 0, 0], "material": {"type": "lambert", "texture": [1, 1, 1]}}]
+}`, `test.json:3:15: rect min [0 1 0] must be less than max [1 0 0] on the two axes it spans`},
+		{"flat box", `{
+	` + camera + `
+	"surfaces": [{"type": "box", "min": [0, 0, 0], "max": [1, 0, 1], "material": {"type": "lambert", "texture": [1, 1, 1]}}]
+}`, `test.json:3:15: box min [0 0 0] must be less than max [1 0 1] on every axis`},
+		{"unknown material", `{
+	` + camera + `
+	"materials": {"white": {"type": "lambert", "texture": [1, 1, 1]}},
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1, "material": "wite"}]
+}`, `test.json:4:80: unknown material "wite"`},
+		{"unknown texture", `{
+	` + camera + `
+	"textures": {"red": [1, 0, 0]},
+	"materials": {"white": {"type": "lambert", "texture": "read"}},
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1, "material": "white"}]
+}`, `test.json:4:56: unknown texture "read"`},
+		{"texture used before it's named", `{
+	` + camera + `
+	"textures": {"check": {"type": "checker", "size": 1, "odd": "red", "even": [1, 1, 1]}, "red": [1, 0, 0]},
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1, "material": {"type": "lambert", "texture": "check"}}]
+}`, `test.json:3:62: unknown texture "red"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(test.src), "test.json")
+			if err == nil {
+				t.Fatalf("got no error, want %q", test.want)
+			}
+			if _, ok := err.(*Error); !ok {
+				t.Errorf("got a %T, want an *Error", err)
+			}
+			if err.Error() != test.want {
+				t.Errorf("got %q, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestNamedReuse(t *testing.T) {
+	src := `{
+	` + camera + `
+	"textures": {"red": [1, 0, 0], "check": {"type": "checker", "size": 1, "odd": "red", "even": "red"}},
+	"materials": {
+		"white": {"type": "lambert", "texture": [1, 1, 1]},
+		"red": {"type": "lambert", "texture": "check"}
+	},
+	"surfaces": [
+		{"type": "sphere", "center": [-2, 0, 0], "radius": 0.5, "material": "white"},
+		{"type": "sphere", "center": [0, 0, 0], "radius": 0.5, "material": "white"},
+		{"type": "sphere", "center": [2, 0, 0], "radius": 0.5, "material": "red"}
+	]
+}`
+	s, err := Read(strings.NewReader(src), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Materials) != 2 {
+		t.Fatalf("got %d named materials, want 2", len(s.Materials))
+	}
+	for _, test := range []struct {
+		x    float64
+		name string
+	}{{-2, "white"}, {0, "white"}, {2, "red"}} {
+		r := trace.NewRay(geom.Vec{test.x, 0, 5}, geom.Vec{0, 0, -1}.Unit(), 0)
+		hit := s.Surface.Hit(r, 0, math.MaxFloat64, nil)
+		if hit == nil {
+			t.Fatalf("missed the sphere at x %v", test.x)
+		}
+		if hit.Mat != s.Materials[test.name] {
+			t.Errorf("sphere at x %v doesn't share the material %q", test.x, test.name)
+		}
+	}
+	// the checker's squares are both the named red texture.
+	_, c, ok := s.Materials["red"].Scatter(geom.Vec{0, 0, -1}.Unit(), geom.Vec{0, 0, 1}.Unit(), geom.Vec{}, geom.Vec{2, 0, 0.5}, rand.New(rand.NewSource(1)))
+	if !ok || c != (trace.Color{1, 0, 0}) {
+		t.Errorf("red material scatters %v, %v, want %v", c, ok, trace.Color{1, 0, 0})
+	}
+}
+
+func TestReadWithin(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	writePNG(t, filepath.Join(root, "tex.png"))
+	writePNG(t, filepath.Join(base, "secret.png"))
+
+	tests := []struct {
+		name string
+		file string
+		want string // the error, or "" if the file is allowed
+	}{
+		{"inside", "tex.png", ""},
+		{"absolute inside", filepath.Join(root, "tex.png"), ""},
+		{"parent", "../secret.png", `image file "../secret.png" is outside the scene's root directory`},
+		{"parent of a subdirectory", "sub/../../secret.png", `image file "sub/../../secret.png" is outside the scene's root directory`},
+		{"absolute", filepath.Join(base, "secret.png"), `image file "` + filepath.Join(base, "secret.png") + `" is outside the scene's root directory`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := `{
+	` + camera + `
+	"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1,
+		"material": {"type": "lambert", "texture": {"type": "image", "file": "` + test.file + `"}}}]
+}`
+			_, err := ReadWithin(strings.NewReader(src), filepath.Join(root, "scene.json"), root)
+			if test.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if want := filepath.Join(root, "scene.json") + ":4:72: " + test.want; err == nil || err.Error() != want {
+				t.Fatalf("got %v, want %s", err, want)
+			}
+			// without a root, any file may be used.
+			if _, err := Read(strings.NewReader(src), filepath.Join(root, "scene.json")); err != nil {
+				t.Errorf("without a root: %v", err)
+			}
+		})
+	}
+}
+
+func writePNG(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+}
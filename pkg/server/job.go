@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+	"time"
+
+	"github.com/hunterloftis/oneweekend/pkg/scene"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// maxSize is the largest width or height a job may request.
+const maxSize = 16384
+
+// Request describes a render job.
+type Request struct {
+	// Scene is either the path of a scene file, relative to the server's root,
+	// or an inline scene in the scene package's JSON format.
+	Scene json.RawMessage `json:"scene"`
+	// Width and Height are the image's dimensions in pixels.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Samples is the number of samples per pixel, spread over Passes passes.
+	// With a Threshold or Budget, it's the most samples any pixel receives.
+	Samples int `json:"samples"`
+	// Passes is the number of progressive passes; the preview updates after each tile of each pass.
+	Passes    int     `json:"passes"`
+	Seed      int64   `json:"seed"`
+	Threshold float64 `json:"threshold"`
+	// Budget is a duration, like "90s", after which the render stops.
+	Budget string `json:"budget"`
+	// Filter, Tonemap, and Format are names as accepted by trace.ParseFilter,
+	// trace.ParseToneOperator, and trace.ParseFormat.
+	Filter   string  `json:"filter"`
+	Tonemap  string  `json:"tonemap"`
+	Exposure float64 `json:"exposure"`
+	Format   string  `json:"format"`
+}
+
+// State is where a job is in its lifecycle.
+type State string
+
+// Job states.
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Done      State = "done"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+// Status is a snapshot of a job, as returned by the API.
+type Status struct {
+	ID        int        `json:"id"`
+	State     State      `json:"state"`
+	Error     string     `json:"error,omitempty"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	Done      int        `json:"done"`  // tiles traced
+	Total     int        `json:"total"` // tiles to trace, or 0 if unknown
+	Samples   int        `json:"samples"`
+	Elapsed   float64    `json:"elapsed"`   // seconds
+	Remaining float64    `json:"remaining"` // estimated seconds
+	Created   time.Time  `json:"created"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// job is a render request and its progress.
+type job struct {
+	id     int
+	scene  *scene.Scene
+	window *trace.Window
+	opts   trace.RenderOptions
+	tone   trace.Tone
+	format trace.Format
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	status  Status
+	preview *image.RGBA // the image so far, updated after each tile while the job runs
+	result  *result     // the final image, once the render stops
+}
+
+// result is a finished image.
+// It keeps only each pixel's color, as 32-bit floats, rather than a Frame's sample statistics,
+// which are several times larger.
+type result struct {
+	rect image.Rectangle
+	pix  []float32
+	tone trace.Tone
+}
+
+func newResult(f *trace.Frame) *result {
+	r := &result{rect: f.Bounds(), tone: f.Tone()}
+	r.pix = make([]float32, 0, 3*r.rect.Dx()*r.rect.Dy())
+	for y := r.rect.Min.Y; y < r.rect.Max.Y; y++ {
+		for x := r.rect.Min.X; x < r.rect.Max.X; x++ {
+			c := f.Color(x, y)
+			r.pix = append(r.pix, float32(c[0]), float32(c[1]), float32(c[2]))
+		}
+	}
+	return r
+}
+
+// frame returns a new Frame with the result's colors, for encoding.
+func (r *result) frame() *trace.Frame {
+	f := trace.NewFrame(r.rect)
+	f.SetTone(r.tone)
+	i := 0
+	for y := r.rect.Min.Y; y < r.rect.Max.Y; y++ {
+		for x := r.rect.Min.X; x < r.rect.Max.X; x++ {
+			c := trace.Color{float64(r.pix[i]), float64(r.pix[i+1]), float64(r.pix[i+2])}
+			f.SetPixel(x, y, trace.Pixel{Sum: c, Samples: 1})
+			i += 3
+		}
+	}
+	return f
+}
+
+// newJob validates req and loads its scene with load.
+// workers is the number of goroutines that trace the job's rays.
+func newJob(req Request, load func(json.RawMessage) (*scene.Scene, error), workers int) (*job, error) {
+	if req.Width < 1 || req.Height < 1 || req.Width > maxSize || req.Height > maxSize {
+		return nil, fmt.Errorf("width and height should be between 1 and %d", maxSize)
+	}
+	if req.Samples < 1 {
+		return nil, errors.New("samples should be at least 1")
+	}
+	if len(req.Scene) == 0 {
+		return nil, errors.New("scene is missing")
+	}
+	j := &job{window: trace.NewWindow(req.Width, req.Height)}
+	var err error
+	if j.format, err = trace.ParseFormat(orDefault(req.Format, "png")); err != nil {
+		return nil, err
+	}
+	if j.tone.Operator, err = trace.ParseToneOperator(orDefault(req.Tonemap, "clamp")); err != nil {
+		return nil, err
+	}
+	j.tone.Exposure = req.Exposure
+	passes := req.Passes
+	if passes < 1 {
+		passes = 1
+	}
+	j.opts = trace.RenderOptions{
+		Samples: (req.Samples + passes - 1) / passes,
+		Passes:  passes,
+		Seed:    req.Seed,
+		Workers: workers,
+		Order:   trace.Spiral,
+	}
+	if req.Filter != "" {
+		if j.opts.Filter, err = trace.ParseFilter(req.Filter); err != nil {
+			return nil, err
+		}
+	}
+	if req.Budget != "" {
+		if j.opts.Budget, err = time.ParseDuration(req.Budget); err != nil {
+			return nil, fmt.Errorf("budget: %v", err)
+		}
+	}
+	if req.Threshold > 0 || j.opts.Budget > 0 {
+		// render passes of 16 samples until the threshold or budget is met.
+		j.opts.Samples, j.opts.Passes = 16, 0
+		j.opts.Threshold = req.Threshold
+		j.opts.MinSamples, j.opts.MaxSamples = 16, req.Samples
+	}
+	if j.scene, err = load(req.Scene); err != nil {
+		return nil, err
+	}
+	j.status = Status{State: Queued, Width: req.Width, Height: req.Height, Created: time.Now()}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	return j, nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// run renders the job, unless it was cancelled while it was queued.
+func (j *job) run() {
+	j.mu.Lock()
+	if j.status.State != Queued {
+		j.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	j.status.State, j.status.Started = Running, &now
+	j.preview = image.NewRGBA(image.Rect(0, 0, j.status.Width, j.status.Height))
+	j.mu.Unlock()
+
+	opts := j.opts
+	opts.Progress = func(p trace.Progress) {
+		j.mu.Lock()
+		j.status.Done, j.status.Total, j.status.Samples = p.Done, p.Total, p.Samples
+		j.status.Elapsed, j.status.Remaining = p.Elapsed.Seconds(), p.Remaining.Seconds()
+		j.mu.Unlock()
+	}
+	opts.TileDone = func(tile image.Rectangle, f *trace.Frame) {
+		// filters spread samples past the edges of the tile, so update its neighbors too.
+		if opts.Filter != nil {
+			tile = tile.Inset(-int(opts.Filter.Radius() + 1)).Intersect(f.Bounds())
+		}
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		for y := tile.Min.Y; y < tile.Max.Y; y++ {
+			for x := tile.Min.X; x < tile.Max.X; x++ {
+				r, g, b := j.tone.RGB(f.Color(x, y))
+				j.preview.SetRGBA(x, y, color.RGBA{R: r, G: g, B: b, A: 255})
+			}
+		}
+	}
+	defer j.cancel()
+	frame, err := j.window.Render(j.ctx, j.scene.Camera, j.scene.Surface, opts)
+	frame.SetTone(j.tone)
+	res := newResult(frame)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	finished := time.Now()
+	j.result, j.status.Finished = res, &finished
+	// the scene and the render's samples aren't needed anymore.
+	j.scene, j.window, j.preview = nil, nil, nil
+	switch {
+	case err == context.Canceled:
+		j.status.State = Cancelled
+	case err != nil:
+		j.status.State, j.status.Error = Failed, err.Error()
+	default:
+		j.status.State, j.status.Remaining = Done, 0
+	}
+}
+
+// stop cancels the job, whether it's queued or running.
+// It reports whether the job was still unfinished.
+func (j *job) stop() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch j.status.State {
+	case Queued:
+		now := time.Now()
+		j.status.State, j.status.Finished = Cancelled, &now
+	case Running:
+	default:
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+func (j *job) snapshot() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
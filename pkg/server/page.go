@@ -0,0 +1,106 @@
+package server
+
+// page is the web interface: a form to submit jobs,
+// a list of jobs, and a live preview of the selected job.
+// It polls the API rather than holding connections open,
+// and reloads the preview whenever the selected job has traced more samples.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>trace</title>
+<style>
+body { font: 14px sans-serif; margin: 2em; background: #222; color: #ddd; display: flex; gap: 2em; }
+form, table { margin-bottom: 1em; }
+label { display: block; margin: 0.3em 0; }
+input { width: 6em; }
+textarea { width: 26em; height: 8em; font: 12px monospace; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 0.6em; text-align: left; }
+tr.job { cursor: pointer; }
+tr.selected { background: #444; }
+#preview { background: repeating-conic-gradient(#333 0 25%, #2a2a2a 0 50%) 0 0 / 16px 16px; max-width: 100%; }
+.error { color: #f77; }
+a { color: #9cf; }
+</style>
+</head>
+<body>
+<div>
+<form id="submit">
+<label>Scene file or inline JSON<br><textarea name="scene">scenes/cornell.json</textarea></label>
+<label>Width <input name="width" type="number" value="400"></label>
+<label>Height <input name="height" type="number" value="300"></label>
+<label>Samples <input name="samples" type="number" value="200"></label>
+<label>Passes <input name="passes" type="number" value="8"></label>
+<label>Seed <input name="seed" type="number" value="0"></label>
+<label>Tone map <select name="tonemap"><option>clamp</option><option>reinhard</option><option>filmic</option></select></label>
+<button>Render</button> <span id="message" class="error"></span>
+</form>
+<table>
+<thead><tr><th>Job</th><th>State</th><th>Progress</th><th>Samples</th><th></th></tr></thead>
+<tbody id="jobs"></tbody>
+</table>
+</div>
+<div>
+<p id="status"></p>
+<img id="preview" alt="">
+</div>
+<script>
+let selected = 0, shown = "";
+
+document.getElementById("submit").onsubmit = async e => {
+	e.preventDefault();
+	const f = e.target.elements, scene = f.scene.value.trim();
+	const req = {
+		scene: scene.startsWith("{") ? JSON.parse(scene) : scene,
+		width: +f.width.value, height: +f.height.value,
+		samples: +f.samples.value, passes: +f.passes.value,
+		seed: +f.seed.value, tonemap: f.tonemap.value,
+	};
+	const res = await fetch("/jobs", {method: "POST", body: JSON.stringify(req)});
+	const body = await res.json();
+	document.getElementById("message").textContent = body.error || "";
+	if (!body.error) selected = body.id;
+	refresh();
+};
+
+function progress(j) {
+	if (j.state === "done") return "100%";
+	if (j.total > 0) return (100 * j.done / j.total).toFixed(1) + "%";
+	return j.done + " tiles";
+}
+
+async function cancel(id) {
+	await fetch("/jobs/" + id, {method: "DELETE"});
+	refresh();
+}
+
+async function refresh() {
+	const jobs = await (await fetch("/jobs")).json();
+	const rows = jobs.map(j =>
+		'<tr class="job' + (j.id === selected ? ' selected' : '') + '" onclick="selected=' + j.id + ';refresh()">' +
+		"<td>" + j.id + "</td><td>" + j.state + "</td><td>" + progress(j) + "</td><td>" + j.samples + "</td><td>" +
+		'<a href="#" onclick="event.stopPropagation();cancel(' + j.id + ')">' +
+		(j.state === "queued" || j.state === "running" ? "cancel" : "remove") + "</a>" +
+		"</td></tr>");
+	document.getElementById("jobs").innerHTML = rows.reverse().join("");
+	const j = jobs.find(j => j.id === selected);
+	if (!j) return;
+	const status = document.getElementById("status");
+	status.className = j.error ? "error" : "";
+	status.innerHTML = "Job " + j.id + ": " + j.state + (j.error ? " (" + j.error + ")" : "") +
+		", " + j.elapsed.toFixed(0) + "s elapsed" + (j.state === "running" ? ", " + j.remaining.toFixed(0) + "s remaining" : "") +
+		(j.state === "done" || j.state === "cancelled" ? ' &middot; <a href="/jobs/' + j.id + '/image">download</a>' : "");
+	const key = j.id + "/" + j.state + "/" + j.samples;
+	if (key !== shown && j.state !== "queued" && !(j.state === "cancelled" && !j.started)) {
+		shown = key;
+		document.getElementById("preview").src = "/jobs/" + j.id + "/image?format=png&t=" + Date.now();
+	}
+}
+
+refresh();
+setInterval(refresh, 1000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,311 @@
+/*
+Package server runs render jobs submitted over HTTP.
+
+Jobs wait in a queue and a fixed number of them render at once.
+The API speaks JSON:
+
+	POST   /jobs             submit a Request; responds with the job's Status
+	GET    /jobs             list the Status of every job
+	GET    /jobs/{id}        get a job's Status
+	DELETE /jobs/{id}        cancel a queued or running job, or forget a finished one
+	GET    /jobs/{id}/image  get the job's image: a PNG preview while it renders,
+	                         then the finished image in the job's format (or ?format=)
+
+GET / serves a web page for submitting jobs and watching them refine.
+
+The server remembers a limited number of finished jobs, and forgets the oldest
+(along with their images) as more finish.
+*/
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hunterloftis/oneweekend/pkg/scene"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Config configures a Server.
+type Config struct {
+	// Root is the directory that scene files are loaded from,
+	// and that inline scenes' relative paths, like images, are resolved against.
+	// Scenes can't refer to files outside of it.
+	Root string
+	// Concurrent is the number of jobs that render at once. If zero, it's 1.
+	Concurrent int
+	// Queue is the most jobs that may wait to render. If zero, it's 100.
+	Queue int
+	// Keep is the most finished jobs to remember. If zero, it's 20.
+	Keep int
+	// Workers is the number of goroutines that trace each job's rays.
+	// If zero, the CPUs are divided evenly among the Concurrent jobs.
+	Workers int
+}
+
+// Server queues and renders jobs. It implements http.Handler.
+type Server struct {
+	cfg   Config
+	queue chan *job
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[int]*job
+	nextID int
+	closed bool
+}
+
+// New returns a new Server and starts its renderers.
+func New(cfg Config) *Server {
+	if cfg.Root == "" {
+		cfg.Root = "."
+	}
+	if cfg.Concurrent <= 0 {
+		cfg.Concurrent = 1
+	}
+	if cfg.Queue <= 0 {
+		cfg.Queue = 100
+	}
+	if cfg.Keep <= 0 {
+		cfg.Keep = 20
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = (runtime.NumCPU() + cfg.Concurrent - 1) / cfg.Concurrent
+	}
+	s := &Server{cfg: cfg, queue: make(chan *job, cfg.Queue), jobs: make(map[int]*job), nextID: 1}
+	s.wg.Add(cfg.Concurrent)
+	for i := 0; i < cfg.Concurrent; i++ {
+		go func() {
+			defer s.wg.Done()
+			for j := range s.queue {
+				j.run()
+				s.prune()
+			}
+		}()
+	}
+	return s
+}
+
+// Close cancels every job and waits for running jobs to stop.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	for _, j := range s.jobs {
+		j.stop()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Submit validates and queues a render job.
+func (s *Server) Submit(req Request) (Status, error) {
+	j, err := newJob(req, s.load, s.cfg.Workers)
+	if err != nil {
+		return Status{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Status{}, errClosed
+	}
+	j.id, j.status.ID = s.nextID, s.nextID
+	select {
+	case s.queue <- j:
+	default:
+		return Status{}, errFull
+	}
+	s.jobs[j.id] = j
+	s.nextID++
+	return j.snapshot(), nil
+}
+
+// prune forgets the oldest finished jobs beyond the Keep most recent.
+func (s *Server) prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var done []Status
+	for _, j := range s.jobs {
+		if st := j.snapshot(); st.Finished != nil {
+			done = append(done, st)
+		}
+	}
+	if len(done) <= s.cfg.Keep {
+		return
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].Finished.Before(*done[j].Finished) })
+	for _, st := range done[:len(done)-s.cfg.Keep] {
+		delete(s.jobs, st.ID)
+	}
+}
+
+var (
+	errClosed = errors.New("server is shutting down")
+	errFull   = errors.New("job queue is full")
+)
+
+// load loads a scene from a path within the root, or from an inline scene.
+func (s *Server) load(ref json.RawMessage) (*scene.Scene, error) {
+	var name string
+	if err := json.Unmarshal(ref, &name); err == nil {
+		// clean the path as if it were absolute so that it can't escape the root.
+		return scene.LoadWithin(filepath.Join(s.cfg.Root, filepath.FromSlash(path.Clean("/"+name))), s.cfg.Root)
+	}
+	return scene.ReadWithin(bytes.NewReader(ref), filepath.Join(s.cfg.Root, "scene.json"), s.cfg.Root)
+}
+
+// ServeHTTP routes API and web page requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	case parts[0] != "jobs" || len(parts) > 3:
+		http.NotFound(w, r)
+	case len(parts) == 1:
+		s.serveJobs(w, r)
+	default:
+		id, err := strconv.Atoi(parts[1])
+		s.mu.Lock()
+		j := s.jobs[id]
+		s.mu.Unlock()
+		if err != nil || j == nil {
+			writeError(w, http.StatusNotFound, errors.New("no such job"))
+			return
+		}
+		if len(parts) == 2 {
+			s.serveJob(w, r, j)
+		} else if parts[2] == "image" {
+			s.serveImage(w, r, j)
+		} else {
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func (s *Server) serveJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		ss := make([]Status, 0, len(s.jobs))
+		for _, j := range s.jobs {
+			ss = append(ss, j.snapshot())
+		}
+		s.mu.Unlock()
+		sort.Slice(ss, func(i, j int) bool { return ss[i].ID < ss[j].ID })
+		writeJSON(w, http.StatusOK, ss)
+	case http.MethodPost:
+		var req Request
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<20))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("decoding request: %v", err))
+			return
+		}
+		st, err := s.Submit(req)
+		switch err {
+		case nil:
+			writeJSON(w, http.StatusAccepted, st)
+		case errClosed, errFull:
+			writeError(w, http.StatusServiceUnavailable, err)
+		default:
+			writeError(w, http.StatusBadRequest, err)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) serveJob(w http.ResponseWriter, r *http.Request, j *job) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, j.snapshot())
+	case http.MethodDelete:
+		if !j.stop() {
+			s.mu.Lock()
+			delete(s.jobs, j.id)
+			s.mu.Unlock()
+		}
+		writeJSON(w, http.StatusOK, j.snapshot())
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// serveImage writes the job's finished image,
+// or a PNG of the samples traced so far if it's still rendering.
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request, j *job) {
+	// copy what's needed so that encoding doesn't hold up the render.
+	j.mu.Lock()
+	res, state := j.result, j.status.State
+	var preview *image.RGBA
+	if res == nil && state == Running {
+		preview = image.NewRGBA(j.preview.Rect)
+		copy(preview.Pix, j.preview.Pix)
+	}
+	j.mu.Unlock()
+	w.Header().Set("Cache-Control", "no-store")
+	if res == nil {
+		if preview == nil {
+			writeError(w, http.StatusConflict, fmt.Errorf("job is %s", state))
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, preview)
+		return
+	}
+	f := j.format
+	if name := r.URL.Query().Get("format"); name != "" {
+		var err error
+		if f, err = trace.ParseFormat(name); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", contentType(f))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=job%d.%s", j.id, f))
+	res.frame().Encode(w, f)
+}
+
+func contentType(f trace.Format) string {
+	switch f {
+	case trace.PNG:
+		return "image/png"
+	case trace.JPEG:
+		return "image/jpeg"
+	case trace.PPM:
+		return "image/x-portable-pixmap"
+	}
+	return "application/octet-stream"
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSceneRoot checks that scenes can't read files outside of the server's root,
+// whether they're submitted inline or named.
+func TestSceneRoot(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	writePNG(t, filepath.Join(root, "tex.png"))
+	writePNG(t, filepath.Join(base, "secret.png"))
+	writeFile(t, filepath.Join(root, "scenes", "inside.json"), sceneJSON("../tex.png"))
+	writeFile(t, filepath.Join(root, "scenes", "escape.json"), sceneJSON("../../secret.png"))
+	writeFile(t, filepath.Join(base, "outside.json"), sceneJSON("secret.png"))
+	// models whose MTL files and textures are inside the root, or outside it.
+	const triangle = "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nusemtl m\nf 1/1 2/2 3/3\n"
+	writeFile(t, filepath.Join(root, "model.obj"), "mtllib model.mtl\n"+triangle)
+	writeFile(t, filepath.Join(root, "model.mtl"), "newmtl m\nmap_Kd tex.png\n")
+	writeFile(t, filepath.Join(root, "escape.obj"), "mtllib ../secret.mtl\n"+triangle)
+	writeFile(t, filepath.Join(base, "secret.mtl"), "newmtl m\nKd 1 0 0\n")
+	writeFile(t, filepath.Join(root, "texture.obj"), "mtllib texture.mtl\n"+triangle)
+	writeFile(t, filepath.Join(root, "texture.mtl"), "newmtl m\nmap_Kd ../secret.png\n")
+	// glTF scenes whose buffer is inside the root, or outside it.
+	gltf, bin := splitGLTF(t, "../gltf/testdata/squares.gltf")
+	writeFile(t, filepath.Join(root, "squares.bin"), bin)
+	writeFile(t, filepath.Join(base, "secret.bin"), bin)
+	writeFile(t, filepath.Join(root, "squares.gltf"), strings.Replace(gltf, "BUFFER", "squares.bin", 1))
+	writeFile(t, filepath.Join(root, "escape.gltf"), strings.Replace(gltf, "BUFFER", "../secret.bin", 1))
+
+	s := New(Config{Root: root})
+	defer s.Close()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		scene string
+		ok    bool
+	}{
+		{"inline", sceneJSON("tex.png"), true},
+		{"inline parent", sceneJSON("../secret.png"), false},
+		{"inline absolute", sceneJSON(filepath.Join(base, "secret.png")), false},
+		{"inline absolute inside", sceneJSON(filepath.Join(root, "tex.png")), true},
+		{"named", `"scenes/inside.json"`, true},
+		{"named parent", `"scenes/escape.json"`, false},
+		{"named outside", `"../outside.json"`, false},
+		{"named absolute", fmt.Sprintf("%q", filepath.Join(base, "outside.json")), false},
+		{"obj", objSceneJSON("model.obj"), true},
+		{"obj mtllib parent", objSceneJSON("escape.obj"), false},
+		{"obj texture parent", objSceneJSON("texture.obj"), false},
+		{"gltf", gltfSceneJSON("squares.gltf"), true},
+		{"gltf buffer parent", gltfSceneJSON("escape.gltf"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"scene": %s, "width": 4, "height": 3, "samples": 1}`, test.scene)
+			res, err := http.Post(srv.URL+"/jobs", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			var reply struct{ Error string }
+			json.NewDecoder(res.Body).Decode(&reply)
+			if test.ok && res.StatusCode != http.StatusAccepted {
+				t.Fatalf("got %s: %s, want %d", res.Status, reply.Error, http.StatusAccepted)
+			}
+			if !test.ok && res.StatusCode != http.StatusBadRequest {
+				t.Fatalf("got %s, want %d", res.Status, http.StatusBadRequest)
+			}
+			if strings.Contains(reply.Error, "secret") && !strings.Contains(reply.Error, "outside the scene's root") {
+				t.Errorf("error %q doesn't say that the file is outside the root", reply.Error)
+			}
+		})
+	}
+}
+
+// sceneJSON returns a scene whose only sphere is textured with the image file.
+func sceneJSON(file string) string {
+	return fmt.Sprintf(`{
+		"camera": {"from": [0, 0, 4], "at": [0, 0, 0], "fov": 40},
+		"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1,
+			"material": {"type": "lambert", "texture": {"type": "image", "file": %q}}}]
+	}`, file)
+}
+
+// objSceneJSON returns a scene whose only surface is the OBJ model file, with its own materials.
+func objSceneJSON(file string) string {
+	return fmt.Sprintf(`{
+		"camera": {"from": [0, 0, 4], "at": [0, 0, 0], "fov": 40},
+		"surfaces": [{"type": "obj", "file": %q}]
+	}`, file)
+}
+
+// gltfSceneJSON returns a scene whose only surface is the glTF file.
+func gltfSceneJSON(file string) string {
+	return fmt.Sprintf(`{
+		"camera": {"from": [0, 0, 20], "at": [0, 0, 0], "fov": 40},
+		"surfaces": [{"type": "gltf", "file": %q}]
+	}`, file)
+}
+
+// splitGLTF returns the glTF file at path, with its first buffer's data URI replaced by "BUFFER",
+// and the data of that buffer.
+func splitGLTF(t *testing.T, path string) (gltf, bin string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	buf := doc["buffers"].([]interface{})[0].(map[string]interface{})
+	uri := buf["uri"].(string)
+	b, err := base64.StdEncoding.DecodeString(uri[strings.Index(uri, ",")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf["uri"] = "BUFFER"
+	js, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(js), string(b)
+}
+
+func writePNG(t *testing.T, path string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, buf.String())
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestKeep checks that the server forgets the oldest finished jobs beyond Config.Keep,
+// and finished jobs that are deleted.
+func TestKeep(t *testing.T) {
+	s := New(Config{Root: t.TempDir(), Keep: 2})
+	defer s.Close()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	scene := json.RawMessage(`{
+		"camera": {"from": [0, 0, 4], "at": [0, 0, 0], "fov": 40},
+		"surfaces": [{"type": "sphere", "center": [0, 0, 0], "radius": 1, "material": {"type": "lambert", "texture": [0.5, 0.5, 0.5]}}]
+	}`)
+	var last Status
+	for i := 0; i < 4; i++ {
+		st, err := s.Submit(Request{Scene: scene, Width: 4, Height: 3, Samples: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = st
+	}
+	// the jobs render one at a time, so once the last is done and forgotten the others, the rest are too.
+	var jobs []Status
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		getJSON(t, srv.URL+"/jobs", &jobs)
+		if len(jobs) == 2 && jobs[1].State == Done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got jobs %v, want the last 2, done", jobs)
+		}
+	}
+	if jobs[0].ID != last.ID-1 || jobs[1].ID != last.ID {
+		t.Fatalf("got jobs %d and %d, want %d and %d", jobs[0].ID, jobs[1].ID, last.ID-1, last.ID)
+	}
+	for _, format := range []string{"png", "pfm"} {
+		res, err := http.Get(fmt.Sprintf("%s/jobs/%d/image?format=%s", srv.URL, last.ID, format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("getting a finished job's %s image: got %s", format, res.Status)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/jobs/%d", srv.URL, last.ID), nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("deleting a finished job: got %s", res.Status)
+	}
+	res, err = http.Get(fmt.Sprintf("%s/jobs/%d/image", srv.URL, last.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("getting a deleted job's image: got %s, want %d", res.Status, http.StatusNotFound)
+	}
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
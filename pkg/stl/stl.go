@@ -0,0 +1,155 @@
+/*
+Package stl loads triangle meshes from STL files, in ASCII or binary.
+
+STL files list each triangle with its own copy of its vertices,
+so vertices at the same position are merged into one, which lets a mesh know which triangles are neighbors.
+The normals in the file are ignored in favor of the ones implied by the order of each triangle's vertices,
+which exporters are more careful to get right, so every face is shaded flat.
+*/
+package stl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+// Load loads the STL file at path.
+func Load(path string) (trace.Mesh, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return trace.Mesh{}, err
+	}
+	defer f.Close()
+	return Read(f, path)
+}
+
+// Read reads an STL file from r. name is used in error messages.
+func Read(r io.Reader, name string) (m trace.Mesh, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return m, err
+	}
+	// binary files have an 80-byte header, which can begin with "solid" like an ASCII file,
+	// so they're recognized by their length instead.
+	if len(data) >= 84 {
+		n := binary.LittleEndian.Uint32(data[80:84])
+		if uint64(len(data)) == 84+50*uint64(n) {
+			return readBinary(data[84:], int(n)), nil
+		}
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		return m, fmt.Errorf("%s: not an STL file", name)
+	}
+	if m, err = readASCII(data); err != nil {
+		return m, fmt.Errorf("%s:%v", name, err)
+	}
+	return m, nil
+}
+
+// builder builds a mesh from triangles, merging vertices at the same position.
+type builder struct {
+	mesh  trace.Mesh
+	index map[geom.Vec]int
+}
+
+func (b *builder) add(vs [3]geom.Vec) {
+	var f [3]int
+	for i, v := range vs {
+		j, ok := b.index[v]
+		if !ok {
+			j = len(b.mesh.Verts)
+			b.index[v] = j
+			b.mesh.Verts = append(b.mesh.Verts, v)
+		}
+		f[i] = j
+	}
+	b.mesh.Faces = append(b.mesh.Faces, f)
+}
+
+// readBinary reads n triangles of 50 bytes each:
+// a normal and three vertices of three little-endian float32s, and two bytes of attributes.
+func readBinary(data []byte, n int) trace.Mesh {
+	b := builder{index: make(map[geom.Vec]int)}
+	f := func(off int) float64 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data[off:])))
+	}
+	for i := 0; i < n; i++ {
+		var vs [3]geom.Vec
+		for j := range vs {
+			off := i*50 + 12 + j*12
+			vs[j] = geom.Vec{f(off), f(off + 4), f(off + 8)}
+		}
+		b.add(vs)
+	}
+	return b.mesh
+}
+
+// readASCII reads triangles written as text:
+//
+//	solid name
+//	facet normal nx ny nz
+//	  outer loop
+//	    vertex x y z
+//	    vertex x y z
+//	    vertex x y z
+//	  endloop
+//	endfacet
+//	endsolid name
+//
+// Errors begin with the line number where they're found.
+func readASCII(data []byte) (trace.Mesh, error) {
+	b := builder{index: make(map[geom.Vec]int)}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	fail := func(format string, args ...interface{}) (trace.Mesh, error) {
+		return trace.Mesh{}, fmt.Errorf("%d: %s", line, fmt.Sprintf(format, args...))
+	}
+	var vs []geom.Vec
+	for s.Scan() {
+		line++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "solid", "endsolid", "facet", "outer":
+		case "vertex":
+			if len(fields) != 4 {
+				return fail("vertex should have 3 coordinates, not %d", len(fields)-1)
+			}
+			var v geom.Vec
+			for i := range v {
+				f, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return fail("vertex has %q, which isn't a number", fields[i+1])
+				}
+				v[i] = f
+			}
+			vs = append(vs, v)
+		case "endloop":
+			if len(vs) != 3 {
+				return fail("loop has %d vertices, rather than 3", len(vs))
+			}
+			b.add([3]geom.Vec{vs[0], vs[1], vs[2]})
+			vs = vs[:0]
+		case "endfacet":
+		default:
+			return fail("unknown keyword %q", fields[0])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return trace.Mesh{}, err
+	}
+	return b.mesh, nil
+}
@@ -0,0 +1,57 @@
+package stl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+	"github.com/hunterloftis/oneweekend/pkg/trace"
+)
+
+func TestLoad(t *testing.T) {
+	// each of the tetrahedron's four corners is shared by three triangles, and merged into one vertex.
+	want := trace.Mesh{
+		Verts: []geom.Vec{{0, 0, 0}, {0, 1, 0}, {1, 0, 0}, {0, 0, 1}},
+		Faces: [][3]int{{0, 1, 2}, {0, 2, 3}, {0, 3, 1}, {2, 1, 3}},
+	}
+	tests := []string{
+		"tetra_ascii.stl",
+		// its header begins with "solid", like an ASCII file's.
+		"tetra_binary.stl",
+	}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := Load("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, want) {
+				t.Errorf("got %+v, want %+v", m, want)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"empty", "", "test.stl: not an STL file"},
+		{"not stl", "ply\nformat ascii 1.0\n", "test.stl: not an STL file"},
+		{"coordinates", "solid\nfacet normal 0 0 1\nouter loop\nvertex 0 0\n", "test.stl:4: vertex should have 3 coordinates, not 2"},
+		{"not a number", "solid\nfacet normal 0 0 1\nouter loop\nvertex 0 0 z\n", `test.stl:4: vertex has "z", which isn't a number`},
+		{"loop", "solid\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nendloop\n", "test.stl:6: loop has 2 vertices, rather than 3"},
+		{"keyword", "solid\nfacet normal 0 0 1\nouter loop\nvertx 0 0 0\n", `test.stl:4: unknown keyword "vertx"`},
+		// a binary file without all of the triangles its header counts isn't recognized as binary.
+		{"truncated binary", "binary" + strings.Repeat(" ", 74) + "\x02\x00\x00\x00" + strings.Repeat("\x00", 50), "test.stl: not an STL file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(test.src), "test.stl")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
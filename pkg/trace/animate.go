@@ -0,0 +1,196 @@
+package trace
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+// Interpolation is how a keyframed value moves from one Key to the next.
+type Interpolation int
+
+// Interpolations.
+// Linear moves at a constant rate between keys, changing speed abruptly at each key.
+// Bezier follows a smooth cubic Bézier curve through the keys,
+// with handles aligned to the values of the neighboring keys.
+const (
+	Linear Interpolation = iota
+	Bezier
+)
+
+// ParseInterpolation returns the Interpolation with the given name, like "bezier".
+func ParseInterpolation(name string) (Interpolation, error) {
+	switch strings.ToLower(name) {
+	case "linear":
+		return Linear, nil
+	case "bezier":
+		return Bezier, nil
+	}
+	return Linear, fmt.Errorf("unknown interpolation %q", name)
+}
+
+// String returns the name of the interpolation.
+func (in Interpolation) String() string {
+	switch in {
+	case Linear:
+		return "linear"
+	case Bezier:
+		return "bezier"
+	}
+	return fmt.Sprintf("Interpolation(%d)", int(in))
+}
+
+// Key is a keyframe: the value of an animated property at a point in time.
+// Scalar properties, like angles, use only the first component of Value.
+type Key struct {
+	Time  float64
+	Value geom.Vec
+	// Interp is how the value moves from this key to the next.
+	Interp Interpolation
+}
+
+// Track is a sequence of keys, in order of time, that animates a single property.
+type Track []Key
+
+// NewTrack returns a new track of keys, sorted by time.
+func NewTrack(keys ...Key) Track {
+	t := append(Track(nil), keys...)
+	sort.SliceStable(t, func(i, j int) bool { return t[i].Time < t[j].Time })
+	return t
+}
+
+// At returns the value of the track at time t.
+// Before the first key and after the last, the value holds steady.
+// An empty track is always zero.
+func (tr Track) At(t float64) geom.Vec {
+	n := len(tr)
+	if n == 0 {
+		return geom.Vec{}
+	}
+	if t <= tr[0].Time {
+		return tr[0].Value
+	}
+	if t >= tr[n-1].Time {
+		return tr[n-1].Value
+	}
+	i := sort.Search(n, func(i int) bool { return tr[i].Time > t }) - 1
+	k0, k1 := tr[i], tr[i+1]
+	dt := k1.Time - k0.Time
+	u := (t - k0.Time) / dt
+	if k0.Interp == Linear {
+		return k0.Value.Scaled(1 - u).Plus(k1.Value.Scaled(u))
+	}
+	// place the handles a third of the way along the tangents,
+	// which follow the values of the keys on either side (Catmull-Rom).
+	tangent := func(a, b int) geom.Vec {
+		return tr[b].Value.Minus(tr[a].Value).Scaled(1 / (tr[b].Time - tr[a].Time))
+	}
+	m0 := tangent(i, i+1)
+	if i > 0 {
+		m0 = tangent(i-1, i+1)
+	}
+	m1 := tangent(i, i+1)
+	if i+2 < n {
+		m1 = tangent(i, i+2)
+	}
+	p1 := k0.Value.Plus(m0.Scaled(dt / 3))
+	p2 := k1.Value.Minus(m1.Scaled(dt / 3))
+	v := 1 - u
+	return k0.Value.Scaled(v * v * v).
+		Plus(p1.Scaled(3 * v * v * u)).
+		Plus(p2.Scaled(3 * v * u * u)).
+		Plus(k1.Value.Scaled(u * u * u))
+}
+
+// Animated is a surface that moves a child surface over time:
+// it rotates the child on the Y axis by a keyframed angle,
+// then translates it by a keyframed offset.
+// Each ray sees the child where it was at the ray's time,
+// so motion within a camera's shutter interval is blurred.
+type Animated struct {
+	child         Surface
+	offset, angle Track
+}
+
+// NewAnimated returns a new surface that animates child with keyframed offset and angle tracks.
+// Angles are in degrees.
+func NewAnimated(child Surface, offset, angle Track) *Animated {
+	return &Animated{child: child, offset: offset, angle: angle}
+}
+
+// Hit returns details of the intersection between r and this surface at the ray's time.
+// If r does not intersect with this surface, it returns nil.
+func (a *Animated) Hit(r Ray, dMin, dMax float64, rnd *rand.Rand) *Hit {
+	offset := a.offset.At(r.T)
+	sin, cos := math.Sincos(a.angle.At(r.T).X() * math.Pi / 180)
+	r2 := NewRay(rotateY(r.Or.Minus(offset), -sin, cos), geom.Unit(rotateY(geom.Vec(r.Dir), -sin, cos)), r.T)
+	hit := a.child.Hit(r2, dMin, dMax, rnd)
+	if hit != nil {
+		hit.Pt = rotateY(hit.Pt, sin, cos).Plus(offset)
+		hit.Norm = geom.Unit(rotateY(geom.Vec(hit.Norm), sin, cos))
+	}
+	return hit
+}
+
+// Bounds returns an axis-aligned bounding box that encloses
+// this surface from time t0 to t1.
+// The offset is sampled over time, so the box is approximate for curved (Bezier) motion.
+func (a *Animated) Bounds(t0, t1 float64) *AABB {
+	times := []float64{t0, t1}
+	for _, tr := range []Track{a.offset, a.angle} {
+		for _, k := range tr {
+			if k.Time > t0 && k.Time < t1 {
+				times = append(times, k.Time)
+			}
+		}
+	}
+	const steps = 64
+	for i := 1; i < steps; i++ {
+		times = append(times, t0+(t1-t0)*float64(i)/steps)
+	}
+
+	// if the child turns, it could face any direction,
+	// so bound the cylinder that it sweeps around the Y axis.
+	child := a.child.Bounds(t0, t1)
+	if child.infinite() {
+		return infiniteAABB()
+	}
+	angle := a.angle.At(t0).X()
+	turns := false
+	for _, t := range times {
+		turns = turns || a.angle.At(t).X() != angle
+	}
+	var rotated *AABB
+	if turns {
+		r := 0.0
+		for _, c := range child.Corners() {
+			r = math.Max(r, math.Hypot(c.X(), c.Z()))
+		}
+		rotated = NewAABB(geom.Vec{-r, child.Min().Y(), -r}, geom.Vec{r, child.Max().Y(), r})
+	} else {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		for _, c := range child.Corners() {
+			p := rotateY(c, sin, cos)
+			if rotated == nil {
+				rotated = NewAABB(p, p)
+			}
+			rotated = rotated.Extended(p)
+		}
+	}
+	var b *AABB
+	for _, t := range times {
+		offset := a.offset.At(t)
+		moved := NewAABB(rotated.Min().Plus(offset), rotated.Max().Plus(offset))
+		b = moved.Plus(b)
+	}
+	return b
+}
+
+// rotateY rotates v on the Y axis, in the same direction as RotateY, by the angle with the given sine and cosine.
+func rotateY(v geom.Vec, sin, cos float64) geom.Vec {
+	return geom.Vec{cos*v.X() + sin*v.Z(), v.Y(), -sin*v.X() + cos*v.Z()}
+}
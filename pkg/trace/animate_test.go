@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+func TestTrackAt(t *testing.T) {
+	v := func(x float64) geom.Vec { return geom.Vec{x, -x, 2 * x} }
+	linear := NewTrack(Key{Time: 1, Value: v(2)}, Key{Time: 3, Value: v(6)})
+	// a rise and fall, on either side of a key that isn't halfway in time.
+	bezier := NewTrack(
+		Key{Time: 2, Value: v(1), Interp: Bezier},
+		Key{Time: 0, Value: v(0), Interp: Bezier},
+		Key{Time: 4, Value: v(0), Interp: Bezier},
+	)
+	tests := []struct {
+		name  string
+		track Track
+		t     float64
+		want  geom.Vec
+	}{
+		{"empty", Track{}, 5, geom.Vec{}},
+		{"one key, before", NewTrack(Key{Time: 2, Value: v(3)}), -1, v(3)},
+		{"one key, at", NewTrack(Key{Time: 2, Value: v(3)}), 2, v(3)},
+		{"one key, after", NewTrack(Key{Time: 2, Value: v(3)}), 9, v(3)},
+		{"linear, before", linear, 0, v(2)},
+		{"linear, first", linear, 1, v(2)},
+		{"linear, middle", linear, 1.5, v(3)},
+		{"linear, last", linear, 3, v(6)},
+		{"linear, after", linear, 4, v(6)},
+		{"linear, infinitely before", linear, math.Inf(-1), v(2)},
+		{"linear, infinitely after", linear, math.Inf(1), v(6)},
+		{"bezier, first", bezier, 0, v(0)},
+		{"bezier, middle key", bezier, 2, v(1)},
+		{"bezier, last", bezier, 4, v(0)},
+		{"bezier, after", bezier, 5, v(0)},
+		// in the first segment, the handles are at 1/3 and 1 (the middle key's tangent is flat).
+		{"bezier, first segment", bezier, 1, v(0.375/3 + 0.375 + 0.125)},
+		{"bezier, second segment", bezier, 3, v(0.125 + 0.375 + 0.375/3)},
+		// evenly spaced keys in a line move at a constant rate.
+		{"bezier, in a line", NewTrack(
+			Key{Time: 0, Value: v(0), Interp: Bezier},
+			Key{Time: 1, Value: v(1), Interp: Bezier},
+			Key{Time: 2, Value: v(2), Interp: Bezier},
+		), 0.25, v(0.25)},
+		// a key's interpolation applies only to the segment that follows it.
+		{"linear then bezier", NewTrack(
+			Key{Time: 0, Value: v(0)},
+			Key{Time: 2, Value: v(1), Interp: Bezier},
+			Key{Time: 4, Value: v(0)},
+		), 1, v(0.5)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.track.At(test.t); !near(got, test.want) {
+				t.Errorf("At(%v) = %v, want %v", test.t, got, test.want)
+			}
+		})
+	}
+
+	// a bezier track is continuous through its middle key.
+	if a, b := bezier.At(2-1e-9), bezier.At(2+1e-9); a.Minus(b).Len() > 1e-6 {
+		t.Errorf("bezier track jumps from %v to %v at its middle key", a, b)
+	}
+}
+
+func TestAnimated(t *testing.T) {
+	offset := NewTrack(Key{Time: 0, Value: geom.Vec{0, 0, 0}}, Key{Time: 1, Value: geom.Vec{4, 0, 0}})
+	angle := NewTrack(Key{Time: 0, Value: geom.Vec{0}}, Key{Time: 1, Value: geom.Vec{90}})
+	box := NewBox(geom.Vec{1, 0, -0.5}, geom.Vec{2, 1, 0.5}, nil)
+	a := NewAnimated(box, offset, angle)
+
+	// at time 1, the box has turned to z -2 to -1 and moved to x 3.5 to 4.5.
+	r := NewRay(geom.Vec{4, 0.5, 5}, geom.Vec{0, 0, -1}.Unit(), 1)
+	hit := a.Hit(r, 0, math.MaxFloat64, nil)
+	if hit == nil {
+		t.Fatal("missed the box at time 1")
+	}
+	if !near(hit.Pt, geom.Vec{4, 0.5, -1}) || !near(geom.Vec(hit.Norm), geom.Vec{0, 0, 1}) {
+		t.Errorf("hit at %v with normal %v, want %v with normal %v", hit.Pt, hit.Norm, geom.Vec{4, 0.5, -1}, geom.Vec{0, 0, 1})
+	}
+	if hit := a.Hit(NewRay(geom.Vec{4, 0.5, 5}, geom.Vec{0, 0, -1}.Unit(), 0), 0, math.MaxFloat64, nil); hit != nil {
+		t.Errorf("hit the box at time 0 at %v", hit.Pt)
+	}
+
+	// the bounds hold the box swept around the Y axis along its path,
+	// within the padding of the box's own bounds.
+	close := func(a, b geom.Vec) bool { return a.Minus(b).Len() < 0.01 }
+	b := a.Bounds(0, 1)
+	rad := math.Hypot(2, 0.5)
+	if !close(b.Min(), geom.Vec{-rad, 0, -rad}) || !close(b.Max(), geom.Vec{4 + rad, 1, rad}) {
+		t.Errorf("bounds %v to %v", b.Min(), b.Max())
+	}
+	// without turning, the bounds are only the box's path.
+	b = NewAnimated(box, offset, nil).Bounds(0, 0.5)
+	if !close(b.Min(), geom.Vec{1, 0, -0.5}) || !close(b.Max(), geom.Vec{4, 1, 0.5}) {
+		t.Errorf("unturned bounds %v to %v", b.Min(), b.Max())
+	}
+
+	// an animated infinite surface has infinite bounds, rather than NaNs from moving infinity.
+	plane := NewAnimated(NewPlane(geom.Vec{}, geom.Vec{0, 1, 0}.Unit(), nil), offset, angle)
+	b = plane.Bounds(0, 1)
+	for i := 0; i < 3; i++ {
+		if !math.IsInf(b.Min()[i], -1) || !math.IsInf(b.Max()[i], 1) {
+			t.Fatalf("animated plane has bounds %v to %v", b.Min(), b.Max())
+		}
+	}
+	bvh := NewBVH(0, 1, plane, NewSphere(geom.Vec{0, 5, 0}, 1, nil))
+	if hit := bvh.Hit(NewRay(geom.Vec{100, 1, 100}, geom.Vec{0, -1, 0}.Unit(), 0.5), 0, math.MaxFloat64, nil); hit == nil || !near(hit.Pt, geom.Vec{100, 0, 100}) {
+		t.Errorf("bvh with an animated plane: got %+v", hit)
+	}
+}
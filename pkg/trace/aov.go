@@ -0,0 +1,220 @@
+package trace
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+// AOV is an arbitrary output variable:
+// an auxiliary image built from the first surface that each camera ray hits.
+type AOV int
+
+// Supported AOVs.
+// AOVDepth is the distance from the camera to the hit.
+// AOVNormal is the surface normal at the hit.
+// AOVAlbedo is the base color of the hit surface's material.
+// AOVPosition is the position of the hit in world space.
+// AOVUV is the texture coordinate of the hit.
+// AOVID is a number that identifies the hit surface,
+// which is stable across renders of the same scene; rays that hit nothing have ID 0.
+const (
+	AOVDepth AOV = iota
+	AOVNormal
+	AOVAlbedo
+	AOVPosition
+	AOVUV
+	AOVID
+)
+
+var aovNames = []string{"depth", "normal", "albedo", "position", "uv", "id"}
+
+// ParseAOV returns the AOV with the given name, like "depth" or "normal".
+func ParseAOV(name string) (AOV, error) {
+	for i, n := range aovNames {
+		if strings.EqualFold(name, n) {
+			return AOV(i), nil
+		}
+	}
+	return AOVDepth, fmt.Errorf("unknown AOV %q", name)
+}
+
+// String returns the name of the AOV.
+func (a AOV) String() string {
+	if a < 0 || int(a) >= len(aovNames) {
+		return fmt.Sprintf("AOV(%d)", int(a))
+	}
+	return aovNames[a]
+}
+
+// Data reports whether AOV a holds measurements, like distances, directions, and IDs, rather than colors.
+// Data AOVs can be negative or greater than 1, so only PFM and EXR images hold them faithfully;
+// the 8-bit formats would clamp and tone map them, and HDR can't store negative values.
+func (a AOV) Data() bool {
+	return a != AOVAlbedo
+}
+
+// channels returns the names of the AOV's channels in a multi-channel image.
+func (a AOV) channels() []string {
+	switch a {
+	case AOVDepth:
+		return []string{"Z"}
+	case AOVNormal, AOVPosition:
+		return []string{"X", "Y", "Z"}
+	case AOVAlbedo:
+		return []string{"R", "G", "B"}
+	case AOVUV:
+		return []string{"U", "V"}
+	}
+	return []string{"V"}
+}
+
+// Albedoer is implemented by materials that can report their base color
+// for the albedo AOV.
+// Materials that don't implement Albedoer have a white albedo.
+type Albedoer interface {
+	Albedo(uv, p geom.Vec) Color
+}
+
+// sample returns the value of AOV a for a camera ray that hit hit.
+// ids maps surfaces to their IDs.
+func (a AOV) sample(hit *Hit, ids map[Surface]int) Color {
+	if hit == nil {
+		return black
+	}
+	switch a {
+	case AOVDepth:
+		return Color{hit.Dist, hit.Dist, hit.Dist}
+	case AOVNormal:
+		return Color(hit.Norm)
+	case AOVAlbedo:
+		if al, ok := hit.Mat.(Albedoer); ok {
+			return al.Albedo(hit.UV, hit.Pt)
+		}
+		return white
+	case AOVPosition:
+		return Color(hit.Pt)
+	case AOVUV:
+		return Color(hit.UV)
+	case AOVID:
+		id := float64(ids[hit.Surface])
+		return Color{id, id, id}
+	}
+	return black
+}
+
+// surfaceIDs numbers every primitive surface within s, starting at 1,
+// in the order that walk finds them.
+// Within a BVH, that's the order of its leaves rather than the order the surfaces were added to the scene,
+// but it's the same for every render of the same scene.
+func surfaceIDs(s Surface) map[Surface]int {
+	ids := make(map[Surface]int)
+	walk(s, func(s Surface) {
+		if _, ok := ids[s]; !ok {
+			ids[s] = len(ids) + 1
+		}
+	})
+	return ids
+}
+
+// walk calls fn for each primitive surface within s:
+// those that aren't lists, hierarchies, or transforms of other surfaces.
+func walk(s Surface, fn func(Surface)) {
+	switch v := s.(type) {
+	case *List:
+		for _, c := range v.ss {
+			walk(c, fn)
+		}
+	case *Box:
+		walk(v.List, fn)
+	case *BVH:
+		if len(v.leaves) > 0 {
+			for _, l := range v.leaves {
+				walk(l.surface, fn)
+			}
+			return
+		}
+		walk(v.left, fn)
+		walk(v.right, fn)
+	case *Translate:
+		walk(v.child, fn)
+	case *RotateY:
+		walk(v.child, fn)
+	case *Animated:
+		walk(v.child, fn)
+	case *Flip:
+		walk(v.Surface, fn)
+	case *Counter:
+		walk(v.Surface, fn)
+	case *tested:
+		fn(v.Surface)
+	default:
+		fn(s)
+	}
+}
+
+// AOVs returns the AOVs that the frame has layers for.
+func (f *Frame) AOVs() []AOV {
+	as := make([]AOV, 0, len(f.layers))
+	for a := range f.layers {
+		as = append(as, a)
+	}
+	sort.Slice(as, func(i, j int) bool { return as[i] < as[j] })
+	return as
+}
+
+// Layer returns a new Frame containing the values of AOV a as colors,
+// or nil if the frame has no layer for a.
+// Vectors like normals and positions are stored as x, y, z in r, g, b.
+func (f *Frame) Layer(a AOV) *Frame {
+	if _, ok := f.layers[a]; !ok {
+		return nil
+	}
+	f2 := NewFrame(f.rect)
+	for y := f.rect.Min.Y; y < f.rect.Max.Y; y++ {
+		for x := f.rect.Min.X; x < f.rect.Max.X; x++ {
+			f2.SetPixel(x, y, Pixel{Sum: f.AOV(a, x, y), Samples: 1})
+		}
+	}
+	return f2
+}
+
+// AOV returns the value of AOV a at x, y.
+func (f *Frame) AOV(a AOV, x, y int) Color {
+	l, ok := f.layers[a]
+	if !ok || !(image.Point{x, y}.In(f.rect)) {
+		return black
+	}
+	i := f.offset(x, y)
+	if a == AOVID || f.pix[i].Samples == 0 {
+		return l[i]
+	}
+	return l[i].Scaled(1 / float64(f.pix[i].Samples))
+}
+
+// addLayer adds an empty layer for AOV a, if the frame doesn't have one already.
+func (f *Frame) addLayer(a AOV) []Color {
+	if f.layers == nil {
+		f.layers = make(map[AOV][]Color)
+	}
+	if _, ok := f.layers[a]; !ok {
+		f.layers[a] = make([]Color, len(f.pix))
+	}
+	return f.layers[a]
+}
+
+// addAOV accumulates a single sample of AOV a at pixel offset i.
+// IDs aren't averaged: each pixel keeps the ID of its first sample.
+func (f *Frame) addAOV(a AOV, i int, c Color) {
+	l := f.layers[a]
+	if a == AOVID {
+		if f.pix[i].Samples == 0 {
+			l[i] = c
+		}
+		return
+	}
+	l[i] = l[i].Plus(c)
+}
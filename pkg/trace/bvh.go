@@ -26,10 +26,26 @@ type BVH struct {
 }
 
 // NewBVH builds a new BVH containing surfaces in ss between times time0 and time1.
+// Surfaces with infinite bounds, like Planes, would make every split look equally bad,
+// so they're kept out of the hierarchy, in a leaf beside it, and tested by every ray.
 func NewBVH(time0, time1 float64, ss ...Surface) *BVH {
 	if len(ss) < 4 {
 		return newLeaf(time0, time1, ss)
 	}
+	var bounded, unbounded []Surface
+	for _, s := range ss {
+		if s.Bounds(time0, time1).infinite() {
+			unbounded = append(unbounded, s)
+		} else {
+			bounded = append(bounded, s)
+		}
+	}
+	if len(unbounded) > 0 {
+		if len(bounded) > 0 {
+			unbounded = append(unbounded, NewBVH(time0, time1, bounded...))
+		}
+		return newLeaf(time0, time1, unbounded)
+	}
 
 	cheapest := float64(len(ss)) * costIntersect
 	var left, right []Surface
@@ -105,6 +121,18 @@ func (b *BVH) Bounds(t0, t1 float64) *AABB {
 	return b.bounds
 }
 
+// Surfaces returns all the surfaces the BVH contains, in the order of its leaves.
+func (b *BVH) Surfaces() []Surface {
+	if len(b.leaves) > 0 {
+		ss := make([]Surface, len(b.leaves))
+		for i, l := range b.leaves {
+			ss[i] = l.surface
+		}
+		return ss
+	}
+	return append(b.left.Surfaces(), b.right.Surfaces()...)
+}
+
 func split(t0, t1 float64, axis int, fraction float64, ss []Surface) (ll, rr []Surface) {
 	ss2 := make([]Surface, len(ss))
 	copy(ss2, ss)
@@ -152,6 +180,30 @@ func NewAABB(min, max geom.Vec) *AABB {
 	return &AABB{min: min.Min(max), max: max.Max(min)}
 }
 
+// padded returns a bounding box from min to max, grown slightly,
+// so that a flat surface in an axis-aligned plane doesn't have an empty box.
+func padded(min, max geom.Vec) *AABB {
+	size := max.Minus(min)
+	pad := math.Max(size.X(), math.Max(size.Y(), size.Z())) * 1e-6
+	return NewAABB(min.Minus(geom.Vec{pad, pad, pad}), max.Plus(geom.Vec{pad, pad, pad}))
+}
+
+// infiniteAABB returns a bounding box that encloses all of space.
+func infiniteAABB() *AABB {
+	inf := math.Inf(1)
+	return NewAABB(geom.Vec{-inf, -inf, -inf}, geom.Vec{inf, inf, inf})
+}
+
+// infinite returns whether the box is infinite along any axis.
+func (a *AABB) infinite() bool {
+	for i := 0; i < 3; i++ {
+		if math.IsInf(a.min[i], 0) || math.IsInf(a.max[i], 0) {
+			return true
+		}
+	}
+	return false
+}
+
 // Hit returns whether or not r hits the box between distances dMin and dMax.
 func (a *AABB) Hit(r Ray, dMin, dMax float64) bool {
 	for i := 0; i < 3; i++ {
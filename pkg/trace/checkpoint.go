@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+// checkpointMagic identifies checkpoint files and their version.
+const checkpointMagic = "TRACECP5"
+
+// pixelSize is the number of bytes each pixel occupies in a checkpoint.
+const pixelSize = 88
+
+// checkpointHeader is the fixed-size header that precedes a checkpoint's pixels.
+type checkpointHeader struct {
+	Magic                  [8]byte
+	MinX, MinY, MaxX, MaxY int64
+	Seed                   int64
+	Width, Height          int64  // the size of the Window that rendered the frame
+	Filter                 uint64 // the filterID of the render's filter
+	Layers                 int64  // the number of AOV layers that follow the pixels
+}
+
+// WriteCheckpoint writes the frame's accumulated state to w,
+// so it can be restored with ReadCheckpoint and resumed with Window.Resume.
+func (f *Frame) WriteCheckpoint(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	h := checkpointHeader{
+		MinX:   int64(f.rect.Min.X),
+		MinY:   int64(f.rect.Min.Y),
+		MaxX:   int64(f.rect.Max.X),
+		MaxY:   int64(f.rect.Max.Y),
+		Seed:   f.seed,
+		Width:  int64(f.size.X),
+		Height: int64(f.size.Y),
+		Filter: f.filter,
+		Layers: int64(len(f.layers)),
+	}
+	copy(h.Magic[:], checkpointMagic)
+	if err := binary.Write(bw, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	buf := make([]byte, pixelSize)
+	for _, p := range f.pix {
+		for i := 0; i < 3; i++ {
+			binary.LittleEndian.PutUint64(buf[i*8:], math.Float64bits(p.Sum[i]))
+			binary.LittleEndian.PutUint64(buf[24+i*8:], math.Float64bits(p.SumSq[i]))
+		}
+		binary.LittleEndian.PutUint64(buf[48:], uint64(p.Samples))
+		for i := 0; i < 3; i++ {
+			binary.LittleEndian.PutUint64(buf[56+i*8:], math.Float64bits(p.Splat[i]))
+		}
+		binary.LittleEndian.PutUint64(buf[80:], math.Float64bits(p.Weight))
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	for _, a := range f.AOVs() {
+		binary.LittleEndian.PutUint64(buf, uint64(a))
+		if _, err := bw.Write(buf[:8]); err != nil {
+			return err
+		}
+		for _, c := range f.layers[a] {
+			for i := 0; i < 3; i++ {
+				binary.LittleEndian.PutUint64(buf[i*8:], math.Float64bits(c[i]))
+			}
+			if _, err := bw.Write(buf[:24]); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadCheckpoint restores a Frame from a checkpoint written by WriteCheckpoint.
+func ReadCheckpoint(r io.Reader) (*Frame, error) {
+	br := bufio.NewReader(r)
+	var h checkpointHeader
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if string(h.Magic[:]) != checkpointMagic {
+		return nil, errors.New("not a trace checkpoint")
+	}
+	rect := image.Rect(int(h.MinX), int(h.MinY), int(h.MaxX), int(h.MaxY))
+	if rect.Empty() {
+		return nil, errors.New("checkpoint has an empty frame")
+	}
+	f := NewFrame(rect)
+	f.seed = h.Seed
+	f.size = image.Pt(int(h.Width), int(h.Height))
+	f.filter = h.Filter
+	buf := make([]byte, pixelSize)
+	for i := range f.pix {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		p := &f.pix[i]
+		for j := 0; j < 3; j++ {
+			p.Sum[j] = math.Float64frombits(binary.LittleEndian.Uint64(buf[j*8:]))
+			p.SumSq[j] = math.Float64frombits(binary.LittleEndian.Uint64(buf[24+j*8:]))
+		}
+		p.Samples = int(binary.LittleEndian.Uint64(buf[48:]))
+		for j := 0; j < 3; j++ {
+			p.Splat[j] = math.Float64frombits(binary.LittleEndian.Uint64(buf[56+j*8:]))
+		}
+		p.Weight = math.Float64frombits(binary.LittleEndian.Uint64(buf[80:]))
+	}
+	for n := int64(0); n < h.Layers; n++ {
+		if _, err := io.ReadFull(br, buf[:8]); err != nil {
+			return nil, err
+		}
+		a := AOV(binary.LittleEndian.Uint64(buf))
+		if a < 0 || int(a) >= len(aovNames) {
+			return nil, fmt.Errorf("checkpoint has unknown AOV %d", int(a))
+		}
+		l := f.addLayer(a)
+		for i := range l {
+			if _, err := io.ReadFull(br, buf[:24]); err != nil {
+				return nil, err
+			}
+			for j := 0; j < 3; j++ {
+				l[i][j] = math.Float64frombits(binary.LittleEndian.Uint64(buf[j*8:]))
+			}
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,103 @@
+package trace
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// Counts are the number of rays traced into a Counter's surface,
+// and the number of intersection tests made against the primitives within it.
+type Counts struct {
+	Rays  int64
+	Tests int64
+}
+
+// Counter is a surface that counts the rays traced into another surface,
+// and the intersection tests made against that surface's primitives.
+// It's meant for measuring the cost of a scene, not for everyday renders:
+// counting is cheap, but not free.
+type Counter struct {
+	Surface
+	counts *Counts
+}
+
+// NewCounter returns a new Counter that counts the rays traced into s.
+// The Counter hits a copy of s, in which each primitive is wrapped to count its intersection tests;
+// s itself is left as it was.
+func NewCounter(s Surface) *Counter {
+	c := &Counter{counts: &Counts{}}
+	c.Surface = c.wrap(s)
+	return c
+}
+
+// Hit counts a ray and returns details of the intersection between r and the counted surface.
+// If r does not intersect with the surface, it returns nil.
+func (c *Counter) Hit(r Ray, dMin, dMax float64, rnd *rand.Rand) *Hit {
+	atomic.AddInt64(&c.counts.Rays, 1)
+	return c.Surface.Hit(r, dMin, dMax, rnd)
+}
+
+// Counts returns the number of rays and intersection tests counted so far.
+func (c *Counter) Counts() Counts {
+	return Counts{
+		Rays:  atomic.LoadInt64(&c.counts.Rays),
+		Tests: atomic.LoadInt64(&c.counts.Tests),
+	}
+}
+
+// wrap returns a copy of s whose primitives count their intersection tests.
+// Lists, hierarchies, transforms, and meshes are copied with wrapped children.
+func (c *Counter) wrap(s Surface) Surface {
+	switch v := s.(type) {
+	case *List:
+		l := &List{ss: make([]Surface, len(v.ss))}
+		for i, child := range v.ss {
+			l.ss[i] = c.wrap(child)
+		}
+		return l
+	case *Box:
+		return &Box{List: c.wrap(v.List).(*List)}
+	case *BVH:
+		b := *v
+		if len(v.leaves) > 0 {
+			b.leaves = make([]leaf, len(v.leaves))
+			for i, l := range v.leaves {
+				b.leaves[i] = leaf{bounds: l.bounds, surface: c.wrap(l.surface)}
+			}
+			return &b
+		}
+		b.left = c.wrap(v.left).(*BVH)
+		b.right = c.wrap(v.right).(*BVH)
+		return &b
+	case *Translate:
+		t := *v
+		t.child = c.wrap(v.child)
+		return &t
+	case *RotateY:
+		r := *v
+		r.child = c.wrap(v.child)
+		return &r
+	case *Animated:
+		a := *v
+		a.child = c.wrap(v.child)
+		return &a
+	case *Flip:
+		return &Flip{Surface: c.wrap(v.Surface)}
+	case *TriangleMesh:
+		m := *v
+		m.bvh = c.wrap(v.bvh).(*BVH)
+		return &m
+	}
+	return &tested{Surface: s, tests: &c.counts.Tests}
+}
+
+// tested is a primitive surface that counts the intersection tests made against it.
+type tested struct {
+	Surface
+	tests *int64
+}
+
+func (t *tested) Hit(r Ray, dMin, dMax float64, rnd *rand.Rand) *Hit {
+	atomic.AddInt64(t.tests, 1)
+	return t.Surface.Hit(r, dMin, dMax, rnd)
+}
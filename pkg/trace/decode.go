@@ -0,0 +1,98 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	imgcolor "image/color"
+	"io"
+)
+
+// Importing trace registers a PPM decoder with the image package,
+// so that image.Decode reads the PPM images that renders are written in by default,
+// along with PNG and JPEG.
+func init() {
+	image.RegisterFormat("ppm", "P3", decodePPM, decodePPMConfig)
+	image.RegisterFormat("ppm", "P6", decodePPM, decodePPMConfig)
+}
+
+// ppmHeader reads the magic number, dimensions, and maximum value of a PPM image.
+func ppmHeader(r *bufio.Reader) (magic string, width, height, max int, err error) {
+	if _, err = fmt.Fscan(r, &magic, &width, &height, &max); err != nil {
+		return "", 0, 0, 0, fmt.Errorf("reading ppm header: %v", err)
+	}
+	if magic != "P3" && magic != "P6" {
+		return "", 0, 0, 0, fmt.Errorf("unsupported ppm type %q", magic)
+	}
+	if width < 0 || height < 0 || max < 1 || max > 65535 {
+		return "", 0, 0, 0, fmt.Errorf("invalid ppm header: %dx%d, max %d", width, height, max)
+	}
+	return magic, width, height, max, nil
+}
+
+func decodePPMConfig(r io.Reader) (image.Config, error) {
+	_, w, h, _, err := ppmHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: imgcolor.RGBA64Model, Width: w, Height: h}, nil
+}
+
+// decodePPM reads a plain (P3) or raw (P6) PPM image.
+// Comments in the header aren't supported.
+func decodePPM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	magic, w, h, max, err := ppmHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	im := image.NewRGBA64(image.Rect(0, 0, w, h))
+	scale := func(v int) uint16 {
+		if v < 0 {
+			v = 0
+		} else if v > max {
+			v = max
+		}
+		return uint16(v * 0xffff / max)
+	}
+	if magic == "P3" {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				var r, g, b int
+				if _, err := fmt.Fscan(br, &r, &g, &b); err != nil {
+					return nil, fmt.Errorf("reading ppm pixel %d,%d: %v", x, y, err)
+				}
+				im.SetRGBA64(x, y, imgcolor.RGBA64{scale(r), scale(g), scale(b), 0xffff})
+			}
+		}
+		return im, nil
+	}
+
+	// a single whitespace character separates the header from the binary samples,
+	// which are one byte each, or two big-endian bytes if max is above 255.
+	if _, err := br.ReadByte(); err != nil {
+		return nil, err
+	}
+	size := 1
+	if max > 255 {
+		size = 2
+	}
+	row := make([]byte, w*3*size)
+	for y := 0; y < h; y++ {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, fmt.Errorf("reading ppm row %d: %v", y, err)
+		}
+		for x := 0; x < w; x++ {
+			var c [3]int
+			for i := range c {
+				j := (x*3 + i) * size
+				c[i] = int(row[j])
+				if size == 2 {
+					c[i] = c[i]<<8 | int(row[j+1])
+				}
+			}
+			im.SetRGBA64(x, y, imgcolor.RGBA64{scale(c[0]), scale(c[1]), scale(c[2]), 0xffff})
+		}
+	}
+	return im, nil
+}
@@ -0,0 +1,188 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// Format is an image file format that renders can be written in.
+type Format int
+
+// Supported output formats.
+// PPM, PNG, and JPEG are 8-bit formats, tone mapped by the frame's Tone.
+// HDR (Radiance RGBE) and PFM (Portable Float Map) store linear,
+// floating-point color values before tone mapping.
+// EXR (OpenEXR) stores linear, floating-point color values
+// along with a layer for each of the frame's AOVs.
+const (
+	PPM Format = iota
+	PNG
+	JPEG
+	HDR
+	PFM
+	EXR
+)
+
+var formatNames = map[string]Format{
+	"ppm":  PPM,
+	"png":  PNG,
+	"jpg":  JPEG,
+	"jpeg": JPEG,
+	"hdr":  HDR,
+	"pfm":  PFM,
+	"exr":  EXR,
+}
+
+// ParseFormat returns the Format with the given name, like "png" or "hdr".
+func ParseFormat(name string) (Format, error) {
+	f, ok := formatNames[strings.ToLower(name)]
+	if !ok {
+		return PPM, fmt.Errorf("unknown image format %q", name)
+	}
+	return f, nil
+}
+
+// FormatOf returns the Format that matches the extension of the file at path.
+func FormatOf(path string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return PPM, fmt.Errorf("no file extension in %q", path)
+	}
+	return ParseFormat(ext)
+}
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case PPM:
+		return "ppm"
+	case PNG:
+		return "png"
+	case JPEG:
+		return "jpeg"
+	case HDR:
+		return "hdr"
+	case PFM:
+		return "pfm"
+	case EXR:
+		return "exr"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Encode writes the frame to w in format format.
+func (f *Frame) Encode(w io.Writer, format Format) error {
+	switch format {
+	case PPM:
+		return encodePPM(w, f)
+	case PNG:
+		return png.Encode(w, f.RGBA())
+	case JPEG:
+		return jpeg.Encode(w, f.RGBA(), &jpeg.Options{Quality: 95})
+	case HDR:
+		return encodeHDR(w, f)
+	case PFM:
+		return encodePFM(w, f)
+	case EXR:
+		return encodeEXR(w, f)
+	}
+	return fmt.Errorf("unsupported format %v", format)
+}
+
+// RGBA converts the frame into an 8-bit image, tone mapped by the frame's Tone.
+func (f *Frame) RGBA() *image.RGBA {
+	im := image.NewRGBA(f.rect)
+	for y := f.rect.Min.Y; y < f.rect.Max.Y; y++ {
+		for x := f.rect.Min.X; x < f.rect.Max.X; x++ {
+			i := im.PixOffset(x, y)
+			im.Pix[i], im.Pix[i+1], im.Pix[i+2] = f.tone.RGB(f.Color(x, y))
+			im.Pix[i+3] = 255
+		}
+	}
+	return im
+}
+
+func encodePPM(w io.Writer, f *Frame) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "P3\n", f.rect.Dx(), f.rect.Dy(), "\n255\n")
+	for y := f.rect.Min.Y; y < f.rect.Max.Y; y++ {
+		for x := f.rect.Min.X; x < f.rect.Max.X; x++ {
+			r, g, b := f.tone.RGB(f.Color(x, y))
+			fmt.Fprintln(bw, r, g, b)
+		}
+	}
+	return bw.Flush()
+}
+
+// encodeHDR writes a Radiance RGBE image with run-length encoded scanlines.
+func encodeHDR(w io.Writer, f *Frame) error {
+	width, height := f.rect.Dx(), f.rect.Dy()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", height, width)
+	rle := width >= 8 && width < 0x8000
+	line := make([]byte, width*4)
+	channel := make([]byte, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			copy(line[x*4:], rgbe(f.Color(f.rect.Min.X+x, f.rect.Min.Y+y)))
+		}
+		if !rle {
+			bw.Write(line)
+			continue
+		}
+		bw.Write([]byte{2, 2, byte(width >> 8), byte(width & 0xff)})
+		for ch := 0; ch < 4; ch++ {
+			for x := 0; x < width; x++ {
+				channel[x] = line[x*4+ch]
+			}
+			// the data is written as uncompressed "dump" runs of up to 128 bytes.
+			for start := 0; start < width; start += 128 {
+				end := start + 128
+				if end > width {
+					end = width
+				}
+				bw.WriteByte(byte(end - start))
+				bw.Write(channel[start:end])
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// rgbe converts a linear color into Radiance's shared-exponent format.
+func rgbe(c Color) []byte {
+	r, g, b := math.Max(c.R(), 0), math.Max(c.G(), 0), math.Max(c.B(), 0)
+	v := math.Max(r, math.Max(g, b))
+	if v < 1e-32 {
+		return []byte{0, 0, 0, 0}
+	}
+	m, e := math.Frexp(v)
+	scale := m * 256 / v
+	return []byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(e + 128)}
+}
+
+// encodePFM writes a little-endian Portable Float Map.
+// PFM scanlines are stored bottom-to-top.
+func encodePFM(w io.Writer, f *Frame) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", f.rect.Dx(), f.rect.Dy())
+	buf := make([]byte, 12)
+	for y := f.rect.Max.Y - 1; y >= f.rect.Min.Y; y-- {
+		for x := f.rect.Min.X; x < f.rect.Max.X; x++ {
+			c := f.Color(x, y)
+			for i := 0; i < 3; i++ {
+				binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(c[i])))
+			}
+			bw.Write(buf)
+		}
+	}
+	return bw.Flush()
+}
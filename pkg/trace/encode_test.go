@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+// gradient returns a frame over r whose colors differ at every pixel.
+func gradient(r image.Rectangle) *Frame {
+	f := NewFrame(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			f.Add(x, y, Color{float64(x%256) / 64, float64(y) / 8, float64((x*7+y)%100) / 10})
+		}
+	}
+	return f
+}
+
+func TestEncodeHDR(t *testing.T) {
+	tests := []struct {
+		width int
+		rle   bool
+	}{
+		// scanlines narrower than 8 or wider than 32767 pixels can't be run-length encoded.
+		{1, false},
+		{7, false},
+		{8, true},
+		{129, true}, // more than one run of 128 per channel
+		{256, true},
+		{0x7fff, true},
+		{0x8000, false},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.width), func(t *testing.T) {
+			f := gradient(image.Rect(0, 3, test.width, 5))
+			var buf bytes.Buffer
+			if err := f.Encode(&buf, HDR); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.Bytes()
+			header := fmt.Sprintf("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 2 +X %d\n", test.width)
+			if !bytes.HasPrefix(data, []byte(header)) {
+				t.Fatalf("header %q, want %q", data[:len(header)], header)
+			}
+			data = data[len(header):]
+			for y := 3; y < 5; y++ {
+				line := make([]byte, test.width*4)
+				if test.rle {
+					if want := []byte{2, 2, byte(test.width >> 8), byte(test.width)}; !bytes.Equal(data[:4], want) {
+						t.Fatalf("row %d begins %v, want %v", y, data[:4], want)
+					}
+					data = data[4:]
+					for ch := 0; ch < 4; ch++ {
+						for x := 0; x < test.width; {
+							n := int(data[0])
+							if n == 0 || n > 128 || x+n > test.width {
+								t.Fatalf("row %d channel %d has a run of %d at %d", y, ch, n, x)
+							}
+							for i := 0; i < n; i++ {
+								line[(x+i)*4+ch] = data[1+i]
+							}
+							data, x = data[1+n:], x+n
+						}
+					}
+				} else {
+					copy(line, data)
+					data = data[len(line):]
+				}
+				for x := 0; x < test.width; x++ {
+					if got, want := line[x*4:x*4+4], rgbe(f.Color(x, y)); !bytes.Equal(got, want) {
+						t.Fatalf("pixel %d,%d is %v, want %v", x, y, got, want)
+					}
+				}
+			}
+			if len(data) != 0 {
+				t.Errorf("%d bytes after the last row", len(data))
+			}
+		})
+	}
+}
+
+func TestRGBE(t *testing.T) {
+	tests := []struct {
+		c    Color
+		want []byte
+	}{
+		{Color{1, 0.5, 0.25}, []byte{128, 64, 32, 129}},
+		{Color{0, 0, 3}, []byte{0, 0, 192, 130}},
+		{Color{0.1, 0, 0}, []byte{204, 0, 0, 125}},
+		{Color{-1, 0.5, 0}, []byte{0, 128, 0, 128}}, // negative channels are clamped
+		{Color{0, 0, 0}, []byte{0, 0, 0, 0}},
+		{Color{1e-40, 0, 0}, []byte{0, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		if got := rgbe(test.c); !bytes.Equal(got, test.want) {
+			t.Errorf("rgbe(%v) = %v, want %v", test.c, got, test.want)
+		}
+	}
+}
+
+func TestEncodePFM(t *testing.T) {
+	// a cropped frame, away from the origin, with negative values that a PFM keeps.
+	r := image.Rect(5, 10, 8, 12)
+	f := NewFrame(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			f.Add(x, y, Color{float64(x), -float64(y), 0.25})
+		}
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf, PFM); err != nil {
+		t.Fatal(err)
+	}
+	// a negative scale means the floats are little-endian.
+	const header = "PF\n3 2\n-1.0\n"
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte(header)) {
+		t.Fatalf("header %q, want %q", data[:len(header)], header)
+	}
+	data = data[len(header):]
+	if len(data) != 3*2*12 {
+		t.Fatalf("got %d bytes of pixels, want %d", len(data), 3*2*12)
+	}
+	// rows are stored from the bottom up.
+	for i, y := range []int{11, 10} {
+		for x := 5; x < 8; x++ {
+			off := (i*3 + x - 5) * 12
+			var got Color
+			for c := range got {
+				got[c] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[off+c*4:])))
+			}
+			if want := (Color{float64(x), -float64(y), 0.25}); got != want {
+				t.Errorf("pixel %d,%d is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+)
+
+// exrChannel is one channel of an OpenEXR image and how to read its values from a Frame.
+type exrChannel struct {
+	name  string
+	value func(x, y int) float64
+}
+
+// encodeEXR writes an uncompressed, scanline OpenEXR image with 32-bit float channels.
+// The image contains R, G, and B channels for the rendered color,
+// plus a layer of channels (like "normal.X") for each of the frame's AOVs.
+func encodeEXR(w io.Writer, f *Frame) error {
+	chans := []exrChannel{
+		{"R", func(x, y int) float64 { return f.Color(x, y)[0] }},
+		{"G", func(x, y int) float64 { return f.Color(x, y)[1] }},
+		{"B", func(x, y int) float64 { return f.Color(x, y)[2] }},
+	}
+	for _, a := range f.AOVs() {
+		for i, name := range a.channels() {
+			a, i := a, i
+			chans = append(chans, exrChannel{
+				name:  a.String() + "." + name,
+				value: func(x, y int) float64 { return f.AOV(a, x, y)[i] },
+			})
+		}
+	}
+	// channels must be stored in alphabetical order.
+	sort.Slice(chans, func(i, j int) bool { return chans[i].name < chans[j].name })
+
+	var h bytes.Buffer
+	le := binary.LittleEndian
+	h.Write([]byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0})
+	attr := func(name, kind string, value []byte) {
+		h.WriteString(name + "\x00" + kind + "\x00")
+		binary.Write(&h, le, int32(len(value)))
+		h.Write(value)
+	}
+	var cl bytes.Buffer
+	for _, c := range chans {
+		cl.WriteString(c.name + "\x00")
+		binary.Write(&cl, le, []int32{2, 0, 1, 1}) // FLOAT, pLinear and reserved, xSampling, ySampling
+	}
+	cl.WriteByte(0)
+	box := new(bytes.Buffer)
+	binary.Write(box, le, []int32{
+		int32(f.rect.Min.X), int32(f.rect.Min.Y),
+		int32(f.rect.Max.X - 1), int32(f.rect.Max.Y - 1),
+	})
+	float := func(v float32) []byte {
+		b := make([]byte, 4)
+		le.PutUint32(b, math.Float32bits(v))
+		return b
+	}
+	attr("channels", "chlist", cl.Bytes())
+	attr("compression", "compression", []byte{0})
+	attr("dataWindow", "box2i", box.Bytes())
+	attr("displayWindow", "box2i", box.Bytes())
+	attr("lineOrder", "lineOrder", []byte{0})
+	attr("pixelAspectRatio", "float", float(1))
+	attr("screenWindowCenter", "v2f", append(float(0), float(0)...))
+	attr("screenWindowWidth", "float", float(1))
+	h.WriteByte(0)
+
+	// each scanline is its own chunk, listed in an offset table after the header.
+	width, height := f.rect.Dx(), f.rect.Dy()
+	size := width * len(chans) * 4
+	bw := bufio.NewWriter(w)
+	bw.Write(h.Bytes())
+	start := int64(h.Len() + height*8)
+	for y := 0; y < height; y++ {
+		binary.Write(bw, le, uint64(start+int64(y*(8+size))))
+	}
+	line := make([]byte, size)
+	for y := f.rect.Min.Y; y < f.rect.Max.Y; y++ {
+		binary.Write(bw, le, []int32{int32(y), int32(size)})
+		i := 0
+		for _, c := range chans {
+			for x := f.rect.Min.X; x < f.rect.Max.X; x++ {
+				le.PutUint32(line[i:], math.Float32bits(float32(c.value(x, y))))
+				i += 4
+			}
+		}
+		bw.Write(line)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,204 @@
+package trace
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+// Filter reconstructs pixels from samples by weighing each sample's
+// contribution to the pixels around it.
+type Filter interface {
+	// Radius is the distance, in pixels, beyond which a sample has no weight.
+	Radius() float64
+	// Weight returns the weight of a sample that is dx, dy pixels from a pixel's center.
+	// The weights of the filters in this package are normalized to integrate to 1 over the filter's radius,
+	// so a sample's weights on the pixels around it sum to about 1.
+	Weight(dx, dy float64) float64
+}
+
+// ParseFilter returns the filter with the given name and its default radius.
+// Names are "box", "tent", "gaussian", "mitchell", and "lanczos".
+func ParseFilter(name string) (Filter, error) {
+	switch strings.ToLower(name) {
+	case "box":
+		return NewBoxFilter(0.5), nil
+	case "tent":
+		return NewTentFilter(1), nil
+	case "gaussian":
+		return NewGaussianFilter(1.5, 2), nil
+	case "mitchell":
+		return NewMitchellFilter(2, 1.0/3, 1.0/3), nil
+	case "lanczos":
+		return NewLanczosFilter(2), nil
+	}
+	return nil, fmt.Errorf("unknown filter %q", name)
+}
+
+// filterID identifies a filter by its type and parameters,
+// so a checkpoint can tell whether it's resumed with the filter it was rendered with.
+// A nil filter is 0.
+func filterID(fl Filter) uint64 {
+	if fl == nil {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%T %v", fl, fl)
+	return h.Sum64()
+}
+
+// BoxFilter weighs all samples within its radius equally.
+// With a radius of 0.5, each sample contributes only to the pixel it was traced through.
+type BoxFilter struct {
+	radius float64
+}
+
+// NewBoxFilter returns a new box filter with the given radius.
+func NewBoxFilter(radius float64) *BoxFilter {
+	return &BoxFilter{radius: radius}
+}
+
+// Radius returns the filter's radius.
+func (b *BoxFilter) Radius() float64 {
+	return b.radius
+}
+
+// Weight returns the same weight everywhere within the filter's radius.
+func (b *BoxFilter) Weight(dx, dy float64) float64 {
+	if math.Abs(dx) > b.radius || math.Abs(dy) > b.radius {
+		return 0
+	}
+	return 1 / (4 * b.radius * b.radius)
+}
+
+// TentFilter weighs samples linearly less as they get farther from a pixel's center.
+type TentFilter struct {
+	radius float64
+}
+
+// NewTentFilter returns a new tent (triangle) filter with the given radius.
+func NewTentFilter(radius float64) *TentFilter {
+	return &TentFilter{radius: radius}
+}
+
+// Radius returns the filter's radius.
+func (t *TentFilter) Radius() float64 {
+	return t.radius
+}
+
+// Weight returns the product of the linear falloffs along x and y.
+func (t *TentFilter) Weight(dx, dy float64) float64 {
+	area := t.radius * t.radius // of each falloff
+	return math.Max(0, t.radius-math.Abs(dx)) * math.Max(0, t.radius-math.Abs(dy)) / (area * area)
+}
+
+// GaussianFilter weighs samples along a Gaussian curve, shifted to reach zero at its radius.
+type GaussianFilter struct {
+	radius, alpha float64
+	edge          float64
+	area          float64 // of the shifted curve, from -radius to radius
+}
+
+// NewGaussianFilter returns a new Gaussian filter with the given radius and falloff rate alpha.
+func NewGaussianFilter(radius, alpha float64) *GaussianFilter {
+	edge := math.Exp(-alpha * radius * radius)
+	area := math.Sqrt(math.Pi/alpha)*math.Erf(radius*math.Sqrt(alpha)) - 2*radius*edge
+	return &GaussianFilter{radius: radius, alpha: alpha, edge: edge, area: area}
+}
+
+// Radius returns the filter's radius.
+func (g *GaussianFilter) Radius() float64 {
+	return g.radius
+}
+
+// Weight returns the product of the Gaussian curves along x and y.
+func (g *GaussianFilter) Weight(dx, dy float64) float64 {
+	return g.gaussian(dx) * g.gaussian(dy)
+}
+
+func (g *GaussianFilter) gaussian(d float64) float64 {
+	return math.Max(0, math.Exp(-g.alpha*d*d)-g.edge) / g.area
+}
+
+// MitchellFilter is the Mitchell-Netravali cubic filter.
+// It balances blurring against ringing with its parameters b and c;
+// b = c = 1/3 is the usual recommendation.
+type MitchellFilter struct {
+	radius, b, c float64
+}
+
+// NewMitchellFilter returns a new Mitchell-Netravali filter with the given radius and parameters.
+func NewMitchellFilter(radius, b, c float64) *MitchellFilter {
+	return &MitchellFilter{radius: radius, b: b, c: c}
+}
+
+// Radius returns the filter's radius.
+func (m *MitchellFilter) Radius() float64 {
+	return m.radius
+}
+
+// Weight returns the product of the cubic curves along x and y.
+func (m *MitchellFilter) Weight(dx, dy float64) float64 {
+	// each cubic is stretched from its usual width of 4 to the filter's diameter,
+	// which scales its area of 1 by radius / 2.
+	area := m.radius / 2
+	return m.cubic(dx/m.radius) * m.cubic(dy/m.radius) / (area * area)
+}
+
+// cubic evaluates the filter at x, which is scaled to the range -1 to 1.
+func (m *MitchellFilter) cubic(x float64) float64 {
+	b, c := m.b, m.c
+	x = math.Abs(2 * x)
+	if x > 2 {
+		return 0
+	}
+	if x > 1 {
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	}
+	return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+}
+
+// LanczosFilter is a sinc filter windowed by a wider sinc.
+// It keeps edges sharp, at the cost of some ringing.
+type LanczosFilter struct {
+	radius float64
+	area   float64 // of the windowed sinc, from -radius to radius
+}
+
+// NewLanczosFilter returns a new Lanczos filter with the given radius.
+func NewLanczosFilter(radius float64) *LanczosFilter {
+	l := LanczosFilter{radius: radius, area: 1}
+	// the windowed sinc has no closed-form integral, so it's summed in small steps.
+	const steps = 4096
+	sum, step := 0.0, 2*radius/steps
+	for i := 0; i < steps; i++ {
+		sum += l.windowed(-radius+(float64(i)+0.5)*step) * step
+	}
+	l.area = sum
+	return &l
+}
+
+// Radius returns the filter's radius.
+func (l *LanczosFilter) Radius() float64 {
+	return l.radius
+}
+
+// Weight returns the product of the windowed sinc functions along x and y.
+func (l *LanczosFilter) Weight(dx, dy float64) float64 {
+	return l.windowed(dx) * l.windowed(dy)
+}
+
+func (l *LanczosFilter) windowed(d float64) float64 {
+	if math.Abs(d) > l.radius {
+		return 0
+	}
+	return sinc(d) * sinc(d/l.radius) / l.area
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
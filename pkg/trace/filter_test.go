@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFilterWeights(t *testing.T) {
+	filters := []Filter{
+		NewBoxFilter(0.5),
+		NewBoxFilter(1.5),
+		NewTentFilter(1),
+		NewTentFilter(2),
+		NewGaussianFilter(1.5, 2),
+		NewGaussianFilter(3, 0.5),
+		NewMitchellFilter(2, 1.0/3, 1.0/3),
+		NewMitchellFilter(3, 0, 0.5),
+		NewLanczosFilter(2),
+		NewLanczosFilter(3),
+	}
+	for _, fl := range filters {
+		t.Run(fmt.Sprintf("%T %v", fl, fl.Radius()), func(t *testing.T) {
+			r := fl.Radius()
+
+			// the weights integrate to 1 over the filter's square.
+			const steps = 400
+			step := 2 * r / steps
+			sum := 0.0
+			for i := 0; i < steps; i++ {
+				for j := 0; j < steps; j++ {
+					sum += fl.Weight(-r+(float64(i)+0.5)*step, -r+(float64(j)+0.5)*step) * step * step
+				}
+			}
+			if math.Abs(sum-1) > 1e-3 {
+				t.Errorf("weights integrate to %v, want 1", sum)
+			}
+
+			// the weights of a sample on the centers of the pixels around it sum to about 1.
+			rnd := rand.New(rand.NewSource(1))
+			for k := 0; k < 20; k++ {
+				sx, sy := rnd.Float64(), rnd.Float64()
+				sum := 0.0
+				for y := -4; y <= 4; y++ {
+					for x := -4; x <= 4; x++ {
+						sum += fl.Weight(float64(x)+0.5-sx, float64(y)+0.5-sy)
+					}
+				}
+				if math.Abs(sum-1) > 0.05 {
+					t.Fatalf("sample at %.3f, %.3f has weights summing to %v, want about 1", sx, sy, sum)
+				}
+			}
+
+			// beyond the radius, samples have no weight.
+			for _, d := range [][2]float64{{r + 1e-9, 0}, {0, -r - 1e-9}, {r * 2, r * 2}, {-r - 0.5, 0.1}} {
+				if w := fl.Weight(d[0], d[1]); w != 0 {
+					t.Errorf("weight at %v is %v, beyond the radius of %v", d, w, r)
+				}
+			}
+			if w := fl.Weight(0, 0); w <= 0 {
+				t.Errorf("weight at the center is %v", w)
+			}
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		radius float64
+	}{
+		{"box", 0.5},
+		{"tent", 1},
+		{"Gaussian", 1.5},
+		{"MITCHELL", 2},
+		{"lanczos", 2},
+	}
+	for _, test := range tests {
+		fl, err := ParseFilter(test.name)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if fl.Radius() != test.radius {
+			t.Errorf("%s: radius %v, want %v", test.name, fl.Radius(), test.radius)
+		}
+	}
+	for _, name := range []string{"", "sinc", "box:2"} {
+		if fl, err := ParseFilter(name); err == nil {
+			t.Errorf("ParseFilter(%q) = %T, want an error", name, fl)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package trace
+
+import (
+	"image"
+	imgcolor "image/color"
+	"math"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+// Pixel is the accumulated result of tracing samples through one pixel.
+// Sum, SumSq, and Samples count only the samples traced through the pixel itself.
+// When a render uses a Filter, Splat and Weight also accumulate
+// the weighted samples of neighboring pixels.
+type Pixel struct {
+	Sum     Color
+	SumSq   Color // the sum of each sample's squared color
+	Samples int
+	Splat   Color // the weighted sum of filtered samples
+	Weight  float64
+}
+
+// Color returns the pixel's color:
+// the weighted average of its filtered samples, if it has any,
+// or else the average of its own samples.
+func (p Pixel) Color() Color {
+	if p.Weight != 0 {
+		return p.Splat.Scaled(1 / p.Weight)
+	}
+	if p.Samples == 0 {
+		return black
+	}
+	return p.Sum.Scaled(1 / float64(p.Samples))
+}
+
+// Variance returns the sample variance of each color channel.
+func (p Pixel) Variance() Color {
+	if p.Samples < 2 {
+		return black
+	}
+	n := float64(p.Samples)
+	mean := p.Sum.Scaled(1 / n)
+	v := p.SumSq.Scaled(1 / n).Plus(mean.Times(mean).Scaled(-1)).Scaled(n / (n - 1))
+	return Color(geom.Vec(v).Max(geom.Vec{}))
+}
+
+// Error estimates how far the pixel's color may be from its converged value:
+// it's the largest relative standard error of the mean of any color channel.
+// Dark pixels are compared to a floor of 0.01 rather than their own brightness.
+func (p Pixel) Error() float64 {
+	if p.Samples < 2 {
+		return math.Inf(1)
+	}
+	mean := p.Sum.Scaled(1 / float64(p.Samples))
+	v := p.Variance()
+	e := 0.0
+	for i := 0; i < 3; i++ {
+		e = math.Max(e, math.Sqrt(v[i]/float64(p.Samples))/(mean[i]+0.01))
+	}
+	return e
+}
+
+// Frame is an in-memory framebuffer of linear, floating-point colors.
+// Each pixel accumulates the samples traced through it.
+//
+// Frame implements image.Image and draw.Image.
+// Through those interfaces, colors are 8-bit sRGB values,
+// tone mapped by the frame's Tone as they would appear in a PNG or PPM.
+type Frame struct {
+	rect   image.Rectangle
+	pix    []Pixel
+	layers map[AOV][]Color
+	seed   int64
+	tone   Tone
+	size   image.Point // the size of the Window that rendered the frame, or zero if unknown
+	filter uint64      // the filterID of the render's filter
+}
+
+// NewFrame creates a new, empty Frame that covers rectangle r.
+func NewFrame(r image.Rectangle) *Frame {
+	return &Frame{rect: r, pix: make([]Pixel, r.Dx()*r.Dy())}
+}
+
+// ColorModel returns the frame's color model.
+func (f *Frame) ColorModel() imgcolor.Model {
+	return imgcolor.RGBAModel
+}
+
+// Bounds returns the rectangle covered by the frame.
+func (f *Frame) Bounds() image.Rectangle {
+	return f.rect
+}
+
+// At returns the tone mapped color of the pixel at x, y.
+func (f *Frame) At(x, y int) imgcolor.Color {
+	if !(image.Point{x, y}.In(f.rect)) {
+		return imgcolor.RGBA{}
+	}
+	r, g, b := f.tone.RGB(f.Color(x, y))
+	return imgcolor.RGBA{R: r, G: g, B: b, A: 255}
+}
+
+// Set replaces the pixel at x, y with a single sample of the linear equivalent of c.
+// It reverses the sRGB curve and exposure of the frame's Tone, but not its Operator.
+func (f *Frame) Set(x, y int, c imgcolor.Color) {
+	r, g, b, _ := c.RGBA()
+	lin := Color{linear(float64(r) / 0xffff), linear(float64(g) / 0xffff), linear(float64(b) / 0xffff)}
+	lin = lin.Scaled(math.Exp2(-f.tone.Exposure))
+	f.SetPixel(x, y, Pixel{Sum: lin, SumSq: lin.Times(lin), Samples: 1})
+}
+
+// Pixel returns the accumulated samples at x, y.
+func (f *Frame) Pixel(x, y int) Pixel {
+	if !(image.Point{x, y}.In(f.rect)) {
+		return Pixel{}
+	}
+	return f.pix[f.offset(x, y)]
+}
+
+// SetPixel replaces the accumulated samples at x, y with p.
+func (f *Frame) SetPixel(x, y int, p Pixel) {
+	if !(image.Point{x, y}.In(f.rect)) {
+		return
+	}
+	f.pix[f.offset(x, y)] = p
+}
+
+// Add accumulates a single sample of color c at x, y.
+func (f *Frame) Add(x, y int, c Color) {
+	if !(image.Point{x, y}.In(f.rect)) {
+		return
+	}
+	p := &f.pix[f.offset(x, y)]
+	p.Sum = p.Sum.Plus(c)
+	p.SumSq = p.SumSq.Plus(c.Times(c))
+	p.Samples++
+}
+
+// splat adds a sample of color c at continuous position sx, sy
+// to the filtered colors of every pixel within the radius of filter fl.
+func (f *Frame) splat(sx, sy float64, c Color, fl Filter) {
+	r := fl.Radius()
+	x0 := int(math.Ceil(sx - r - 0.5))
+	x1 := int(math.Floor(sx + r - 0.5))
+	y0 := int(math.Ceil(sy - r - 0.5))
+	y1 := int(math.Floor(sy + r - 0.5))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if !(image.Point{x, y}.In(f.rect)) {
+				continue
+			}
+			w := fl.Weight(float64(x)+0.5-sx, float64(y)+0.5-sy)
+			if w == 0 {
+				continue
+			}
+			p := &f.pix[f.offset(x, y)]
+			p.Splat = p.Splat.Plus(c.Scaled(w))
+			p.Weight += w
+		}
+	}
+}
+
+// Merge accumulates the samples of every pixel in f2 into the overlapping pixels of f,
+// including any AOV layers.
+func (f *Frame) Merge(f2 *Frame) {
+	r := f.rect.Intersect(f2.rect)
+	for a, l2 := range f2.layers {
+		l := f.addLayer(a)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				i, i2 := f.offset(x, y), f2.offset(x, y)
+				if a != AOVID {
+					l[i] = l[i].Plus(l2[i2])
+				} else if f.pix[i].Samples == 0 {
+					l[i] = l2[i2]
+				}
+			}
+		}
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p := &f.pix[f.offset(x, y)]
+			p2 := f2.pix[f2.offset(x, y)]
+			p.Sum = p.Sum.Plus(p2.Sum)
+			p.SumSq = p.SumSq.Plus(p2.SumSq)
+			p.Samples += p2.Samples
+			p.Splat = p.Splat.Plus(p2.Splat)
+			p.Weight += p2.Weight
+		}
+	}
+}
+
+// Crop returns a copy of the part of the frame within r.
+func (f *Frame) Crop(r image.Rectangle) *Frame {
+	f2 := NewFrame(r.Intersect(f.rect))
+	f2.seed = f.seed
+	f2.tone = f.tone
+	f2.size, f2.filter = f.size, f.filter
+	f2.Merge(f)
+	return f2
+}
+
+// Tone returns the tone mapping that converts the frame's colors for display.
+func (f *Frame) Tone() Tone {
+	return f.tone
+}
+
+// SetTone changes the tone mapping that converts the frame's colors for display.
+// It affects At and the 8-bit image formats; the frame's linear colors are unchanged,
+// so a frame can be tone mapped again without re-rendering it.
+func (f *Frame) SetTone(t Tone) {
+	f.tone = t
+}
+
+// Seed returns the seed from which the random streams of the frame's samples are derived.
+func (f *Frame) Seed() int64 {
+	return f.seed
+}
+
+// Color returns the average linear color at x, y.
+func (f *Frame) Color(x, y int) Color {
+	return f.Pixel(x, y).Color()
+}
+
+// Samples returns the total number of samples accumulated in the frame.
+func (f *Frame) Samples() (n int) {
+	for _, p := range f.pix {
+		n += p.Samples
+	}
+	return
+}
+
+// needs returns the number of pixels that will receive more samples from a pass with options opts.
+func (f *Frame) needs(opts RenderOptions) (n int) {
+	for _, p := range f.pix {
+		if opts.samples(p) > 0 {
+			n++
+		}
+	}
+	return
+}
+
+func (f *Frame) offset(x, y int) int {
+	return (y-f.rect.Min.Y)*f.rect.Dx() + (x - f.rect.Min.X)
+}
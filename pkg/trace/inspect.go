@@ -0,0 +1,481 @@
+package trace
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	refl "reflect"
+	"strings"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+// Report describes the contents of a scene, as found by Inspect.
+type Report struct {
+	// Surfaces counts the surfaces of each type, like "Sphere" or "BVH",
+	// including those within lists, hierarchies, and transforms.
+	// A surface that appears in more than one place is counted each time.
+	Surfaces map[string]int
+	// Materials lists the materials of the scene's primitives, in the order they were found.
+	Materials []MaterialUse
+	// Bounds encloses the whole scene.
+	Bounds *AABB
+	// BVHs describes each bounding volume hierarchy, outermost first.
+	BVHs []BVHReport
+	// Memory estimates the bytes used by the scene's surfaces, materials, and textures.
+	Memory int
+	// Emitters lists the primitives with materials that emit light.
+	Emitters []Emitter
+	// Power is the total power of the Emitters.
+	Power Color
+	// Warnings describe likely mistakes, like surfaces with zero area.
+	Warnings []string
+}
+
+// MaterialUse is a material and the number of primitive surfaces that use it.
+type MaterialUse struct {
+	Material Material
+	Surfaces int
+}
+
+// BVHReport describes the shape of a bounding volume hierarchy.
+type BVHReport struct {
+	// Surfaces is the number of surfaces in the hierarchy's leaves.
+	Surfaces int
+	// Nodes is the number of nodes, including leaves, and Depth is the length of the longest path to a leaf.
+	Nodes, Depth int
+	// Leaves counts the leaves that hold each number of surfaces.
+	Leaves map[int]int
+	// Cost is the surface area heuristic (SAH) cost of tracing a ray that enters the hierarchy,
+	// in the units that NewBVH uses to choose its splits:
+	// 1 for each node traversed, and 2 for each surface tested.
+	Cost float64
+}
+
+// Emitter is a primitive surface with a material that emits light.
+type Emitter struct {
+	Surface  Surface
+	Material Material
+	// Area is the surface area, or zero if it isn't known for this type of surface.
+	Area float64
+	// Power is the light leaving one side of the surface: its area, times its mean emission, times pi.
+	Power Color
+}
+
+// Inspect reports the contents of surface s from time t0 to t1,
+// and warns about likely mistakes.
+func Inspect(s Surface, t0, t1 float64) *Report {
+	in := inspector{
+		r:      &Report{Surfaces: make(map[string]int), Bounds: s.Bounds(t0, t1)},
+		t0:     t0,
+		t1:     t1,
+		seen:   make(map[interface{}]bool),
+		mats:   make(map[Material]int),
+		bvhs:   make(map[*BVH]bool),
+		warned: make(map[string]bool),
+		rnd:    rand.New(rand.NewSource(1)),
+	}
+	in.surface(s, func(p geom.Vec) geom.Vec { return p })
+	return in.r
+}
+
+// inspector gathers a Report as it walks a scene.
+type inspector struct {
+	r      *Report
+	t0, t1 float64
+	seen   map[interface{}]bool // objects whose memory has been counted
+	mats   map[Material]int     // the index of each material in r.Materials
+	bvhs   map[*BVH]bool        // hierarchies that have been measured
+	warned map[string]bool
+	rnd    *rand.Rand
+}
+
+// surface inspects s, whose points are placed in the scene by place.
+func (in *inspector) surface(s Surface, place func(geom.Vec) geom.Vec) {
+	in.r.Surfaces[TypeName(s)]++
+	in.memory(s, 0)
+	switch v := s.(type) {
+	case *List:
+		in.memory(v.ss, cap(v.ss)*int(refl.TypeOf(v.ss).Elem().Size()))
+		for _, c := range v.ss {
+			in.surface(c, place)
+		}
+	case *Box:
+		in.surface(v.List, place)
+	case *BVH:
+		if !in.bvhs[v] {
+			in.bvhs[v] = true
+			in.r.BVHs = append(in.r.BVHs, in.bvh(v))
+		}
+		for _, c := range v.Surfaces() {
+			in.surface(c, place)
+		}
+	case *Translate:
+		in.surface(v.child, func(p geom.Vec) geom.Vec { return place(p.Plus(v.offset)) })
+	case *RotateY:
+		in.surface(v.child, func(p geom.Vec) geom.Vec { return place(v.right(p)) })
+	case *Animated:
+		sin, cos := math.Sincos(v.angle.At(in.t0).X() * math.Pi / 180)
+		offset := v.offset.At(in.t0)
+		in.surface(v.child, func(p geom.Vec) geom.Vec { return place(rotateY(p, sin, cos).Plus(offset)) })
+	case *Flip:
+		in.surface(v.Surface, place)
+	case *Counter:
+		in.surface(v.Surface, place)
+	case *tested:
+		in.surface(v.Surface, place)
+	case *Volume:
+		if v.density <= 0 {
+			in.warn("a Volume has a density of %g, so it's invisible", v.density)
+		}
+		if !closed(v.boundary) {
+			in.warn("a Volume's boundary, a %s, isn't closed, so rays can enter it without leaving", TypeName(v.boundary))
+		}
+		in.material(v, v.phase, in.points(v.boundary, place), 0)
+		if _, ok := v.phase.(*Isotropic); !ok {
+			in.warn("a Volume scatters light with a %s, rather than an Isotropic material", TypeName(v.phase))
+		}
+	case *Sphere:
+		if v.rad <= 0 {
+			in.warn("a Sphere at %v has a radius of %g", v.center0, v.rad)
+		}
+		in.material(v, v.mat, in.points(v, place), 4*math.Pi*v.rad*v.rad)
+	case *Rect:
+		a1, a2 := (v.axis+1)%3, (v.axis+2)%3
+		area := (v.max[a1] - v.min[a1]) * (v.max[a2] - v.min[a2])
+		if area <= 0 {
+			in.warn("a Rect from %v to %v has zero area", v.min, v.max)
+		}
+		in.material(v, v.mat, in.points(v, place), area)
+	case *Quad:
+		if v.area == 0 {
+			in.warn("a Quad at %v has zero area", v.corner)
+		}
+		in.material(v, v.mat, in.points(v, place), v.area)
+	case *Disk:
+		if v.rad <= 0 {
+			in.warn("a Disk at %v has a radius of %g", v.center, v.rad)
+		}
+		in.material(v, v.mat, in.points(v, place), math.Pi*v.rad*v.rad)
+	case *Plane:
+		// a plane's area is infinite, so its power can't be estimated.
+		in.material(v, v.mat, in.points(v, place), 0)
+	case *Triangle:
+		if v.area == 0 {
+			in.warn("a Triangle at %v has zero area", v.mesh.Verts[v.v[0]])
+		}
+		in.memory(v.mesh, 0)
+		in.memory(v.mesh.Verts, cap(v.mesh.Verts)*int(refl.TypeOf(geom.Vec{}).Size()))
+		in.material(v, v.mat, in.points(v, place), v.area)
+	case *TriangleMesh:
+		in.r.Surfaces["Triangle"] += len(v.tris)
+		if v.degenerate > 0 {
+			in.warn("a TriangleMesh has %d triangles with zero area", v.degenerate)
+		}
+		if !in.bvhs[v.bvh] {
+			in.bvhs[v.bvh] = true
+			in.r.BVHs = append(in.r.BVHs, in.bvh(v.bvh))
+		}
+		m := v.mesh
+		in.memory(m, 0)
+		in.memory(m.Verts, cap(m.Verts)*int(refl.TypeOf(geom.Vec{}).Size()))
+		in.memory(m.Norms, cap(m.Norms)*int(refl.TypeOf(geom.Unit{}).Size()))
+		in.memory(m.UVs, cap(m.UVs)*int(refl.TypeOf(geom.Vec{}).Size()))
+		in.memory(m.Faces, cap(m.Faces)*int(refl.TypeOf([3]int{}).Size()))
+		in.memory(v.tris, cap(v.tris)*(8+int(refl.TypeOf(Triangle{}).Size())))
+		in.material(v, v.mat, in.points(v, place), v.area)
+	}
+}
+
+// material records that primitive s uses material m, and checks that m behaves as expected at points ps.
+// area is the area of s, or zero if it's unknown.
+func (in *inspector) material(s Surface, m Material, ps []surfacePoint, area float64) {
+	if m == nil {
+		in.warn("a %s has no material", TypeName(s))
+		return
+	}
+	i, ok := in.mats[m]
+	if !ok {
+		i = len(in.r.Materials)
+		in.mats[m] = i
+		in.r.Materials = append(in.r.Materials, MaterialUse{Material: m})
+		in.memory(m, 0)
+		if t := texture(m); t != nil {
+			in.texture(t)
+		}
+	}
+	in.r.Materials[i].Surfaces++
+	name := fmt.Sprintf("%s #%d", TypeName(m), i+1)
+
+	var emit Color
+	var weight float64
+	for _, p := range ps {
+		emit = emit.Plus(m.Emit(p.uv, p.p).Scaled(p.weight))
+		weight += p.weight
+		_, att, scatters := m.Scatter(geom.Unit{0, -1, 0}, p.norm, p.uv, p.p, in.rnd)
+		if scatters && luminance(m.Emit(p.uv, p.p)) > 0 {
+			in.warn("%s both emits and scatters light", name)
+		}
+		if scatters && (att.R() > 1 || att.G() > 1 || att.B() > 1) {
+			in.warn("%s scatters more light than it receives", name)
+		}
+		if _, ok := s.(*Volume); !ok && scatters {
+			if _, ok := m.(*Isotropic); ok {
+				in.warn("%s is on a %s; Isotropic materials are meant for Volumes", name, TypeName(s))
+			}
+		}
+		if _, ok := m.(*Light); ok && scatters {
+			in.warn("%s is a Light that scatters light", name)
+		}
+	}
+	if weight > 0 {
+		emit = emit.Scaled(1 / weight)
+	}
+	if _, ok := m.(*Light); ok && len(ps) > 0 && luminance(emit) <= 0 {
+		in.warn("%s is a Light that emits no light", name)
+	}
+	if luminance(emit) > 0 {
+		e := Emitter{Surface: s, Material: m, Area: area, Power: emit.Scaled(math.Pi * area)}
+		in.r.Emitters = append(in.r.Emitters, e)
+		in.r.Power = in.r.Power.Plus(e.Power)
+		if area == 0 {
+			in.warn("the power of an emitting %s can't be estimated", TypeName(s))
+		}
+	}
+}
+
+// bvh measures the hierarchy rooted at b.
+func (in *inspector) bvh(b *BVH) BVHReport {
+	r := BVHReport{Leaves: make(map[int]int)}
+	var measure func(b *BVH, depth int) (cost float64)
+	measure = func(b *BVH, depth int) float64 {
+		r.Nodes++
+		in.memory(b, 0)
+		in.memory(b.bounds, 0)
+		if depth > r.Depth {
+			r.Depth = depth
+		}
+		if len(b.leaves) > 0 || b.left == nil {
+			r.Surfaces += len(b.leaves)
+			r.Leaves[len(b.leaves)]++
+			in.memory(b.leaves, cap(b.leaves)*int(refl.TypeOf(leaf{}).Size()))
+			for _, l := range b.leaves {
+				in.memory(l.bounds, 0)
+			}
+			return costIntersect * float64(len(b.leaves))
+		}
+		cost := float64(costTraverse)
+		sa := b.bounds.SurfaceArea()
+		for _, c := range []*BVH{b.left, b.right} {
+			cc := measure(c, depth+1)
+			if sa > 0 {
+				cost += c.bounds.SurfaceArea() / sa * cc
+			}
+		}
+		return cost
+	}
+	r.Cost = measure(b, 0)
+	return r
+}
+
+// texture counts the memory used by t and any textures it contains.
+func (in *inspector) texture(t Mapper) {
+	if in.seen[t] {
+		return
+	}
+	in.memory(t, 0)
+	switch v := t.(type) {
+	case *Checker:
+		in.texture(v.odd)
+		in.texture(v.even)
+	case *Bright:
+		in.texture(v.src)
+	case *Image:
+		in.memory(v.data, pixelBytes(v.data))
+	case *Noise:
+		p := v.perlin
+		size := len(p.rndUnit)*int(refl.TypeOf(geom.Unit{}).Size()) + (len(p.permX)+len(p.permY)+len(p.permZ))*8
+		in.memory(p, size+int(refl.TypeOf(*p).Size()))
+	}
+}
+
+// memory adds the size of object v to the report's estimate, unless it's already been counted.
+// If size is zero, it's the size of the value that v points to.
+func (in *inspector) memory(v interface{}, size int) {
+	if v == nil {
+		return
+	}
+	key := v
+	if !refl.TypeOf(v).Comparable() {
+		// slices are identified by their first element.
+		rv := refl.ValueOf(v)
+		if rv.Kind() != refl.Slice || rv.Len() == 0 {
+			return
+		}
+		key = rv.Index(0).Addr().Interface()
+	}
+	if in.seen[key] {
+		return
+	}
+	in.seen[key] = true
+	if size == 0 {
+		if t := refl.TypeOf(v); t.Kind() == refl.Ptr {
+			size = int(t.Elem().Size())
+		}
+	}
+	in.r.Memory += size
+}
+
+// warn adds a warning to the report, unless it's already there.
+func (in *inspector) warn(format string, args ...interface{}) {
+	w := fmt.Sprintf(format, args...)
+	if !in.warned[w] {
+		in.warned[w] = true
+		in.r.Warnings = append(in.r.Warnings, w)
+	}
+}
+
+// surfacePoint is a point on a surface, with a weight proportional to the area it represents.
+type surfacePoint struct {
+	uv, p  geom.Vec
+	norm   geom.Unit
+	weight float64
+}
+
+// points samples an 8x8 grid of uv coordinates on s, placed in the scene by place.
+// It returns nil for types of surfaces that it can't sample.
+func (in *inspector) points(s Surface, place func(geom.Vec) geom.Vec) []surfacePoint {
+	const n = 8
+	var ps []surfacePoint
+	if m, ok := s.(*TriangleMesh); ok {
+		// sample the middles of up to n x n triangles, spread through the mesh.
+		step := (len(m.tris) + n*n - 1) / (n * n)
+		for i := 0; i < len(m.tris); i += step {
+			t := m.tris[i]
+			p, norm, uv := t.point([3]float64{1.0 / 3, 1.0 / 3, 1.0 / 3})
+			ps = append(ps, surfacePoint{uv: uv, p: place(p), norm: norm, weight: t.area})
+		}
+		return ps
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			u, v := (float64(i)+0.5)/n, (float64(j)+0.5)/n
+			switch s := s.(type) {
+			case *Sphere:
+				phi := (1-u)*2*math.Pi - math.Pi
+				theta := v*math.Pi - math.Pi/2
+				dir := geom.Vec{math.Cos(theta) * math.Cos(phi), math.Sin(theta), math.Cos(theta) * math.Sin(phi)}
+				p := s.Center(in.t0).Plus(dir.Scaled(s.rad))
+				ps = append(ps, surfacePoint{uv: geom.Vec{u, v, 0}, p: place(p), norm: dir.Unit(), weight: math.Cos(theta)})
+			case *Rect:
+				a1, a2 := (s.axis+1)%3, (s.axis+2)%3
+				p := s.min
+				p[a1] += u * (s.max[a1] - s.min[a1])
+				p[a2] += v * (s.max[a2] - s.min[a2])
+				norm := geom.Unit{}
+				norm[s.axis] = 1
+				ps = append(ps, surfacePoint{uv: geom.Vec{u, v, 0}, p: place(p), norm: norm, weight: 1})
+			case *Quad:
+				p := s.corner.Plus(s.u.Scaled(u)).Plus(s.v.Scaled(v))
+				ps = append(ps, surfacePoint{uv: geom.Vec{u, v, 0}, p: place(p), norm: s.norm, weight: 1})
+			case *Disk:
+				// spread the grid evenly over the disk's area, in rings.
+				r, theta := math.Sqrt(u), 2*math.Pi*v
+				a, b := r*math.Cos(theta), r*math.Sin(theta)
+				p := s.center.Plus(s.tu.Scaled(a * s.rad)).Plus(s.tv.Scaled(b * s.rad))
+				ps = append(ps, surfacePoint{uv: geom.Vec{(a + 1) / 2, (b + 1) / 2, 0}, p: place(p), norm: s.norm, weight: 1})
+			case *Plane:
+				// sample the unit square at the plane's point; the rest of it is more of the same.
+				p := s.point.Plus(s.tu.Scaled(u)).Plus(s.tv.Scaled(v))
+				ps = append(ps, surfacePoint{uv: geom.Vec{u, v, 0}, p: place(p), norm: s.norm, weight: 1})
+			case *Triangle:
+				if u+v > 1 {
+					u, v = 1-u, 1-v // fold the far half of the grid back onto the triangle
+				}
+				p, norm, uv := s.point([3]float64{1 - u - v, u, v})
+				ps = append(ps, surfacePoint{uv: uv, p: place(p), norm: norm, weight: 1})
+			default:
+				return nil
+			}
+		}
+	}
+	return ps
+}
+
+// closed reports whether s is known to enclose a volume.
+// Lists and hierarchies are closed if all of the surfaces within them are.
+func closed(s Surface) bool {
+	switch v := s.(type) {
+	case *Sphere, *Box:
+		return true
+	case *TriangleMesh:
+		return v.closed()
+	case *Translate:
+		return closed(v.child)
+	case *RotateY:
+		return closed(v.child)
+	case *Animated:
+		return closed(v.child)
+	case *Flip:
+		return closed(v.Surface)
+	case *Volume:
+		return closed(v.boundary)
+	case *List:
+		for _, c := range v.ss {
+			if !closed(c) {
+				return false
+			}
+		}
+		return len(v.ss) > 0
+	case *BVH:
+		for _, c := range v.Surfaces() {
+			if !closed(c) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// texture returns the texture of material m, or nil if it has none.
+func texture(m Material) Mapper {
+	switch v := m.(type) {
+	case *Lambert:
+		return v.texture
+	case *Metal:
+		return v.texture
+	case *Light:
+		return v.texture
+	case *Isotropic:
+		return v.texture
+	}
+	return nil
+}
+
+// pixelBytes estimates the memory used by the pixels of im.
+func pixelBytes(im image.Image) int {
+	switch v := im.(type) {
+	case *image.RGBA:
+		return len(v.Pix)
+	case *image.NRGBA:
+		return len(v.Pix)
+	case *image.RGBA64:
+		return len(v.Pix)
+	case *image.Gray:
+		return len(v.Pix)
+	case *image.YCbCr:
+		return len(v.Y) + len(v.Cb) + len(v.Cr)
+	case *image.Paletted:
+		return len(v.Pix) + 4*len(v.Palette)
+	}
+	b := im.Bounds()
+	return b.Dx() * b.Dy() * 4
+}
+
+// TypeName returns the name of the type of v, like "Sphere",
+// without the package name for types in this package.
+func TypeName(v interface{}) string {
+	return strings.TrimPrefix(strings.TrimPrefix(fmt.Sprintf("%T", v), "*"), "trace.")
+}
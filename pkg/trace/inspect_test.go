@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"image"
+	"math"
+	refl "reflect"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+func TestInspect(t *testing.T) {
+	white := NewLambert(NewUniform(0.5, 0.5, 0.5))
+	lamp := NewLight(NewUniform(4, 2, 1))
+	fog := NewVolume(NewRect(geom.Vec{-1, -1, 2}, geom.Vec{1, 1, 2}, nil), 0.5, NewIsotropic(NewUniform(1, 1, 1)))
+	s := NewBVH(0, 1,
+		NewSphere(geom.Vec{0, 0, 0}, 1, white),
+		NewTranslate(NewSphere(geom.Vec{0, 0, 0}, 1, white), geom.Vec{3, 0, 0}),
+		NewRect(geom.Vec{-1, 4, -1.5}, geom.Vec{1, 4, 1.5}, lamp),
+		NewDisk(geom.Vec{0, -2, 0}, geom.Vec{0, 1, 0}.Unit(), 0, white),
+		fog,
+	)
+	r := Inspect(s, 0, 1)
+
+	surfaces := map[string]int{"BVH": 1, "Sphere": 2, "Translate": 1, "Rect": 1, "Disk": 1, "Volume": 1}
+	if !refl.DeepEqual(r.Surfaces, surfaces) {
+		t.Errorf("surfaces %v, want %v", r.Surfaces, surfaces)
+	}
+	uses := make(map[string]int)
+	for _, m := range r.Materials {
+		uses[TypeName(m.Material)] += m.Surfaces
+	}
+	if want := map[string]int{"Lambert": 3, "Light": 1, "Isotropic": 1}; len(r.Materials) != 3 || !refl.DeepEqual(uses, want) {
+		t.Errorf("%d materials used by %v, want 3 used by %v", len(r.Materials), uses, want)
+	}
+	if len(r.BVHs) != 1 || r.BVHs[0].Surfaces != 5 || r.BVHs[0].Nodes < 1 || r.BVHs[0].Cost <= 0 {
+		t.Errorf("bvhs %+v, want one of 5 surfaces", r.BVHs)
+	}
+	if b := s.Bounds(0, 1); r.Bounds.Min() != b.Min() || r.Bounds.Max() != b.Max() {
+		t.Errorf("bounds %v to %v, want %v to %v", r.Bounds.Min(), r.Bounds.Max(), b.Min(), b.Max())
+	}
+	if r.Memory <= 0 {
+		t.Errorf("memory %d", r.Memory)
+	}
+
+	// the lamp is 2 by 3 units.
+	power := Color{4, 2, 1}.Scaled(6 * math.Pi)
+	if len(r.Emitters) != 1 || r.Emitters[0].Material != lamp || r.Emitters[0].Area != 6 {
+		t.Fatalf("emitters %+v, want the lamp, with an area of 6", r.Emitters)
+	}
+	for i := range power {
+		if math.Abs(r.Emitters[0].Power[i]-power[i]) > 1e-9 || math.Abs(r.Power[i]-power[i]) > 1e-9 {
+			t.Fatalf("lamp power %v, total %v, want %v", r.Emitters[0].Power, r.Power, power)
+		}
+	}
+
+	warnings := []string{
+		"a Disk at [0 -2 0] has a radius of 0",
+		"a Volume's boundary, a Rect, isn't closed, so rays can enter it without leaving",
+	}
+	for _, w := range warnings {
+		found := false
+		for _, got := range r.Warnings {
+			found = found || got == w
+		}
+		if !found {
+			t.Errorf("no warning %q in %q", w, r.Warnings)
+		}
+	}
+	if len(r.Warnings) != len(warnings) {
+		t.Errorf("warnings %q, want %q", r.Warnings, warnings)
+	}
+}
+
+func TestInspectWarnings(t *testing.T) {
+	white := NewLambert(NewUniform(0.5, 0.5, 0.5))
+	tests := []struct {
+		name string
+		s    Surface
+		want string
+	}{
+		{"no material", NewSphere(geom.Vec{}, 1, nil), "a Sphere has no material"},
+		{"dark light", NewSphere(geom.Vec{}, 1, NewLight(NewUniform(0, 0, 0))), "Light #1 is a Light that emits no light"},
+		{"bright lambert", NewSphere(geom.Vec{}, 1, NewLambert(NewUniform(2, 0.5, 0.5))), "Lambert #1 scatters more light than it receives"},
+		{"isotropic surface", NewSphere(geom.Vec{}, 1, NewIsotropic(NewUniform(1, 1, 1))), "Isotropic #1 is on a Sphere; Isotropic materials are meant for Volumes"},
+		{"empty volume", NewVolume(NewSphere(geom.Vec{}, 1, nil), 0, NewIsotropic(NewUniform(1, 1, 1))), "a Volume has a density of 0, so it's invisible"},
+		{"lambert volume", NewVolume(NewSphere(geom.Vec{}, 1, nil), 1, white), "a Volume scatters light with a Lambert, rather than an Isotropic material"},
+		{"flat rect", NewRect(geom.Vec{0, 0, 0}, geom.Vec{0, 0, 1}, white), "a Rect from [0 0 0] to [0 0 1] has zero area"},
+		{"lit plane", NewPlane(geom.Vec{}, geom.Vec{0, 1, 0}.Unit(), NewLight(NewUniform(1, 1, 1))), "the power of an emitting Plane can't be estimated"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := Inspect(test.s, 0, 1)
+			for _, w := range r.Warnings {
+				if w == test.want {
+					return
+				}
+			}
+			t.Errorf("warnings %q, want %q", r.Warnings, test.want)
+		})
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{NewSphere(geom.Vec{}, 1, nil), "Sphere"},
+		{NewUniform(1, 1, 1), "Uniform"},
+		{Color{}, "Color"},
+		{image.NewRGBA(image.Rect(0, 0, 1, 1)), "image.RGBA"},
+		{3, "int"},
+	}
+	for _, test := range tests {
+		if got := TypeName(test.v); got != test.want {
+			t.Errorf("TypeName(%T) = %q, want %q", test.v, got, test.want)
+		}
+	}
+}
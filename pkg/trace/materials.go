@@ -76,6 +76,11 @@ func (i *Isotropic) Scatter(in, norm geom.Unit, uv, p geom.Vec, rnd *rand.Rand)
 	return geom.RandUnit(rnd), i.texture.Map(uv, p), true
 }
 
+// Albedo returns the color of the texture at coordinate uv and point p.
+func (i *Isotropic) Albedo(uv, p geom.Vec) Color {
+	return i.texture.Map(uv, p)
+}
+
 // Lambert describes a flat, diffuse material.
 // Rubber and chalk are simple lambertian materials.
 type Lambert struct {
@@ -96,6 +101,11 @@ func (l *Lambert) Scatter(in, n geom.Unit, uv, p geom.Vec, rnd *rand.Rand) (out
 	return out, attenuate, true
 }
 
+// Albedo returns the color of the texture at coordinate uv and point p.
+func (l *Lambert) Albedo(uv, p geom.Vec) Color {
+	return l.texture.Map(uv, p)
+}
+
 // Light is a material that emits light.
 type Light struct {
 	texture Mapper
@@ -116,6 +126,11 @@ func (l *Light) Emit(uv, p geom.Vec) Color {
 	return l.texture.Map(uv, p)
 }
 
+// Albedo returns the color emitted at coordinate uv and point p.
+func (l *Light) Albedo(uv, p geom.Vec) Color {
+	return l.texture.Map(uv, p)
+}
+
 // Metal describes a reflective material.
 type Metal struct {
 	texture Mapper
@@ -136,6 +151,11 @@ func (m *Metal) Scatter(in, norm geom.Unit, uv, p geom.Vec, rnd *rand.Rand) (out
 	return out, m.texture.Map(uv, p), out.Dot(norm) > 0
 }
 
+// Albedo returns the color of the texture at coordinate uv and point p.
+func (m *Metal) Albedo(uv, p geom.Vec) Color {
+	return m.texture.Map(uv, p)
+}
+
 // Reflect reflects this unit vector about a normal vector n.
 func reflect(u, n geom.Unit) geom.Unit {
 	return geom.Unit(geom.Vec(u).Minus(geom.Vec(n).Scaled(2 * u.Dot(n)))) // TODO: prove this is still a unit vector
@@ -0,0 +1,300 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+// Mesh is the geometry of a triangle mesh:
+// buffers of vertex data, shared by faces that index into them.
+type Mesh struct {
+	// Verts are the positions of the vertices.
+	Verts []geom.Vec
+	// Norms, if not empty, are the normals at each vertex, which are interpolated for smooth shading.
+	Norms []geom.Unit
+	// UVs, if not empty, are the texture coordinates of each vertex.
+	UVs []geom.Vec
+	// Faces are the triangles, each the indices of three vertices.
+	// The front of a face is the side from which its vertices run counter-clockwise.
+	Faces [][3]int
+	// NormalMap, if not nil, bends the normals of the faces by a tangent-space normal map,
+	// which needs the mesh to have UVs.
+	// Red, green, and blue from 0 to 1 are directions from -1 to 1 along u, along v, and out of the face.
+	NormalMap Mapper
+}
+
+// WithColors returns a copy of m whose uvs are the colors of its vertices, cs,
+// for a mesh textured with VertexColors.
+// It returns an error if there isn't a color for each vertex.
+func (m Mesh) WithColors(cs []Color) (Mesh, error) {
+	if len(cs) != len(m.Verts) {
+		return m, fmt.Errorf("mesh has %d colors for %d vertices", len(cs), len(m.Verts))
+	}
+	m.UVs = make([]geom.Vec, len(cs))
+	for i, c := range cs {
+		m.UVs[i] = geom.Vec(c)
+	}
+	return m, nil
+}
+
+// VertexColors is a texture of the colors of a mesh's vertices, blended across its faces.
+// It maps each uv coordinate to the color with the same components,
+// so it's for meshes whose uvs are their colors, as made by Mesh.WithColors.
+type VertexColors struct{}
+
+// NewVertexColors returns a new texture of vertex colors.
+func NewVertexColors() *VertexColors {
+	return &VertexColors{}
+}
+
+// Map returns the color that uv holds.
+func (v *VertexColors) Map(uv, _ geom.Vec) Color {
+	return Color(uv)
+}
+
+// Triangle is a triangular surface, either on its own or as a face of a TriangleMesh.
+type Triangle struct {
+	mesh   *Mesh
+	v      [3]int
+	norm   geom.Unit
+	area   float64
+	bounds *AABB
+	mat    Material
+}
+
+// NewTriangle creates a new triangle with corners a, b, and c, and material m.
+// Its front is the side from which a, b, and c run counter-clockwise.
+func NewTriangle(a, b, c geom.Vec, m Material) *Triangle {
+	return newTriangle(&Mesh{Verts: []geom.Vec{a, b, c}}, [3]int{0, 1, 2}, m)
+}
+
+func newTriangle(mesh *Mesh, v [3]int, m Material) *Triangle {
+	a, b, c := mesh.Verts[v[0]], mesh.Verts[v[1]], mesh.Verts[v[2]]
+	cross := b.Minus(a).Cross(c.Minus(a))
+	t := Triangle{mesh: mesh, v: v, area: cross.Len() / 2, mat: m}
+	if t.area > 0 {
+		t.norm = cross.Unit()
+	}
+	t.bounds = padded(a.Min(b).Min(c), a.Max(b).Max(c))
+	return &t
+}
+
+// Hit returns details of the intersection between r and this surface.
+// If r does not intersect with this surface, it returns nil.
+func (t *Triangle) Hit(r Ray, dMin, dMax float64, _ *rand.Rand) *Hit {
+	d, bary, ok := t.intersect(r, dMin, dMax)
+	if !ok {
+		return nil
+	}
+	_, norm, uv := t.point(bary)
+	return &Hit{
+		Dist:    d,
+		Norm:    norm,
+		UV:      uv,
+		Pt:      r.At(d),
+		Mat:     t.mat,
+		Surface: t,
+	}
+}
+
+// intersect finds where r crosses the triangle between distances dMin and dMax,
+// returning the distance and the barycentric coordinates of the crossing.
+// It's the watertight test of Woop, Benthin, and Wald (2013):
+// the triangle is transformed into a space where the ray runs along z from the origin,
+// so a ray that crosses an edge shared by two triangles hits exactly one of them, and never slips between.
+func (t *Triangle) intersect(r Ray, dMin, dMax float64) (d float64, bary [3]float64, ok bool) {
+	kz := 0
+	for i := 1; i < 3; i++ {
+		if math.Abs(r.Dir[i]) > math.Abs(r.Dir[kz]) {
+			kz = i
+		}
+	}
+	kx, ky := (kz+1)%3, (kz+2)%3
+	if r.Dir[kz] < 0 {
+		kx, ky = ky, kx // keep the winding of the triangle
+	}
+	sx, sy, sz := r.Dir[kx]/r.Dir[kz], r.Dir[ky]/r.Dir[kz], 1/r.Dir[kz]
+
+	a := t.mesh.Verts[t.v[0]].Minus(r.Or)
+	b := t.mesh.Verts[t.v[1]].Minus(r.Or)
+	c := t.mesh.Verts[t.v[2]].Minus(r.Or)
+	ax, ay := a[kx]-sx*a[kz], a[ky]-sy*a[kz]
+	bx, by := b[kx]-sx*b[kz], b[ky]-sy*b[kz]
+	cx, cy := c[kx]-sx*c[kz], c[ky]-sy*c[kz]
+
+	// the edge functions are each twice the area of the triangle between an edge and the ray,
+	// which are all the same sign if the ray passes inside the triangle.
+	u := cx*by - cy*bx
+	v := ax*cy - ay*cx
+	w := bx*ay - by*ax
+	if (u < 0 || v < 0 || w < 0) && (u > 0 || v > 0 || w > 0) {
+		return 0, bary, false
+	}
+	det := u + v + w
+	if det == 0 {
+		return 0, bary, false
+	}
+	d = (u*a[kz] + v*b[kz] + w*c[kz]) * sz / det
+	if d <= dMin || d >= dMax {
+		return 0, bary, false
+	}
+	return d, [3]float64{u / det, v / det, w / det}, true
+}
+
+// point returns the position, normal, and uv coordinate of the point on the triangle with barycentric coordinates bary.
+// The normal is interpolated from the vertex normals if the mesh has them,
+// and the uv coordinate is interpolated from the vertex uvs, or is bary's last two coordinates if it has none.
+func (t *Triangle) point(bary [3]float64) (p geom.Vec, norm geom.Unit, uv geom.Vec) {
+	norm, uv = t.norm, geom.Vec{bary[1], bary[2], 0}
+	var n geom.Vec
+	for i, j := range t.v {
+		p = p.Plus(t.mesh.Verts[j].Scaled(bary[i]))
+		if len(t.mesh.Norms) > 0 {
+			n = n.Plus(t.mesh.Norms[j].Scaled(bary[i]))
+		}
+	}
+	if n.LenSq() > 0 {
+		norm = n.Unit()
+	}
+	if len(t.mesh.UVs) > 0 {
+		uv = geom.Vec{}
+		for i, j := range t.v {
+			uv = uv.Plus(t.mesh.UVs[j].Scaled(bary[i]))
+		}
+		if t.mesh.NormalMap != nil {
+			norm = t.mapNormal(norm, uv, p)
+		}
+	}
+	return p, norm, uv
+}
+
+// mapNormal bends normal n, at uv coordinate uv and point p, by the mesh's normal map.
+// The map's directions along u and v are the directions in which the uvs increase across the triangle.
+func (t *Triangle) mapNormal(n geom.Unit, uv, p geom.Vec) geom.Unit {
+	a, b, c := t.mesh.Verts[t.v[0]], t.mesh.Verts[t.v[1]], t.mesh.Verts[t.v[2]]
+	ta, tb, tc := t.mesh.UVs[t.v[0]], t.mesh.UVs[t.v[1]], t.mesh.UVs[t.v[2]]
+	dp1, dp2 := b.Minus(a), c.Minus(a)
+	du1, dv1 := tb.X()-ta.X(), tb.Y()-ta.Y()
+	du2, dv2 := tc.X()-ta.X(), tc.Y()-ta.Y()
+	det := du1*dv2 - du2*dv1
+	if det == 0 {
+		return n
+	}
+	dpdu := dp1.Scaled(dv2).Minus(dp2.Scaled(dv1)).Scaled(1 / det)
+	dpdv := dp2.Scaled(du1).Minus(dp1.Scaled(du2)).Scaled(1 / det)
+
+	// make the tangent perpendicular to the normal, and find the bitangent on the same side as dpdv.
+	tangent := dpdu.Minus(n.Scaled(geom.Vec(n).Dot(dpdu)))
+	if tangent.LenSq() == 0 {
+		return n
+	}
+	tan := tangent.Unit()
+	bitan := geom.Vec(n).Cross(geom.Vec(tan))
+	if bitan.Dot(dpdv) < 0 {
+		bitan = bitan.Inv()
+	}
+	m := t.mesh.NormalMap.Map(uv, p)
+	dir := tan.Scaled(2*m.R() - 1).Plus(bitan.Scaled(2*m.G() - 1)).Plus(n.Scaled(2*m.B() - 1))
+	if dir.LenSq() == 0 {
+		return n
+	}
+	return dir.Unit()
+}
+
+// Bounds returns an axis-aligned bounding box that encloses
+// this triangle from time t0 to t1.
+func (t *Triangle) Bounds(t0, t1 float64) *AABB {
+	return t.bounds
+}
+
+// TriangleMesh is a surface made of triangles that share vertices.
+// It organizes its triangles into its own BVH.
+type TriangleMesh struct {
+	mesh       *Mesh
+	tris       []*Triangle
+	degenerate int // faces with zero area, which are left out of the BVH
+	area       float64
+	bvh        *BVH
+	mat        Material
+}
+
+// NewTriangleMesh creates a new mesh of the triangles in m, with material mat.
+// The mesh keeps m's buffers, which shouldn't be changed afterwards.
+// It returns an error if m's vertex buffers are of different lengths or its faces refer to missing vertices.
+func NewTriangleMesh(m Mesh, mat Material) (*TriangleMesh, error) {
+	if len(m.Norms) > 0 && len(m.Norms) != len(m.Verts) {
+		return nil, fmt.Errorf("mesh has %d normals for %d vertices", len(m.Norms), len(m.Verts))
+	}
+	if len(m.UVs) > 0 && len(m.UVs) != len(m.Verts) {
+		return nil, fmt.Errorf("mesh has %d uvs for %d vertices", len(m.UVs), len(m.Verts))
+	}
+	tm := TriangleMesh{mesh: &m, mat: mat}
+	ss := make([]Surface, 0, len(m.Faces))
+	for i, f := range m.Faces {
+		for _, v := range f {
+			if v < 0 || v >= len(m.Verts) {
+				return nil, fmt.Errorf("mesh face %d refers to vertex %d, but there are %d vertices", i, v, len(m.Verts))
+			}
+		}
+		t := newTriangle(tm.mesh, f, mat)
+		if t.area == 0 {
+			tm.degenerate++
+			continue
+		}
+		tm.tris = append(tm.tris, t)
+		tm.area += t.area
+		ss = append(ss, t)
+	}
+	if len(ss) == 0 {
+		return nil, errors.New("mesh has no triangles with any area")
+	}
+	tm.bvh = NewBVH(0, 1, ss...)
+	return &tm, nil
+}
+
+// Hit returns details of the intersection between r and this surface.
+// If r does not intersect with this surface, it returns nil.
+// The Hit's Surface is the mesh, rather than the triangle within it.
+func (m *TriangleMesh) Hit(r Ray, dMin, dMax float64, rnd *rand.Rand) *Hit {
+	hit := m.bvh.Hit(r, dMin, dMax, rnd)
+	if hit != nil {
+		hit.Surface = m
+	}
+	return hit
+}
+
+// Bounds returns an axis-aligned bounding box that encloses
+// this mesh from time t0 to t1.
+func (m *TriangleMesh) Bounds(t0, t1 float64) *AABB {
+	return m.bvh.Bounds(t0, t1)
+}
+
+// Triangles returns the mesh's triangles, leaving out any with zero area.
+func (m *TriangleMesh) Triangles() []*Triangle {
+	return m.tris
+}
+
+// closed reports whether the mesh encloses a volume: whether every edge is shared by exactly two faces.
+// Edges are compared by the positions of their ends, so vertices split at uv or normal seams still join.
+func (m *TriangleMesh) closed() bool {
+	edges := make(map[[2]geom.Vec]int)
+	for _, f := range m.mesh.Faces {
+		for i := range f {
+			a, b := m.mesh.Verts[f[i]], m.mesh.Verts[f[(i+1)%3]]
+			if b[0] < a[0] || (b[0] == a[0] && (b[1] < a[1] || (b[1] == a[1] && b[2] < a[2]))) {
+				a, b = b, a
+			}
+			edges[[2]geom.Vec{a, b}]++
+		}
+	}
+	for _, n := range edges {
+		if n != 2 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package trace
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+// fan returns a hexagon of six triangles around the origin, in the plane z = 0, facing +z.
+// Every triangle shares the center vertex, and each shares an edge with its two neighbors.
+func fan(t *testing.T) *TriangleMesh {
+	m := Mesh{Verts: []geom.Vec{{0, 0, 0}}}
+	for k := 0; k < 6; k++ {
+		a := float64(k) * math.Pi / 3
+		m.Verts = append(m.Verts, geom.Vec{math.Cos(a), math.Sin(a), 0})
+		m.Faces = append(m.Faces, [3]int{0, k + 1, (k+1)%6 + 1})
+	}
+	tm, err := NewTriangleMesh(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+// triangleHits returns the number of triangles of m that r hits.
+func triangleHits(m *TriangleMesh, r Ray) (n int) {
+	for _, tri := range m.Triangles() {
+		if tri.Hit(r, 0, math.MaxFloat64, nil) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTriangleMeshWatertight(t *testing.T) {
+	m := fan(t)
+	edge := m.mesh.Verts[2] // the end of the edge between the first two faces
+	tests := []struct {
+		name     string
+		target   geom.Vec
+		min, max int // how many triangles may be hit
+	}{
+		// a ray exactly through a shared edge or vertex may hit every triangle that shares it,
+		// all at the same distance, but mustn't slip between them.
+		{"shared vertex", geom.Vec{0, 0, 0}, 1, 6},
+		{"shared edge", edge.Scaled(0.5), 1, 2},
+		{"shared edge near vertex", edge.Scaled(1e-9), 1, 2},
+		// just off an edge or vertex, exactly one triangle is hit.
+		{"beside edge", edge.Scaled(0.5).Plus(geom.Vec{1e-9, 0, 0}), 1, 1},
+		{"other side of edge", edge.Scaled(0.5).Minus(geom.Vec{1e-9, 0, 0}), 1, 1},
+		{"beside vertex", geom.Vec{1e-12, 3e-12, 0}, 1, 1},
+		{"inside face", geom.Vec{0.5, 0.2, 0}, 1, 1},
+		{"outside", geom.Vec{1, 1, 0}, 0, 0},
+	}
+	dirs := []geom.Vec{{0, 0, -1}, {0.3, 0.2, -1}, {-0.7, 0.1, -0.4}, {0.05, -0.9, -0.2}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, dir := range dirs {
+				r := NewRay(test.target.Minus(dir.Scaled(2)), dir.Unit(), 0)
+				if n := triangleHits(m, r); n < test.min || n > test.max {
+					t.Errorf("ray along %v hit %d triangles, want %d to %d", dir, n, test.min, test.max)
+				}
+				hit := m.Hit(r, 0, math.MaxFloat64, nil)
+				if hit == nil && test.min > 0 {
+					t.Errorf("ray along %v missed the mesh", dir)
+				} else if hit != nil && test.min == 0 {
+					t.Errorf("ray along %v hit the mesh at %v, want a miss", dir, hit.Pt)
+				} else if hit != nil && math.Abs(hit.Dist-2*dir.Len()) > 1e-9 {
+					t.Errorf("ray along %v hit at distance %v, want %v", dir, hit.Dist, 2*dir.Len())
+				}
+			}
+		})
+	}
+
+	t.Run("edge sweep", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 10000; i++ {
+			// a point on one of the six shared edges, approached from any direction above.
+			end := m.mesh.Verts[1+rnd.Intn(6)]
+			target := end.Scaled(rnd.Float64())
+			dir := geom.Vec{rnd.Float64()*2 - 1, rnd.Float64()*2 - 1, -0.1 - rnd.Float64()}
+			r := NewRay(target.Minus(dir), dir.Unit(), 0)
+			if n := triangleHits(m, r); n < 1 || n > 6 {
+				t.Fatalf("ray through %v along %v hit %d triangles", target, dir, n)
+			}
+		}
+	})
+}
+
+func TestTriangleParallel(t *testing.T) {
+	tri := NewTriangle(geom.Vec{0, 0, 0}, geom.Vec{1, 0, 0}, geom.Vec{0, 1, 0}, nil)
+	tests := []struct {
+		name string
+		or   geom.Vec
+		dir  geom.Vec
+	}{
+		{"in plane, through", geom.Vec{-1, 0.25, 0}, geom.Vec{1, 0, 0}},
+		{"in plane, along edge", geom.Vec{-1, 0, 0}, geom.Vec{1, 0, 0}},
+		{"in plane, diagonal", geom.Vec{-1, -1, 0}, geom.Vec{1, 1, 0}},
+		{"above", geom.Vec{-1, 0.25, 0.5}, geom.Vec{1, 0, 0}},
+		{"below", geom.Vec{0.25, -1, -0.5}, geom.Vec{0, 1, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hit := tri.Hit(NewRay(test.or, test.dir.Unit(), 0), 0, math.MaxFloat64, nil); hit != nil {
+				t.Errorf("got a hit at %v, want none", hit.Pt)
+			}
+		})
+	}
+}
+
+func TestTriangleInterpolation(t *testing.T) {
+	smooth := Mesh{
+		Verts: []geom.Vec{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}},
+		Norms: []geom.Unit{geom.Vec{0, 0, 1}.Unit(), geom.Vec{1, 0, 1}.Unit(), geom.Vec{0, 1, 1}.Unit()},
+		UVs:   []geom.Vec{{0.1, 0.2, 0}, {0.9, 0.2, 0}, {0.1, 0.8, 0}},
+		Faces: [][3]int{{0, 1, 2}},
+	}
+	flat := smooth
+	flat.Norms, flat.UVs = nil, nil
+	n0, n1, n2 := geom.Vec(smooth.Norms[0]), geom.Vec(smooth.Norms[1]), geom.Vec(smooth.Norms[2])
+	tests := []struct {
+		name string
+		mesh Mesh
+		bary [3]float64
+		norm geom.Vec // the expected normal, before it's made a unit
+		uv   geom.Vec
+	}{
+		{"near first vertex", smooth, [3]float64{0.98, 0.01, 0.01}, n0.Scaled(0.98).Plus(n1.Scaled(0.01)).Plus(n2.Scaled(0.01)), geom.Vec{0.108, 0.206, 0}},
+		{"near second vertex", smooth, [3]float64{0.01, 0.98, 0.01}, n0.Scaled(0.01).Plus(n1.Scaled(0.98)).Plus(n2.Scaled(0.01)), geom.Vec{0.884, 0.206, 0}},
+		{"edge midpoint", smooth, [3]float64{0.5, 0, 0.5}, n0.Plus(n2), geom.Vec{0.1, 0.5, 0}},
+		{"inside", smooth, [3]float64{0.2, 0.3, 0.5}, n0.Scaled(0.2).Plus(n1.Scaled(0.3)).Plus(n2.Scaled(0.5)), geom.Vec{0.34, 0.5, 0}},
+		// without vertex normals and uvs, the face normal and the barycentric coordinates are used.
+		{"flat", flat, [3]float64{0.2, 0.3, 0.5}, geom.Vec{0, 0, 1}, geom.Vec{0.3, 0.5, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := NewTriangleMesh(test.mesh, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var p geom.Vec
+			for i, v := range test.mesh.Verts {
+				p = p.Plus(v.Scaled(test.bary[i]))
+			}
+			hit := m.Hit(NewRay(p.Plus(geom.Vec{0.1, 0.1, 1}), geom.Vec{-0.1, -0.1, -1}.Unit(), 0), 0, math.MaxFloat64, nil)
+			if hit == nil {
+				t.Fatalf("ray toward %v missed", p)
+			}
+			if !near(hit.Pt, p) {
+				t.Errorf("hit point %v, want %v", hit.Pt, p)
+			}
+			if !near(geom.Vec(hit.Norm), geom.Vec(test.norm.Unit())) {
+				t.Errorf("normal %v, want %v", hit.Norm, test.norm.Unit())
+			}
+			if !near(hit.UV, test.uv) {
+				t.Errorf("uv %v, want %v", hit.UV, test.uv)
+			}
+		})
+	}
+}
+
+func TestTriangleMeshDegenerate(t *testing.T) {
+	verts := []geom.Vec{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {2, 0, 0}}
+	tests := []struct {
+		name       string
+		faces      [][3]int
+		tris, skip int
+		err        bool
+	}{
+		{"none", [][3]int{{0, 1, 2}}, 1, 0, false},
+		{"repeated vertex", [][3]int{{0, 1, 2}, {0, 1, 1}}, 1, 1, false},
+		{"collinear", [][3]int{{0, 1, 3}, {0, 1, 2}}, 1, 1, false},
+		{"all", [][3]int{{0, 1, 3}, {2, 2, 2}}, 0, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := NewTriangleMesh(Mesh{Verts: verts, Faces: test.faces}, nil)
+			if test.err {
+				if err == nil {
+					t.Fatal("got no error for a mesh without any area")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Triangles()) != test.tris || m.degenerate != test.skip {
+				t.Errorf("got %d triangles and %d degenerate faces, want %d and %d", len(m.Triangles()), m.degenerate, test.tris, test.skip)
+			}
+		})
+	}
+}
+
+// near reports whether a and b are within a small distance of each other.
+func near(a, b geom.Vec) bool {
+	return a.Minus(b).Len() < 1e-9
+}
@@ -3,54 +3,62 @@ package trace
 import (
 	"math"
 	"math/rand"
-	"time"
 
 	"github.com/hunterloftis/oneweekend/pkg/geom"
 )
 
-var (
+// Perlin generates Perlin noise from a fixed set of random tables.
+// Perlin generators with the same seed produce identical noise.
+type Perlin struct {
 	rndUnit []geom.Unit
 	permX   []int
 	permY   []int
 	permZ   []int
-)
+}
 
-func init() {
-	rnd := rand.New(rand.NewSource(time.Now().Unix()))
-	rndUnit = generate(rnd)
-	permX = generatePerm(rnd)
-	permY = generatePerm(rnd)
-	permZ = generatePerm(rnd)
+// defaultPerlin is the generator used by textures that aren't given one explicitly.
+var defaultPerlin = NewPerlin(0)
+
+// NewPerlin creates a new Perlin noise generator with tables generated from seed.
+func NewPerlin(seed int64) *Perlin {
+	rnd := rand.New(rand.NewSource(seed))
+	return &Perlin{
+		rndUnit: generate(rnd),
+		permX:   generatePerm(rnd),
+		permY:   generatePerm(rnd),
+		permZ:   generatePerm(rnd),
+	}
 }
 
-// perlin maps 3d point p to a Perlin noise value between about -0.63 and 0.63
-func perlin(p geom.Vec) float64 {
+// Noise maps 3d point p to a Perlin noise value between about -0.63 and 0.63
+func (pe *Perlin) Noise(p geom.Vec) float64 {
 	u := p.X() - math.Floor(p.X())
 	v := p.Y() - math.Floor(p.Y())
 	w := p.Z() - math.Floor(p.Z())
 	i := int(math.Floor(p.X()))
 	j := int(math.Floor(p.Y()))
 	k := int(math.Floor(p.Z()))
-	c := make([]geom.Unit, 8)
+	var c [8]geom.Unit
 	for di := 0; di < 2; di++ {
 		for dj := 0; dj < 2; dj++ {
 			for dk := 0; dk < 2; dk++ {
-				x := permX[(i+di)&255]
-				y := permY[(j+dj)&255]
-				z := permZ[(k+dk)&255]
-				c[4*di+2*dj+dk] = rndUnit[x^y^z]
+				x := pe.permX[(i+di)&255]
+				y := pe.permY[(j+dj)&255]
+				z := pe.permZ[(k+dk)&255]
+				c[4*di+2*dj+dk] = pe.rndUnit[x^y^z]
 			}
 		}
 	}
-	return interp(c, u, v, w)
+	return interp(c[:], u, v, w)
 }
 
-func turb(p geom.Vec, depth int) float64 {
+// Turb returns turbulence at point p: the sum of depth octaves of noise.
+func (pe *Perlin) Turb(p geom.Vec, depth int) float64 {
 	sum := 0.0
 	p2 := p
 	weight := 1.0
 	for i := 0; i < depth; i++ {
-		sum += weight * perlin(p2)
+		sum += weight * pe.Noise(p2)
 		weight *= 0.5
 		p2 = p2.Scaled(2)
 	}
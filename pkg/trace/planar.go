@@ -0,0 +1,172 @@
+package trace
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+// Quad is a flat parallelogram in any orientation.
+type Quad struct {
+	corner, u, v geom.Vec
+	norm         geom.Unit
+	w            geom.Vec // the normal over the squared area, which projects points onto u and v
+	area         float64
+	bounds       *AABB
+	mat          Material
+}
+
+// NewQuad returns a new parallelogram with material m, from corner to corner+u+v.
+// Its uvs run from 0 to 1 along u and v, and its normal is u x v,
+// so it faces the side from which u turns counterclockwise onto v.
+func NewQuad(corner, u, v geom.Vec, m Material) *Quad {
+	n := u.Cross(v)
+	q := Quad{corner: corner, u: u, v: v, area: n.Len(), mat: m}
+	if q.area > 0 {
+		q.norm = n.Unit()
+		q.w = n.Scaled(1 / n.LenSq())
+	}
+	min, max := corner, corner
+	for _, p := range []geom.Vec{corner.Plus(u), corner.Plus(v), corner.Plus(u).Plus(v)} {
+		min, max = min.Min(p), max.Max(p)
+	}
+	q.bounds = padded(min, max)
+	return &q
+}
+
+// Hit returns details of the intersection between r and this surface.
+// If r does not intersect with this surface, it returns nil.
+func (q *Quad) Hit(r Ray, dMin, dMax float64, _ *rand.Rand) *Hit {
+	if q.area == 0 {
+		return nil
+	}
+	d, ok := planeDist(r, q.corner, q.norm, dMin, dMax)
+	if !ok {
+		return nil
+	}
+	p := r.At(d)
+	rel := p.Minus(q.corner)
+	a := q.w.Dot(rel.Cross(q.v))
+	b := q.w.Dot(q.u.Cross(rel))
+	if a < 0 || a > 1 || b < 0 || b > 1 {
+		return nil
+	}
+	return &Hit{Dist: d, Norm: q.norm, UV: geom.Vec{a, b, 0}, Pt: p, Mat: q.mat, Surface: q}
+}
+
+// Bounds returns an axis-aligned bounding box that encloses
+// this quad from time t0 to t1.
+func (q *Quad) Bounds(t0, t1 float64) *AABB {
+	return q.bounds
+}
+
+// Disk is a flat circle in any orientation.
+type Disk struct {
+	center geom.Vec
+	norm   geom.Unit
+	tu, tv geom.Unit // the disk's directions of increasing u and v
+	rad    float64
+	bounds *AABB
+	mat    Material
+}
+
+// NewDisk returns a new disk with material m, facing normal.
+// Its uvs map the square around it to 0 to 1, like a label:
+// seen from the front, u increases to the right and v up, with up toward +y
+// (or -z, for disks that face along the y axis).
+func NewDisk(center geom.Vec, normal geom.Unit, radius float64, m Material) *Disk {
+	d := Disk{center: center, norm: normal, rad: radius, mat: m}
+	d.tu, d.tv = tangents(normal)
+	// the disk reaches radius * sin(angle to the normal) along each axis.
+	var ext geom.Vec
+	for i := range ext {
+		ext[i] = radius * math.Sqrt(math.Max(0, 1-normal[i]*normal[i]))
+	}
+	d.bounds = padded(center.Minus(ext), center.Plus(ext))
+	return &d
+}
+
+// Hit returns details of the intersection between r and this surface.
+// If r does not intersect with this surface, it returns nil.
+func (d *Disk) Hit(r Ray, dMin, dMax float64, _ *rand.Rand) *Hit {
+	dist, ok := planeDist(r, d.center, d.norm, dMin, dMax)
+	if !ok {
+		return nil
+	}
+	p := r.At(dist)
+	rel := p.Minus(d.center)
+	if rel.LenSq() > d.rad*d.rad {
+		return nil
+	}
+	uv := geom.Vec{(rel.Dot(geom.Vec(d.tu))/d.rad + 1) / 2, (rel.Dot(geom.Vec(d.tv))/d.rad + 1) / 2, 0}
+	return &Hit{Dist: dist, Norm: d.norm, UV: uv, Pt: p, Mat: d.mat, Surface: d}
+}
+
+// Bounds returns an axis-aligned bounding box that encloses
+// this disk from time t0 to t1.
+func (d *Disk) Bounds(t0, t1 float64) *AABB {
+	return d.bounds
+}
+
+// Plane is an infinite flat surface, like a ground or a distant wall.
+// Its bounds are infinite, so a BVH tests it against every ray
+// rather than letting it swallow the rest of the hierarchy.
+type Plane struct {
+	point  geom.Vec
+	norm   geom.Unit
+	tu, tv geom.Unit
+	mat    Material
+}
+
+// NewPlane returns a new plane with material m, through point and facing normal.
+// Its uvs are distances from point in scene units, along the same directions as a Disk's,
+// so image textures need to be wrapped to repeat across it.
+func NewPlane(point geom.Vec, normal geom.Unit, m Material) *Plane {
+	p := Plane{point: point, norm: normal, mat: m}
+	p.tu, p.tv = tangents(normal)
+	return &p
+}
+
+// Hit returns details of the intersection between r and this surface.
+// If r does not intersect with this surface, it returns nil.
+func (p *Plane) Hit(r Ray, dMin, dMax float64, _ *rand.Rand) *Hit {
+	dist, ok := planeDist(r, p.point, p.norm, dMin, dMax)
+	if !ok {
+		return nil
+	}
+	pt := r.At(dist)
+	rel := pt.Minus(p.point)
+	uv := geom.Vec{rel.Dot(geom.Vec(p.tu)), rel.Dot(geom.Vec(p.tv)), 0}
+	return &Hit{Dist: dist, Norm: p.norm, UV: uv, Pt: pt, Mat: p.mat, Surface: p}
+}
+
+// Bounds returns an infinite bounding box.
+func (p *Plane) Bounds(t0, t1 float64) *AABB {
+	return infiniteAABB()
+}
+
+// planeDist returns the distance along r to the plane through p with normal n,
+// and whether it's between dMin and dMax.
+// Rays parallel to the plane miss it.
+func planeDist(r Ray, p geom.Vec, n geom.Unit, dMin, dMax float64) (float64, bool) {
+	denom := n.Dot(r.Dir)
+	if math.Abs(denom) < 1e-12 {
+		return 0, false
+	}
+	d := geom.Vec(n).Dot(p.Minus(r.Or)) / denom
+	return d, d >= dMin && d <= dMax
+}
+
+// tangents returns the directions of increasing u and v on a surface facing n,
+// chosen so that, seen from the front, u points right and v points up toward +y,
+// or toward -z when n is along the y axis.
+func tangents(n geom.Unit) (u, v geom.Unit) {
+	up := geom.Vec{0, 1, 0}
+	if math.Abs(n[1]) > 0.999 {
+		up = geom.Vec{0, 0, -1}
+	}
+	u = up.Cross(geom.Vec(n)).Unit()
+	v = geom.Vec(n).Cross(geom.Vec(u)).Unit()
+	return u, v
+}
@@ -0,0 +1,224 @@
+package trace
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/geom"
+)
+
+func TestQuadEdges(t *testing.T) {
+	corner, u, v := geom.Vec{1, 2, 0}, geom.Vec{2, 0, 0}, geom.Vec{0.5, 1, 0}
+	q := NewQuad(corner, u, v, nil)
+	tests := []struct {
+		name string
+		a, b float64 // the point's coordinates along u and v
+		hit  bool
+	}{
+		{"middle", 0.5, 0.5, true},
+		{"corner", 0, 0, true},
+		{"opposite corner", 1, 1, true},
+		{"u edge", 0.5, 0, true},
+		{"far u edge", 0.5, 1, true},
+		{"v edge", 0, 0.5, true},
+		{"far v edge", 1, 0.5, true},
+		{"before u edge", 0.5, -1e-6, false},
+		{"past far u edge", 0.5, 1 + 1e-6, false},
+		{"before v edge", -1e-6, 0.5, false},
+		{"past far v edge", 1 + 1e-6, 0.5, false},
+		{"inside far corner", 1 - 1e-6, 1 - 1e-6, true},
+		{"outside far corner", 1 + 1e-6, 1 + 1e-6, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := corner.Plus(u.Scaled(test.a)).Plus(v.Scaled(test.b))
+			hit := q.Hit(NewRay(p.Plus(geom.Vec{0.2, 0.1, 1}), geom.Vec{-0.2, -0.1, -1}.Unit(), 0), 0, math.MaxFloat64, nil)
+			if !test.hit {
+				if hit != nil {
+					t.Fatalf("got a hit at %v, uv %v, want a miss", hit.Pt, hit.UV)
+				}
+				return
+			}
+			if hit == nil {
+				t.Fatal("missed")
+			}
+			if !near(hit.Pt, p) {
+				t.Errorf("hit at %v, want %v", hit.Pt, p)
+			}
+			if !near(hit.UV, geom.Vec{test.a, test.b, 0}) {
+				t.Errorf("uv %v, want %v, %v", hit.UV, test.a, test.b)
+			}
+			if !near(geom.Vec(hit.Norm), geom.Vec{0, 0, 1}) {
+				t.Errorf("normal %v, want 0, 0, 1", hit.Norm)
+			}
+		})
+	}
+}
+
+func TestDiskRadius(t *testing.T) {
+	center, norm, radius := geom.Vec{1, 2, 3}, geom.Vec{1, 1, 1}.Unit(), 2.0
+	d := NewDisk(center, norm, radius, nil)
+	out := geom.Vec{1, -1, 0}.Unit() // a direction along the disk
+	tests := []struct {
+		name string
+		dist float64 // how far from the center the ray crosses the disk's plane
+		hit  bool
+	}{
+		{"center", 0, true},
+		{"halfway", radius / 2, true},
+		{"just inside", radius * (1 - 1e-9), true},
+		{"just outside", radius * (1 + 1e-9), false},
+		{"outside", radius * 1.5, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := center.Plus(geom.Vec(out).Scaled(test.dist))
+			// the ray comes in at a slant from the disk's front.
+			dir := geom.Vec(norm).Scaled(-1).Plus(geom.Vec{0.1, 0.2, -0.3})
+			hit := d.Hit(NewRay(p.Minus(dir.Scaled(3)), dir.Unit(), 0), 0, math.MaxFloat64, nil)
+			if !test.hit {
+				if hit != nil {
+					t.Fatalf("got a hit at %v, want a miss", hit.Pt)
+				}
+				return
+			}
+			if hit == nil {
+				t.Fatal("missed")
+			}
+			if !near(hit.Pt, p) {
+				t.Errorf("hit at %v, want %v", hit.Pt, p)
+			}
+			if b := d.Bounds(0, 1); b.Extended(hit.Pt).Min() != b.Min() || b.Extended(hit.Pt).Max() != b.Max() {
+				t.Errorf("hit at %v, outside the disk's bounds", hit.Pt)
+			}
+			// uvs run from 0 to 1 across the disk's diameter.
+			rel := geom.Vec(out).Scaled(test.dist / radius / 2)
+			uv := geom.Vec{0.5 + rel.Dot(geom.Vec(d.tu)), 0.5 + rel.Dot(geom.Vec(d.tv)), 0}
+			if !near(hit.UV, uv) {
+				t.Errorf("uv %v, want %v", hit.UV, uv)
+			}
+		})
+	}
+}
+
+func TestPlaneGrazing(t *testing.T) {
+	p := NewPlane(geom.Vec{0, 0, 0}, geom.Vec{0, 1, 0}.Unit(), nil)
+	or := geom.Vec{0, 1, 0}
+	tests := []struct {
+		name string
+		dir  geom.Vec
+		dMax float64
+		hit  bool
+	}{
+		{"steep", geom.Vec{1, -1, 0}, math.MaxFloat64, true},
+		{"shallow", geom.Vec{1, -1e-3, 0}, math.MaxFloat64, true},
+		{"grazing", geom.Vec{1, -1e-8, 1}, math.MaxFloat64, true},
+		{"grazing, short of the plane", geom.Vec{1, -1e-8, 1}, 1e6, false},
+		{"grazing, away", geom.Vec{1, 1e-8, 1}, math.MaxFloat64, false},
+		{"parallel", geom.Vec{1, 0, 1}, math.MaxFloat64, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRay(or, test.dir.Unit(), 0)
+			hit := p.Hit(r, 0, test.dMax, nil)
+			if !test.hit {
+				if hit != nil {
+					t.Fatalf("got a hit at %v, want a miss", hit.Pt)
+				}
+				return
+			}
+			if hit == nil {
+				t.Fatal("missed")
+			}
+			// the ray drops the 1 unit to the plane as it runs 1/-dir.y units along it.
+			want := or.Plus(test.dir.Scaled(-1 / test.dir.Y()))
+			if hit.Pt.Minus(want).Len() > want.Len()*1e-9 || math.Abs(hit.Pt.Y()) > 1e-6 {
+				t.Errorf("hit at %v, want %v", hit.Pt, want)
+			}
+			if math.Abs(hit.Dist-want.Minus(or).Len()) > hit.Dist*1e-9 {
+				t.Errorf("hit at distance %v, want %v", hit.Dist, want.Minus(or).Len())
+			}
+			if hit.Norm != p.norm {
+				t.Errorf("normal %v, want %v", hit.Norm, p.norm)
+			}
+		})
+	}
+}
+
+func TestBVHWithPlanes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var ss []Surface
+	for i := 0; i < 20; i++ {
+		c := geom.Vec{rnd.Float64()*8 - 4, rnd.Float64() * 3, rnd.Float64()*8 - 4}
+		switch i % 3 {
+		case 0:
+			ss = append(ss, NewSphere(c, 0.2+rnd.Float64()*0.5, nil))
+		case 1:
+			ss = append(ss, NewQuad(c, geom.Vec{rnd.Float64(), 0, 0.5}, geom.Vec{0, 1, rnd.Float64()}, nil))
+		default:
+			ss = append(ss, NewDisk(c, geom.Vec{rnd.Float64(), 1, rnd.Float64()}.Unit(), 0.5, nil))
+		}
+	}
+	ground := NewPlane(geom.Vec{0, -0.5, 0}, geom.Vec{0, 1, 0}.Unit(), nil)
+	// a wall behind the scene, turned to run diagonally across it.
+	wall := NewRotateY(NewPlane(geom.Vec{0, 0, -6}, geom.Vec{0, 0, 1}.Unit(), nil), 30)
+	if !wall.Bounds(0, 1).infinite() {
+		t.Fatalf("rotated plane has bounds %v, want infinite ones", wall.Bounds(0, 1))
+	}
+	all := append(append([]Surface{}, ss...), ground, wall)
+
+	tests := []struct {
+		name string
+		bvh  *BVH
+	}{
+		{"planes first", NewBVH(0, 1, append([]Surface{ground, wall}, ss...)...)},
+		{"planes last", NewBVH(0, 1, all...)},
+		// a BVH with a plane inside it has infinite bounds itself, so it's also kept out of the hierarchy.
+		{"nested", NewBVH(0, 1, append([]Surface{NewBVH(0, 1, append([]Surface{ground}, ss[:10]...)...), wall}, ss[10:]...)...)},
+	}
+	list := NewList(all...)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			planes := 0
+			for i := 0; i < 5000; i++ {
+				or := geom.Vec{rnd.Float64()*12 - 6, rnd.Float64() * 6, rnd.Float64()*12 - 6}
+				dir := geom.Vec{rnd.Float64()*2 - 1, rnd.Float64()*2 - 1, rnd.Float64()*2 - 1}
+				if i%10 == 0 {
+					// rays along an axis have infinite slopes in the bounding box tests.
+					dir = geom.Vec{}
+					dir[i/10%3] = float64(1 - i/10%2*2)
+				}
+				if dir.LenSq() == 0 {
+					continue
+				}
+				r := NewRay(or, dir.Unit(), 0)
+				got, want := test.bvh.Hit(r, 0.001, math.MaxFloat64, nil), list.Hit(r, 0.001, math.MaxFloat64, nil)
+				if (got == nil) != (want == nil) || got != nil && (got.Surface != want.Surface || got.Dist != want.Dist) {
+					t.Fatalf("ray from %v along %v hit %+v, want %+v", or, dir, got, want)
+				}
+				if got != nil && (got.Surface == ground || got.Surface == wall) {
+					planes++
+				}
+			}
+			if planes == 0 {
+				t.Error("no ray hit a plane")
+			}
+		})
+	}
+
+	t.Run("rotated plane", func(t *testing.T) {
+		// the wall crosses the x axis where the rotated z = -6: at x = -6 / sin(30°).
+		r := NewRay(geom.Vec{0, 1, 0}, geom.Vec{-1, 0, 0}.Unit(), 0)
+		hit := wall.Hit(r, 0, math.MaxFloat64, nil)
+		if hit == nil {
+			t.Fatal("missed")
+		}
+		if want := (geom.Vec{-12, 1, 0}); !near(hit.Pt, want) {
+			t.Errorf("hit at %v, want %v", hit.Pt, want)
+		}
+		if want := (geom.Vec{0.5, 0, math.Sqrt(3) / 2}); !near(geom.Vec(hit.Norm), want) {
+			t.Errorf("normal %v, want %v", hit.Norm, want)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package trace
+
+// stream is a small, fast rand.Source64 (SplitMix64).
+// Unlike the standard library's source, it is cheap to re-seed,
+// so every pixel can be traced with its own independent stream of random numbers.
+type stream struct {
+	state uint64
+}
+
+// Seed restarts the stream from seed.
+func (s *stream) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// Uint64 returns the next pseudo-random 64-bit value.
+func (s *stream) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return mix(s.state)
+}
+
+// Int63 returns the next pseudo-random, non-negative 63-bit value.
+func (s *stream) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// pixelSeed derives an independent seed for pixel x, y from a render's seed
+// and the number of samples n that the pixel has already accumulated.
+// The result doesn't depend on which worker traces the pixel or when,
+// so renders with the same seed are identical,
+// and resumed renders continue with fresh random numbers.
+func pixelSeed(seed int64, x, y, n int) int64 {
+	h := mix(uint64(seed) ^ 0x5851f42d4c957f2d)
+	h = mix(h ^ uint64(uint32(x)))
+	h = mix(h ^ uint64(uint32(y))<<32)
+	h = mix(h ^ uint64(n))
+	return int64(h)
+}
+
+// mix scrambles the bits of z (the SplitMix64 finalizer).
+func mix(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
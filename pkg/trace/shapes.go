@@ -53,11 +53,12 @@ func (s *Sphere) Hit(r Ray, dMin, dMax float64, _ *rand.Rand) *Hit {
 	}
 	p := r.At(d)
 	return &Hit{
-		Dist: d,
-		Norm: p.Minus(s.Center(r.T)).Scaled(s.rad).Unit(),
-		UV:   s.UV(p, r.T),
-		Pt:   p,
-		Mat:  s.mat,
+		Dist:    d,
+		Norm:    p.Minus(s.Center(r.T)).Scaled(s.rad).Unit(),
+		UV:      s.UV(p, r.T),
+		Pt:      p,
+		Mat:     s.mat,
+		Surface: s,
 	}
 }
 
@@ -138,11 +139,12 @@ func (r *Rect) Hit(in Ray, dMin, dMax float64, _ *rand.Rand) *Hit {
 	norm := geom.Unit{0, 0, 0}
 	norm[a0] = 1
 	return &Hit{
-		Dist: d,
-		UV:   geom.Vec{u, v, 0},
-		Pt:   in.At(d),
-		Mat:  r.mat,
-		Norm: norm,
+		Dist:    d,
+		UV:      geom.Vec{u, v, 0},
+		Pt:      in.At(d),
+		Mat:     r.mat,
+		Norm:    norm,
+		Surface: r,
 	}
 }
 
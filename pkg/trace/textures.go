@@ -119,6 +119,7 @@ func (i *Image) Map(uv, _ geom.Vec) Color {
 type Noise struct {
 	scale0, scale1 float64
 	axis           int
+	perlin         *Perlin
 }
 
 // NewNoise returns a new noise texture.
@@ -126,11 +127,16 @@ type Noise struct {
 // scale1 is the turbulence scale.
 // axis is the axis (0, 1, or 2) by which the perlin noise is modulated.
 func NewNoise(scale0, scale1 float64, axis int) *Noise {
-	return &Noise{scale0: scale0, scale1: scale1, axis: axis}
+	return NewPerlinNoise(defaultPerlin, scale0, scale1, axis)
+}
+
+// NewPerlinNoise returns a new noise texture that uses noise from generator p.
+func NewPerlinNoise(p *Perlin, scale0, scale1 float64, axis int) *Noise {
+	return &Noise{scale0: scale0, scale1: scale1, axis: axis, perlin: p}
 }
 
 // Map maps point p to a color via perlin noise.
 func (n *Noise) Map(_, p geom.Vec) Color {
-	bright := 0.5 * (1 + math.Sin(n.scale0*p[n.axis]+10*turb(p.Scaled(n.scale1), 7)))
+	bright := 0.5 * (1 + math.Sin(n.scale0*p[n.axis]+10*n.perlin.Turb(p.Scaled(n.scale1), 7)))
 	return white.Scaled(bright)
 }
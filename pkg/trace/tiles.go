@@ -0,0 +1,117 @@
+package trace
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+)
+
+// TileOrder is the order in which the tiles of an image are rendered.
+type TileOrder int
+
+// Tile orders.
+// Scanline renders tiles row by row from the top left.
+// Spiral renders tiles in rings outward from the center of the image.
+// Hilbert renders tiles along a Hilbert curve, which keeps consecutive tiles close together.
+const (
+	Scanline TileOrder = iota
+	Spiral
+	Hilbert
+)
+
+// ParseTileOrder returns the TileOrder with the given name, like "spiral".
+func ParseTileOrder(name string) (TileOrder, error) {
+	for _, o := range []TileOrder{Scanline, Spiral, Hilbert} {
+		if strings.EqualFold(name, o.String()) {
+			return o, nil
+		}
+	}
+	return Scanline, fmt.Errorf("unknown tile order %q", name)
+}
+
+// String returns the name of the tile order.
+func (o TileOrder) String() string {
+	switch o {
+	case Scanline:
+		return "scanline"
+	case Spiral:
+		return "spiral"
+	case Hilbert:
+		return "hilbert"
+	}
+	return fmt.Sprintf("TileOrder(%d)", int(o))
+}
+
+// tiles splits r into tiles of at most size x size pixels, in order o.
+func tiles(r image.Rectangle, size int, o TileOrder) []image.Rectangle {
+	cols := (r.Dx() + size - 1) / size
+	rows := (r.Dy() + size - 1) / size
+	type cell struct {
+		col, row int
+		rect     image.Rectangle
+	}
+	cells := make([]cell, 0, cols*rows)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			min := r.Min.Add(image.Pt(col*size, row*size))
+			rect := image.Rectangle{Min: min, Max: min.Add(image.Pt(size, size))}.Intersect(r)
+			cells = append(cells, cell{col: col, row: row, rect: rect})
+		}
+	}
+
+	switch o {
+	case Spiral:
+		cx, cy := float64(cols-1)/2, float64(rows-1)/2
+		key := func(c cell) (ring, angle float64) {
+			dx, dy := float64(c.col)-cx, float64(c.row)-cy
+			return math.Max(math.Abs(dx), math.Abs(dy)), math.Atan2(dy, dx)
+		}
+		sort.SliceStable(cells, func(i, j int) bool {
+			ri, ai := key(cells[i])
+			rj, aj := key(cells[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return ai < aj
+		})
+	case Hilbert:
+		n := 1
+		for n < cols || n < rows {
+			n *= 2
+		}
+		sort.SliceStable(cells, func(i, j int) bool {
+			return hilbert(n, cells[i].col, cells[i].row) < hilbert(n, cells[j].col, cells[j].row)
+		})
+	}
+
+	rects := make([]image.Rectangle, len(cells))
+	for i, c := range cells {
+		rects[i] = c.rect
+	}
+	return rects
+}
+
+// hilbert returns the distance of cell x, y along a Hilbert curve that fills an n x n grid.
+// n must be a power of two.
+func hilbert(n, x, y int) (d int) {
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
@@ -0,0 +1,92 @@
+package trace
+
+import (
+	"fmt"
+	"image"
+	"testing"
+)
+
+func TestTilesCover(t *testing.T) {
+	rects := []image.Rectangle{
+		image.Rect(0, 0, 64, 64),
+		image.Rect(0, 0, 100, 37),
+		image.Rect(0, 0, 7, 300),
+		image.Rect(13, -5, 50, 46), // a crop away from the origin
+		image.Rect(0, 0, 1, 1),
+	}
+	for _, o := range []TileOrder{Scanline, Spiral, Hilbert} {
+		for _, r := range rects {
+			for _, size := range []int{1, 5, 16, 64, 500} {
+				t.Run(fmt.Sprintf("%s %v by %d", o, r, size), func(t *testing.T) {
+					covered := make(map[image.Point]int)
+					for _, tile := range tiles(r, size, o) {
+						if tile.Empty() || !tile.In(r) || tile.Dx() > size || tile.Dy() > size {
+							t.Fatalf("tile %v isn't a non-empty tile of at most %d pixels within %v", tile, size, r)
+						}
+						for y := tile.Min.Y; y < tile.Max.Y; y++ {
+							for x := tile.Min.X; x < tile.Max.X; x++ {
+								covered[image.Pt(x, y)]++
+							}
+						}
+					}
+					if len(covered) != r.Dx()*r.Dy() {
+						t.Errorf("tiles cover %d pixels, want %d", len(covered), r.Dx()*r.Dy())
+					}
+					for p, n := range covered {
+						if n != 1 {
+							t.Fatalf("pixel %v is in %d tiles", p, n)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestTilesOrder(t *testing.T) {
+	r := image.Rect(0, 0, 40, 40)
+	first := map[TileOrder]image.Point{
+		Scanline: {0, 0},
+		Spiral:   {10, 10}, // the center of the 4 x 4 tiles is between the middle four
+		Hilbert:  {0, 0},
+	}
+	for o, want := range first {
+		if got := tiles(r, 10, o)[0].Min; got != want {
+			t.Errorf("%s: first tile at %v, want %v", o, got, want)
+		}
+	}
+	// each tile along a Hilbert curve is next to the one before it.
+	ts := tiles(r, 10, Hilbert)
+	for i := 1; i < len(ts); i++ {
+		d := ts[i].Min.Sub(ts[i-1].Min)
+		if d.X*d.X+d.Y*d.Y != 100 {
+			t.Errorf("hilbert tile %d at %v isn't next to tile %d at %v", i, ts[i].Min, i-1, ts[i-1].Min)
+		}
+	}
+}
+
+func TestHilbert(t *testing.T) {
+	for _, n := range []int{1, 2, 4, 8, 32} {
+		seen := make(map[int]bool)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				d := hilbert(n, x, y)
+				if d < 0 || d >= n*n || seen[d] {
+					t.Fatalf("n %d: cell %d,%d has distance %d, which is out of range or repeated", n, x, y, d)
+				}
+				seen[d] = true
+			}
+		}
+	}
+}
+
+func TestParseTileOrder(t *testing.T) {
+	for _, o := range []TileOrder{Scanline, Spiral, Hilbert} {
+		if got, err := ParseTileOrder(o.String()); err != nil || got != o {
+			t.Errorf("ParseTileOrder(%q) = %v, %v", o, got, err)
+		}
+	}
+	if _, err := ParseTileOrder("zigzag"); err == nil {
+		t.Error("got no error for an unknown order")
+	}
+}
@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ToneOperator compresses the unbounded range of linear colors into the 0-1 range of a display.
+type ToneOperator int
+
+// Tone operators.
+// Clamp cuts off values above 1, so bright areas blow out to white.
+// Reinhard compresses bright values smoothly toward 1, preserving hue.
+// Filmic applies an approximation of the ACES filmic curve,
+// with a gentle toe in the shadows and a soft shoulder in the highlights.
+const (
+	Clamp ToneOperator = iota
+	Reinhard
+	Filmic
+)
+
+// ParseToneOperator returns the ToneOperator with the given name, like "reinhard".
+// "aces" is another name for Filmic.
+func ParseToneOperator(name string) (ToneOperator, error) {
+	switch strings.ToLower(name) {
+	case "clamp":
+		return Clamp, nil
+	case "reinhard":
+		return Reinhard, nil
+	case "filmic", "aces":
+		return Filmic, nil
+	}
+	return Clamp, fmt.Errorf("unknown tone operator %q", name)
+}
+
+// String returns the name of the tone operator.
+func (o ToneOperator) String() string {
+	switch o {
+	case Clamp:
+		return "clamp"
+	case Reinhard:
+		return "reinhard"
+	case Filmic:
+		return "filmic"
+	}
+	return fmt.Sprintf("ToneOperator(%d)", int(o))
+}
+
+// Tone converts linear colors from a render into display colors.
+// Colors are white balanced, exposed, tone mapped, and finally encoded with the sRGB transfer curve.
+// The zero Tone clamps colors without adjusting them.
+type Tone struct {
+	// Exposure brightens (positive) or darkens (negative) colors by this many stops.
+	Exposure float64
+	// White is the color that should appear neutral.
+	// If it's zero, colors aren't white balanced.
+	White Color
+	// Operator maps exposed colors into the displayable range.
+	Operator ToneOperator
+}
+
+// Map returns the display-referred, but still linear, equivalent of c in the 0-1 range.
+func (t Tone) Map(c Color) Color {
+	if t.White != black {
+		// dividing by White's normalized color keeps the overall brightness the same.
+		wl := luminance(t.White)
+		for i := 0; i < 3; i++ {
+			if t.White[i] > 0 {
+				c[i] *= wl / t.White[i]
+			}
+		}
+	}
+	c = c.Scaled(math.Exp2(t.Exposure))
+	switch t.Operator {
+	case Reinhard:
+		if l := luminance(c); l > 0 {
+			c = c.Scaled(1 / (1 + l))
+		}
+	case Filmic:
+		for i := 0; i < 3; i++ {
+			x := math.Max(0, c[i])
+			c[i] = (x * (2.51*x + 0.03)) / (x*(2.43*x+0.59) + 0.14)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		c[i] = math.Min(1, math.Max(0, c[i]))
+	}
+	return c
+}
+
+// Apply returns the sRGB-encoded display color for linear color c, in the 0-1 range.
+func (t Tone) Apply(c Color) Color {
+	c = t.Map(c)
+	for i := 0; i < 3; i++ {
+		c[i] = srgb(c[i])
+	}
+	return c
+}
+
+// RGB returns the 8-bit sRGB display color for linear color c.
+func (t Tone) RGB(c Color) (r, g, b uint8) {
+	c = t.Apply(c)
+	return uint8(c[0]*255 + 0.5), uint8(c[1]*255 + 0.5), uint8(c[2]*255 + 0.5)
+}
+
+// srgb encodes a linear value with the sRGB transfer curve.
+func srgb(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// linear decodes an sRGB-encoded value into a linear value.
+func linear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// luminance returns the relative luminance of linear color c (Rec. 709).
+func luminance(c Color) float64 {
+	return 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+}
@@ -0,0 +1,100 @@
+package trace
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestToneMap(t *testing.T) {
+	filmic1 := 2.54 / 3.16 // the filmic curve at 1
+	tests := []struct {
+		name string
+		tone Tone
+		in   Color
+		want Color
+	}{
+		{"zero", Tone{}, Color{0.5, 2, -1}, Color{0.5, 1, 0}},
+		{"brighter", Tone{Exposure: 1}, Color{0.25, 0.5, 1}, Color{0.5, 1, 1}},
+		{"darker", Tone{Exposure: -2}, Color{2, 4, 0.4}, Color{0.5, 1, 0.1}},
+		{"neutral white", Tone{White: Color{2, 2, 2}}, Color{0.3, 0.6, 0.9}, Color{0.3, 0.6, 0.9}},
+		// a color the same as White becomes a grey of White's luminance.
+		{"warm white", Tone{White: Color{1, 0.5, 0.25}}, Color{1, 0.5, 0.25}, Color{0.58825, 0.58825, 0.58825}},
+		// channels where White is zero aren't balanced.
+		{"white without green", Tone{White: Color{1, 0, 0.5}}, Color{0.5, 0.3, 0.5}, Color{0.5 * 0.2487, 0.3, 0.2487}},
+		{"white, negative", Tone{White: Color{1, 0.5, 0.25}}, Color{-1, -1, -1}, Color{0, 0, 0}},
+		{"reinhard", Tone{Operator: Reinhard}, Color{1, 1, 1}, Color{0.5, 0.5, 0.5}},
+		{"reinhard, bright", Tone{Operator: Reinhard}, Color{3, 3, 3}, Color{0.75, 0.75, 0.75}},
+		{"reinhard, exposed", Tone{Operator: Reinhard, Exposure: 1}, Color{1.5, 1.5, 1.5}, Color{0.75, 0.75, 0.75}},
+		{"reinhard, saturated", Tone{Operator: Reinhard}, Color{2, 0, 0}, Color{1, 0, 0}},
+		{"reinhard, negative", Tone{Operator: Reinhard}, Color{-1, -1, -1}, Color{0, 0, 0}},
+		{"filmic", Tone{Operator: Filmic}, Color{0, 1, 100}, Color{0, filmic1, 1}},
+		{"filmic, negative", Tone{Operator: Filmic}, Color{-1, -0.001, 0}, Color{0, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.tone.Map(test.in)
+			for i := range got {
+				if math.Abs(got[i]-test.want[i]) > 1e-9 {
+					t.Fatalf("Map(%v) = %v, want %v", test.in, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestToneRGB(t *testing.T) {
+	tests := []struct {
+		tone    Tone
+		in      Color
+		r, g, b uint8
+	}{
+		{Tone{}, Color{0, 0.5, 1}, 0, 188, 255},
+		{Tone{}, Color{-1, 0.18, 2}, 0, 118, 255},
+		{Tone{}, Color{0.001, 0.0031308, 0.01}, 3, 10, 25},
+		{Tone{Exposure: 1}, Color{0.25, 0.09, 0.5}, 188, 118, 255},
+	}
+	for _, test := range tests {
+		if r, g, b := test.tone.RGB(test.in); r != test.r || g != test.g || b != test.b {
+			t.Errorf("%+v RGB(%v) = %d, %d, %d, want %d, %d, %d", test.tone, test.in, r, g, b, test.r, test.g, test.b)
+		}
+	}
+}
+
+func TestSRGB(t *testing.T) {
+	tests := []struct{ lin, enc float64 }{
+		{0, 0},
+		{0.0031308, 0.04045}, // where the linear segment meets the curve
+		{0.18, 0.461356},
+		{0.5, 0.735357},
+		{1, 1},
+	}
+	for _, test := range tests {
+		if got := srgb(test.lin); math.Abs(got-test.enc) > 1e-5 {
+			t.Errorf("srgb(%v) = %v, want %v", test.lin, got, test.enc)
+		}
+		if got := linear(test.enc); math.Abs(got-test.lin) > 1e-5 {
+			t.Errorf("linear(%v) = %v, want %v", test.enc, got, test.lin)
+		}
+	}
+	for i := 0; i <= 100; i++ {
+		v := float64(i) / 100
+		if got := linear(srgb(v)); math.Abs(got-v) > 1e-9 {
+			t.Errorf("linear(srgb(%v)) = %v", v, got)
+		}
+	}
+}
+
+func TestParseToneOperator(t *testing.T) {
+	for name, want := range map[string]ToneOperator{"clamp": Clamp, "Reinhard": Reinhard, "filmic": Filmic, "ACES": Filmic} {
+		if got, err := ParseToneOperator(name); err != nil || got != want {
+			t.Errorf("ParseToneOperator(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseToneOperator("drago"); err == nil {
+		t.Error("got no error for an unknown operator")
+	}
+	if s := fmt.Sprint(ToneOperator(7)); s != "ToneOperator(7)" {
+		t.Errorf("got %q for an unknown operator's name", s)
+	}
+}
@@ -38,9 +38,10 @@ type Material interface {
 
 // Hit records the details of a Ray->Surface intersection.
 type Hit struct {
-	Dist float64
-	Norm geom.Unit
-	UV   geom.Vec
-	Pt   geom.Vec
-	Mat  Material
+	Dist    float64
+	Norm    geom.Unit
+	UV      geom.Vec
+	Pt      geom.Vec
+	Mat     Material
+	Surface Surface // the primitive surface that was hit
 }
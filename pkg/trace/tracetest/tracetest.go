@@ -0,0 +1,101 @@
+/*
+Package tracetest provides utilities for testing renders against golden images.
+
+Golden compares a render to a reference PNG, within statistical tolerances.
+Run tests with -update to write new reference images instead:
+
+	go test ./... -update
+
+When a render fails, it and a heat map of its differences are written to a new temporary directory,
+or to the directory given with -golden-out, and their paths are logged.
+*/
+package tracetest
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hunterloftis/oneweekend/pkg/compare"
+)
+
+var (
+	update = flag.Bool("update", false, "write new golden images instead of comparing renders to them")
+	out    = flag.String("golden-out", "", "directory to write renders that differ from their golden images to (default a new temporary directory)")
+)
+
+// Tolerance is how different a render may be from its golden image.
+type Tolerance struct {
+	// Downsample, if more than 1, compares the averages of Downsample x Downsample blocks of pixels,
+	// so that noise counts for less than changes to the image's expected value.
+	Downsample int
+	// RMSE is the largest root-mean-square error allowed.
+	RMSE float64
+	// SSIM is the least structural similarity allowed.
+	SSIM float64
+}
+
+// Golden compares got to the golden PNG at path, and fails t if they're too different.
+// On failure, the render and a heat map of its differences are written to the -golden-out directory,
+// or to a new temporary directory, which outlives the test so that they can be inspected.
+// With -update, Golden writes got to path instead.
+func Golden(t testing.TB, path string, got image.Image, tol Tolerance) {
+	t.Helper()
+	if *update {
+		if err := writePNG(path, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	want, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	r, err := compare.Images(compare.Downsample(got, tol.Downsample), compare.Downsample(want, tol.Downsample))
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	if r.RMSE <= tol.RMSE && r.SSIM >= tol.SSIM {
+		return
+	}
+	t.Errorf("%s: render differs from golden image (want rmse <= %g, ssim >= %g): %v", path, tol.RMSE, tol.SSIM, r)
+	dir := *out
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "golden"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	render, heat := filepath.Join(dir, name+".png"), filepath.Join(dir, name+".diff.png")
+	if err := writePNG(render, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePNG(heat, r.HeatMap(0)); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("wrote the render to %s and a heat map of its differences to %s", render, heat)
+}
+
+func writePNG(path string, im image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, im); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
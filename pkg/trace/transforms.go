@@ -52,6 +52,11 @@ func NewRotateY(child Surface, angle float64) *RotateY {
 		cosTheta: math.Cos(rads),
 		bounds:   child.Bounds(0, 1),
 	}
+	if r.bounds.infinite() {
+		// the corners of an infinite box aren't points that can be rotated.
+		r.bounds = infiniteAABB()
+		return &r
+	}
 	for _, p := range r.bounds.Corners() {
 		p2 := r.right(p)
 		r.bounds = r.bounds.Extended(p2)
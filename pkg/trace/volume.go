@@ -55,11 +55,12 @@ func (v *Volume) Hit(r Ray, dMin, dMax float64, rnd *rand.Rand) *Hit {
 		return nil
 	}
 	return &Hit{
-		Dist: d,
-		Norm: geom.Unit{1, 0, 0},
-		UV:   geom.Vec{0, 0, 0},
-		Pt:   r.At(d),
-		Mat:  v.phase,
+		Dist:    d,
+		Norm:    geom.Unit{1, 0, 0},
+		UV:      geom.Vec{0, 0, 0},
+		Pt:      r.At(d),
+		Mat:     v.phase,
+		Surface: v,
 	}
 }
 
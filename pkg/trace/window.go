@@ -1,25 +1,41 @@
 package trace
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
 	"io"
 	"math"
 	"math/rand"
 	"runtime"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/hunterloftis/oneweekend/pkg/geom"
 )
 
+// defaultTileSize is the width and height of tiles when RenderOptions doesn't specify one.
+const defaultTileSize = 32
+
+type job struct {
+	index int
+	prior *Frame
+}
+
 type result struct {
-	row    int
-	pixels string
+	index int
+	tile  *Frame
 }
 
 // Window gathers the results of ray traces in a width x height grid.
 type Window struct {
 	width, height int
+
+	// ids caches the surface IDs of idsOf, so the tiles of a render don't each number the scene again.
+	idsMu sync.Mutex
+	idsOf Surface
+	ids   map[Surface]int
 }
 
 // NewWindow creates a new Window with dimensions width and height.
@@ -27,57 +43,341 @@ func NewWindow(width, height int) *Window {
 	return &Window{width: width, height: height}
 }
 
+// RenderOptions configures a render.
+type RenderOptions struct {
+	// Samples is the number of rays traced through each pixel in each pass.
+	Samples int
+	// Passes is the number of times Samples rays are traced through each pixel.
+	// If zero, the render makes a single pass,
+	// unless Threshold or Budget is set, in which case passes continue
+	// until every pixel converges, reaches MaxSamples, or the Budget runs out.
+	Passes int
+	// Threshold, if non-zero, enables adaptive sampling:
+	// pixels whose Error falls below Threshold stop receiving samples,
+	// leaving the rest of the render's time for noisier pixels.
+	Threshold float64
+	// MinSamples is the number of samples a pixel needs before it can be considered converged.
+	MinSamples int
+	// MaxSamples, if non-zero, is the most samples any pixel will receive.
+	MaxSamples int
+	// Budget, if non-zero, stops the render after this much time has passed.
+	// Renders that stop because of their Budget are complete rather than cancelled.
+	Budget time.Duration
+	// AOVs are the auxiliary layers to record alongside the rendered image.
+	AOVs []AOV
+	// Filter, if non-nil, spreads each sample over the pixels around it with filter weights.
+	// If nil, each sample contributes only to the pixel it was traced through.
+	Filter Filter
+	// Seed determines the random numbers used for each pixel.
+	// Renders of the same scene with the same seed are identical.
+	Seed int64
+	// Workers is the number of goroutines that trace rays.
+	// If zero, it's one more than the number of CPUs.
+	Workers int
+	// TileSize is the width and height of the square tiles that workers render.
+	// If zero, tiles are 32 x 32 pixels.
+	TileSize int
+	// Order is the order in which tiles are rendered.
+	Order TileOrder
+	// Crop, if not empty, restricts the render to this rectangle of the Window.
+	Crop image.Rectangle
+	// Progress, if non-nil, is called after each tile of the image is traced.
+	Progress func(Progress)
+	// TileDone, if non-nil, is called with each tile after it has been traced
+	// and added to frame f.
+	TileDone func(tile image.Rectangle, f *Frame)
+	// PassDone, if non-nil, is called with the frame after each pass is complete.
+	PassDone func(pass int, f *Frame)
+}
+
+// Progress reports how far a render has come.
+type Progress struct {
+	Done, Total int // tiles of the image, or zero Total if the number of passes is unknown
+	Samples     int // samples traced so far
+	Elapsed     time.Duration
+	Remaining   time.Duration // estimated time until the render finishes
+}
+
 // WritePPM traces each pixel in the Window and writes the results to w in PPM format.
 func (wi *Window) WritePPM(w io.Writer, cam *Camera, s Surface, samples int) error {
-	if _, err := fmt.Fprint(w, "P3\n", wi.width, wi.height, "\n255\n"); err != nil {
+	return wi.Write(w, PPM, cam, s, samples)
+}
+
+// Write traces each pixel in the Window and writes the results to w in format f.
+func (wi *Window) Write(w io.Writer, f Format, cam *Camera, s Surface, samples int) error {
+	fr, _ := wi.Render(context.Background(), cam, s, RenderOptions{Samples: samples})
+	return fr.Encode(w, f)
+}
+
+// Render traces samples through each pixel in the Window and returns the results in a Frame.
+// If ctx is cancelled before the render completes, Render stops tracing
+// and returns the partially-rendered Frame along with ctx's error.
+func (wi *Window) Render(ctx context.Context, cam *Camera, s Surface, opts RenderOptions) (*Frame, error) {
+	f := wi.Frame(opts)
+	return f, wi.Resume(ctx, f, cam, s, opts)
+}
+
+// Frame returns a new, empty Frame for a render with opts.
+// It covers opts.Crop, or the whole Window, and its samples are derived from opts.Seed.
+func (wi *Window) Frame(opts RenderOptions) *Frame {
+	f := NewFrame(wi.bounds(opts))
+	f.seed = opts.Seed
+	f.size = image.Pt(wi.width, wi.height)
+	f.filter = filterID(opts.Filter)
+	return f
+}
+
+// Resumable returns an error if more samples traced with opts can't be added to f:
+// if f was rendered by a Window of a different size, with a different filter, or with a different crop.
+// Frames made with NewFrame, rather than by a Window, are always resumable.
+func (wi *Window) Resumable(f *Frame, opts RenderOptions) error {
+	if f.size == (image.Point{}) {
+		return nil
+	}
+	if f.size != image.Pt(wi.width, wi.height) {
+		return fmt.Errorf("frame was rendered at %dx%d, not %dx%d", f.size.X, f.size.Y, wi.width, wi.height)
+	}
+	if f.filter != filterID(opts.Filter) {
+		return errors.New("frame was rendered with a different filter")
+	}
+	if r := wi.bounds(opts); f.rect != r {
+		return fmt.Errorf("frame covers %v, not %v", f.rect, r)
+	}
+	return nil
+}
+
+// bounds returns the rectangle covered by a render with opts.
+func (wi *Window) bounds(opts RenderOptions) image.Rectangle {
+	r := image.Rect(0, 0, wi.width, wi.height)
+	if !opts.Crop.Empty() {
+		r = opts.Crop.Intersect(r)
+	}
+	return r
+}
+
+// surfaceIDs returns the IDs of the primitive surfaces within s,
+// numbering them only the first time that s is rendered by the Window.
+func (wi *Window) surfaceIDs(s Surface) map[Surface]int {
+	wi.idsMu.Lock()
+	defer wi.idsMu.Unlock()
+	if wi.ids == nil || wi.idsOf != s {
+		wi.idsOf, wi.ids = s, surfaceIDs(s)
+	}
+	return wi.ids
+}
+
+// Tiles returns the tiles of frame f that each pass of a render with opts traces, in order.
+func (wi *Window) Tiles(f *Frame, opts RenderOptions) []image.Rectangle {
+	size := opts.TileSize
+	if size <= 0 {
+		size = defaultTileSize
+	}
+	return tiles(f.Bounds(), size, opts.Order)
+}
+
+// Tile traces one pass of opts.Samples more samples through the pixels of prior,
+// a crop of one of the Tiles of a larger frame, and returns the new samples in a new Frame.
+// The new samples are the same as those that Render would trace,
+// so merging the tiles of each pass into the larger frame in the order of Tiles
+// reproduces a Render, even when the tiles are traced by separate processes.
+// With a filter, the returned Frame also covers the pixels around the tile that its samples contribute to.
+func (wi *Window) Tile(ctx context.Context, prior *Frame, cam *Camera, s Surface, opts RenderOptions) *Frame {
+	var ids map[Surface]int
+	for _, a := range opts.AOVs {
+		if a == AOVID {
+			ids = wi.surfaceIDs(s)
+		}
+	}
+	return wi.trace(ctx, prior, wi.bounds(opts), prior.seed, cam, s, opts, ids, rand.New(&stream{}))
+}
+
+// Resume traces more samples through each pixel of an existing Frame,
+// such as one from a previous Render or a checkpoint.
+// The new samples continue the random streams of the frame's seed, so opts.Seed is ignored.
+// Resume returns an error, without tracing, unless f is Resumable with opts.
+// If ctx is cancelled before the render completes, Resume stops tracing
+// and returns ctx's error; f holds every sample traced up to that point.
+func (wi *Window) Resume(ctx context.Context, f *Frame, cam *Camera, s Surface, opts RenderOptions) error {
+	if err := wi.Resumable(f, opts); err != nil {
 		return err
 	}
+	passes := opts.Passes
+	if passes <= 0 {
+		passes = 1
+		if opts.Threshold > 0 || opts.Budget > 0 {
+			passes = math.MaxInt32
+		}
+	}
+	if opts.MaxSamples > 0 && opts.Samples > 0 {
+		if most := (opts.MaxSamples + opts.Samples - 1) / opts.Samples; most < passes {
+			passes = most
+		}
+	}
+	start := time.Now()
+	tctx := ctx
+	if opts.Budget > 0 {
+		var cancel context.CancelFunc
+		tctx, cancel = context.WithDeadline(ctx, start.Add(opts.Budget))
+		defer cancel()
+	}
+	var ids map[Surface]int
+	for _, a := range opts.AOVs {
+		f.addLayer(a)
+		if a == AOVID {
+			ids = wi.surfaceIDs(s)
+		}
+	}
+	ts := wi.Tiles(f, opts)
+	p := Progress{Total: len(ts) * passes}
+	if passes == math.MaxInt32 {
+		p.Total = 0
+	}
+	for pass := 0; pass < passes && f.needs(opts) > 0; pass++ {
+		wi.pass(tctx, f, ts, cam, s, opts, ids, &p, start)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if tctx.Err() != nil {
+			return nil
+		}
+		if opts.PassDone != nil {
+			opts.PassDone(pass, f)
+		}
+	}
+	return nil
+}
 
-	// create worker goroutines and one job per image row.
-	aspect := float64(wi.width) / float64(wi.height)
-	nw := runtime.NumCPU() + 1
-	jobs := make(chan int, wi.height)
+// pass traces opts.Samples more samples through each pixel in tiles ts,
+// accumulating them into f.
+func (wi *Window) pass(ctx context.Context, f *Frame, ts []image.Rectangle, cam *Camera, s Surface, opts RenderOptions, ids map[Surface]int, p *Progress, start time.Time) {
+	nw := opts.Workers
+	if nw <= 0 {
+		nw = runtime.NumCPU() + 1
+	}
+
+	// create worker goroutines and one job per tile.
+	// each job includes a copy of the tile's previous samples,
+	// which determine the random streams for its new samples.
+	jobs := make(chan job, len(ts))
 	results := make(chan result, nw*2)
-	worker := func(rnd *rand.Rand) {
-		for y := range jobs {
-			var px strings.Builder
-			for x := 0; x < wi.width; x++ {
-				c := black
-				for n := 0; n < samples; n++ {
-					u := (float64(x) + rnd.Float64()) / float64(wi.width)
-					v := (float64(y) + rnd.Float64()) / float64(wi.height)
-					r := cam.Ray(u, v, aspect, rnd)
-					c = color(r, s, 0, rnd).Plus(c)
-				}
-				c = c.Scaled(1 / float64(samples)).Gamma(2)
-				r, g, b := c.RGBInt()
-				fmt.Fprintln(&px, r, g, b)
+	var wg sync.WaitGroup
+	worker := func() {
+		defer wg.Done()
+		rnd := rand.New(&stream{})
+		for j := range jobs {
+			if ctx.Err() != nil {
+				return
 			}
-			results <- result{row: y, pixels: px.String()}
+			tile := wi.trace(ctx, j.prior, f.Bounds(), f.seed, cam, s, opts, ids, rnd)
+			results <- result{index: j.index, tile: tile}
 		}
 	}
-	for w := 0; w < nw; w++ {
-		go worker(rand.New(rand.NewSource(time.Now().Unix())))
-	}
-	for y := 0; y < wi.height; y++ {
-		jobs <- y
+	for i, t := range ts {
+		jobs <- job{index: i, prior: f.Crop(t)}
 	}
 	close(jobs)
+	wg.Add(nw)
+	for w := 0; w < nw; w++ {
+		go worker()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-	// buffer results and write them in order.
+	// buffer results and merge them into the frame in order.
+	// filtered tiles overlap their neighbors,
+	// so a consistent order keeps the sums of overlapping pixels identical between renders.
+	merge := func(i int, tile *Frame) {
+		f.Merge(tile)
+		p.Samples += tile.Samples()
+		p.Done++
+		if opts.TileDone != nil {
+			opts.TileDone(ts[i], f)
+		}
+		if opts.Progress != nil {
+			p.Elapsed = time.Since(start)
+			p.Remaining = 0
+			if opts.Budget > 0 {
+				p.Remaining = opts.Budget - p.Elapsed
+			} else if p.Total > 0 {
+				p.Remaining = p.Elapsed * time.Duration(p.Total-p.Done) / time.Duration(p.Done)
+			}
+			opts.Progress(*p)
+		}
+	}
 	cursor := 0
-	pending := make(map[int]string, 0)
-	for y := 0; y < wi.height; y++ {
-		r := <-results
-		pending[r.row] = r.pixels
-		for pending[cursor] != "" {
-			fmt.Fprint(w, pending[cursor])
+	pending := make(map[int]*Frame)
+	for r := range results {
+		pending[r.index] = r.tile
+		for pending[cursor] != nil {
+			merge(cursor, pending[cursor])
 			delete(pending, cursor)
 			cursor++
 		}
 	}
 
-	return nil
+	// if the pass was cancelled, some tiles never arrived; merge the rest of those that did.
+	for i := cursor; i < len(ts) && len(pending) > 0; i++ {
+		if tile := pending[i]; tile != nil {
+			merge(i, tile)
+			delete(pending, i)
+		}
+	}
+}
+
+// trace traces samples through each pixel in the tile covered by prior
+// and returns the new samples in a new Frame.
+// With a filter, the new Frame also covers the pixels around the tile, within bounds,
+// that its samples contribute to.
+// ids maps surfaces to their IDs for the AOVID layer.
+// If ctx is cancelled, it stops early and returns the partially-traced tile.
+func (wi *Window) trace(ctx context.Context, prior *Frame, bounds image.Rectangle, seed int64, cam *Camera, s Surface, opts RenderOptions, ids map[Surface]int, rnd *rand.Rand) *Frame {
+	aspect := float64(wi.width) / float64(wi.height)
+	t := prior.Bounds()
+	margin := 0
+	if opts.Filter != nil {
+		margin = int(math.Ceil(opts.Filter.Radius()))
+	}
+	f := NewFrame(t.Inset(-margin).Intersect(bounds))
+	for _, a := range opts.AOVs {
+		f.addLayer(a)
+	}
+	for y := t.Min.Y; y < t.Max.Y; y++ {
+		for x := t.Min.X; x < t.Max.X; x++ {
+			if ctx.Err() != nil {
+				return f
+			}
+			px := prior.Pixel(x, y)
+			rnd.Seed(pixelSeed(seed, x, y, px.Samples))
+			for n := 0; n < opts.samples(px); n++ {
+				sx := float64(x) + rnd.Float64()
+				sy := float64(y) + rnd.Float64()
+				r := cam.Ray(sx/float64(wi.width), sy/float64(wi.height), aspect, rnd)
+				hit := s.Hit(r, bias, math.MaxFloat64, rnd)
+				for _, a := range opts.AOVs {
+					f.addAOV(a, f.offset(x, y), a.sample(hit, ids))
+				}
+				c := shade(r, hit, s, 0, rnd)
+				f.Add(x, y, c)
+				if opts.Filter != nil {
+					f.splat(sx, sy, c, opts.Filter)
+				}
+			}
+		}
+	}
+	return f
+}
+
+// samples returns the number of samples to trace through pixel px in the next pass.
+func (opts RenderOptions) samples(px Pixel) int {
+	if opts.Threshold > 0 && px.Samples >= opts.MinSamples && px.Samples > 1 && px.Error() < opts.Threshold {
+		return 0
+	}
+	if opts.MaxSamples > 0 && px.Samples+opts.Samples > opts.MaxSamples {
+		return opts.MaxSamples - px.Samples
+	}
+	return opts.Samples
 }
 
 // color recursively traces rays into s, starting with r.
@@ -87,7 +387,11 @@ func color(r Ray, s Surface, depth int, rnd *rand.Rand) Color {
 	if depth >= 50 {
 		return black
 	}
-	hit := s.Hit(r, bias, math.MaxFloat64, rnd)
+	return shade(r, s.Hit(r, bias, math.MaxFloat64, rnd), s, depth, rnd)
+}
+
+// shade returns the color of one random path that r could take after hitting hit.
+func shade(r Ray, hit *Hit, s Surface, depth int, rnd *rand.Rand) Color {
 	if hit == nil {
 		return black
 	}